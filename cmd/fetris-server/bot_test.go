@@ -0,0 +1,140 @@
+package main
+
+import "github.com/Efocor/FETRIS/engine"
+
+// .... Jugador automático de los clientes de la prueba del servidor ....
+// Para cada pieza busca la rotación y la columna que dejan menos huecos y el
+// tablero más bajo y parejo, y arma las teclas para llegar ahí.
+type bot struct {
+	plan  []engine.Input
+	locks int
+	ready bool
+}
+
+// Lo que aprieta el bot en este update
+func (b *bot) input(e *engine.Engine) engine.Input {
+	if e.Clearing() || e.Over {
+		return 0
+	}
+	if !b.ready || e.Locks != b.locks {
+		b.ready = true
+		b.locks = e.Locks
+		b.plan = planFor(e)
+	}
+	if len(b.plan) == 0 {
+		return 0
+	}
+	in := b.plan[0]
+	b.plan = b.plan[1:]
+	return in
+}
+
+// Teclas para dejar la pieza que cae en el mejor lugar
+func planFor(e *engine.Engine) []engine.Input {
+	best, bestRotation, bestX := 0.0, 0, e.FallingX
+	found := false
+	for r := 0; r < engine.NumRotaciones; r++ {
+		for x := -3; x < e.Width()+3; x++ {
+			if s, ok := placement(e, r, x); ok && (!found || s > best) {
+				best, bestRotation, bestX, found = s, r, x, true
+			}
+		}
+	}
+
+	//Entre tecla y tecla va un update sin nada, para que cada una sea un toque
+	var plan []engine.Input
+	for i := e.FallingRotation; i != bestRotation; i = (i + 1) % engine.NumRotaciones {
+		plan = append(plan, engine.InputRotate, 0)
+	}
+	for d := bestX - e.FallingX; d != 0; {
+		if d > 0 {
+			plan = append(plan, engine.InputRight, 0)
+			d--
+		} else {
+			plan = append(plan, engine.InputLeft, 0)
+			d++
+		}
+	}
+	return append(plan, engine.InputHardDrop, 0)
+}
+
+// ¿Cabe la pieza que cae con esa rotación en x, y?
+func fits(e *engine.Engine, rotation, x, y int) bool {
+	for _, b := range e.Pieces.Shape(e.FallingCol, rotation) {
+		bx, by := x+b.X, y+b.Y
+		if bx < 0 || bx >= e.Width() || by >= e.Height() {
+			return false
+		}
+		if by >= 0 && !e.Grid[by][bx].Empty() {
+			return false
+		}
+	}
+	return true
+}
+
+// Qué tan bueno es dejar caer la pieza con esa rotación en la columna x
+func placement(e *engine.Engine, rotation, x int) (float64, bool) {
+	y := e.FallingY
+	if !fits(e, rotation, x, y) {
+		return 0, false
+	}
+	for fits(e, rotation, x, y+1) {
+		y++
+	}
+
+	width, height := e.Width(), e.Height()
+	filled := make([][]bool, height)
+	for row := range filled {
+		filled[row] = make([]bool, width)
+		for col := range filled[row] {
+			filled[row][col] = !e.Grid[row][col].Empty()
+		}
+	}
+	for _, b := range e.Pieces.Shape(e.FallingCol, rotation) {
+		if y+b.Y >= 0 {
+			filled[y+b.Y][x+b.X] = true
+		}
+	}
+
+	//Las filas completas se van; en el resto se cuentan huecos y alturas
+	lines := 0
+	var rows [][]bool
+	for _, row := range filled {
+		full := true
+		for _, c := range row {
+			full = full && c
+		}
+		if full {
+			lines++
+		} else {
+			rows = append(rows, row)
+		}
+	}
+	holes, heights, bumps, prev := 0, 0, 0, -1
+	for col := 0; col < width; col++ {
+		top := len(rows)
+		for row := range rows {
+			if !rows[row][col] {
+				if top < row {
+					holes++
+				}
+			} else if top == len(rows) {
+				top = row
+			}
+		}
+		heights += len(rows) - top
+		//Lo disparejo entre columnas vecinas termina en huecos
+		if prev >= 0 {
+			bumps += abs(top - prev)
+		}
+		prev = top
+	}
+	return float64(lines)*4 - float64(holes)*6 - float64(heights)*0.3 - float64(bumps)*0.4, true
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
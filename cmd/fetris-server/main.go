@@ -0,0 +1,68 @@
+// .... Servidor dedicado de FETRIS ....
+// Hostea salas de 2 a 8 jugadores: los clientes crean o entran a una sala, el dueño
+// la empieza y el servidor juega la partida con las entradas de todos, reparte la
+// basura y decide quién gana.
+//
+//	go run ./cmd/fetris-server -puerto 7779
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/Efocor/FETRIS/engine"
+	"github.com/Efocor/FETRIS/netplay"
+)
+
+// Nombres de los objetivos para la línea de comandos
+var targetNames = map[string]engine.TargetKind{
+	"siguiente": engine.TargetNext,
+	"azar":      engine.TargetRandom,
+	"revancha":  engine.TargetAttacker,
+	"lider":     engine.TargetLeader,
+}
+
+func main() {
+	port := flag.Int("puerto", netplay.DefaultServerPort, "puerto donde se esperan los clientes")
+	maxRooms := flag.Int("salas", 32, "máximo de salas a la vez, 0 = sin límite")
+	target := flag.String("objetivo", "azar", "a quién manda basura cada jugador al empezar: siguiente, azar, revancha o lider")
+	piecesPath := flag.String("piezas", "", "archivo JSON con el set de piezas de todas las partidas")
+	levelsPath := flag.String("niveles", "", "archivo JSON con la tabla de niveles de todas las partidas")
+	flag.Parse()
+
+	setup := netplay.Setup{Config: engine.DefaultConfig()}
+	if *piecesPath != "" {
+		set, err := engine.LoadPieceSet(*piecesPath)
+		if err != nil {
+			log.Fatalf("Error al cargar las piezas: %v", err)
+		}
+		setup.Pieces = set
+	}
+	if *levelsPath != "" {
+		levels, err := engine.LoadLevelTable(*levelsPath)
+		if err != nil {
+			log.Fatalf("Error al cargar los niveles: %v", err)
+		}
+		setup.Levels = levels
+	}
+
+	server := netplay.NewServer(setup)
+	server.MaxRooms = *maxRooms
+	kind, ok := targetNames[strings.ToLower(*target)]
+	if !ok {
+		log.Fatalf("Objetivo desconocido %q", *target)
+	}
+	server.Targeting = kind
+
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", *port))
+	if err != nil {
+		log.Fatal(err)
+	}
+	server.Log = log.New(os.Stdout, "", log.LstdFlags)
+	server.Log.Printf("servidor de FETRIS esperando en %s", ln.Addr())
+	log.Fatal(server.Serve(ln))
+}
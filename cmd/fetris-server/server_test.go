@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Efocor/FETRIS/engine"
+	"github.com/Efocor/FETRIS/netplay"
+)
+
+// .... Prueba de punta a punta: servidor y clientes sin pantalla ....
+// Levanta el servidor con un reloj que marca la prueba, conecta los clientes, les
+// hace armar una sala y jugar una partida entera, y revisa que todos hayan visto la
+// misma partida que el servidor. El dueño juega con el bot hasta el final; los demás
+// lo acompañan un rato y después solo dejan caer las piezas, así que tiene que ganar
+// él. Uno además hace trampa, y con más de dos jugadores otro se va a la mitad.
+
+// Desde este tick los demás solo dejan caer las piezas
+const testRushTick = 300
+
+// Tick en que se va el último cliente (con más de dos) y en que cambian de objetivo
+const (
+	testQuitTick   = 30
+	testTargetTick = 10
+)
+
+// Ticks que puede durar la partida antes de darla por colgada
+const testMaxTicks = 20000
+
+// Lo que se espera a la red para cada paso antes de darlo por perdido
+const testTimeout = 5 * time.Second
+
+// Un cliente de la prueba y su copia de la partida
+type testClient struct {
+	conn  *netplay.ServerConn
+	match *engine.Match
+	game  *netplay.ServerMatch
+	bot   bot
+	quit  bool
+}
+
+func TestServerRoom(t *testing.T) {
+	for _, players := range []int{2, 4, 8} {
+		t.Run(fmt.Sprintf("%d jugadores", players), func(t *testing.T) {
+			testServerRoom(t, players)
+		})
+	}
+}
+
+func testServerRoom(t *testing.T, players int) {
+	clock := make(chan time.Time)
+	server := netplay.NewServer(netplay.Setup{Config: engine.DefaultConfig()})
+	server.Clock = clock
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go server.Serve(ln)
+
+	//Todos se conectan; el primero crea la sala y el resto entra
+	conns := make([]*netplay.ServerConn, players)
+	for i := range conns {
+		c, err := netplay.DialServer(ln.Addr().String(), fmt.Sprintf("BOT %d", i+1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close("")
+		conns[i] = c
+	}
+	owner := conns[0]
+	owner.Create("PRUEBA")
+	waitFor(t, owner, "que se cree la sala", func() bool { return owner.Room != nil })
+	for _, c := range conns[1:] {
+		c.JoinRoom(owner.Room.ID)
+		waitFor(t, c, c.Name+" entre a la sala", func() bool { return c.Room != nil })
+	}
+	waitFor(t, owner, "que el dueño vea a todos", func() bool { return len(owner.Room.Players) == players })
+
+	//El tramposo no puede empezar, ni decir que ganó, ni apuntar a cualquier cosa
+	cheater := conns[1]
+	cheats := []struct {
+		what string
+		do   func() error
+	}{
+		{"empezar sin ser el dueño", cheater.Start},
+		{"decir que ganó", func() error { return cheater.Send(netplay.Message{Kind: netplay.KindEnd, Winner: 1}) }},
+		{"mandar un tick", func() error {
+			return cheater.Send(netplay.Message{Kind: netplay.KindFrame, Inputs: make([]engine.Input, players)})
+		}},
+		{"apuntar a un objetivo que no existe", func() error { return cheater.SetTarget(engine.NumTargets) }},
+	}
+	for _, cheat := range cheats {
+		cheater.Notice = ""
+		cheat.do()
+		waitFor(t, cheater, "que el servidor no deje "+cheat.what, func() bool { return cheater.Notice != "" })
+	}
+
+	//Cada cliente arma su copia de la partida con lo que mandó el servidor
+	if err := owner.Start(); err != nil {
+		t.Fatal(err)
+	}
+	clients := make([]*testClient, players)
+	for i, c := range conns {
+		start := waitStart(t, c)
+		engines := make([]*engine.Engine, len(start.Names))
+		for j := range engines {
+			engines[j] = engine.New()
+			start.Setup.Apply(engines[j])
+		}
+		m := engine.NewMatch(engines)
+		m.Start(start.Setup.Seed)
+		clients[i] = &testClient{conn: c, match: m, game: netplay.NewServerMatch(c, start, m)}
+	}
+
+	//Un tick a la vez: todos mandan su entrada, el servidor la recibe, se juega y vuelve a todos
+	quitter := -1
+	if players > 2 {
+		quitter = players - 1
+	}
+	over := false
+	for tick := 0; !over; tick++ {
+		if tick >= testMaxTicks {
+			t.Fatalf("la partida no terminó en %d ticks", testMaxTicks)
+		}
+
+		if tick == testQuitTick && quitter >= 0 {
+			clients[quitter].game.Close()
+			clients[quitter].quit = true
+			//Cuando el dueño ve la sala sin él, el servidor ya sabe que se fue
+			waitGame(t, clients[0], "la sala sin el último", func() bool { return len(owner.Room.Players) == players-1 })
+		}
+
+		for i, cl := range clients {
+			if cl.quit {
+				continue
+			}
+			if tick == testTargetTick {
+				cl.conn.SetTarget(engine.TargetKind(i) % engine.NumTargets)
+			}
+			in := cl.bot.input(cl.match.Players[i])
+			if i != 0 && tick >= testRushTick {
+				in = engine.InputHardDrop
+			}
+			update(t, cl, in)
+
+			//La lista de salas vuelve después de la entrada: con ella el servidor ya la tiene
+			cl.conn.Rooms = nil
+			cl.conn.Refresh()
+		}
+		for _, cl := range clients {
+			if !cl.quit {
+				waitGame(t, cl, "la lista de salas", func() bool { return cl.conn.Rooms != nil })
+			}
+		}
+
+		select {
+		case clock <- time.Now():
+		case <-time.After(testTimeout):
+			t.Fatalf("el servidor no jugó el tick %d", tick)
+		}
+
+		//Todos juegan el tick que mandó el servidor, y si con él terminó, también el final
+		for _, cl := range clients {
+			if !cl.quit {
+				waitGame(t, cl, fmt.Sprintf("el tick %d", tick), func() bool { return cl.game.Tick > tick })
+				over = over || cl.match.Over
+			}
+		}
+		if over {
+			for _, cl := range clients {
+				if !cl.quit {
+					waitGame(t, cl, "el final", cl.game.Over)
+				}
+			}
+		}
+
+		if tick == testTargetTick {
+			for _, cl := range clients {
+				for j, target := range cl.match.Targeting {
+					if want := engine.TargetKind(j) % engine.NumTargets; target != want {
+						t.Fatalf("%s ve a %s apuntando a %d, eligió %d", cl.conn.Name, conns[j].Name, target, want)
+					}
+				}
+			}
+		}
+	}
+
+	//Todos los que se quedaron tienen que haber visto lo mismo, y lo que decidió el servidor
+	first := clients[0]
+	for _, cl := range clients[1:] {
+		if cl.quit {
+			continue
+		}
+		if cl.game.Tick != first.game.Tick || cl.match.Winner != first.match.Winner || cl.match.Hash() != first.match.Hash() {
+			t.Fatalf("%s terminó en el tick %d con ganador %d, %s en el %d con ganador %d",
+				cl.conn.Name, cl.game.Tick, cl.match.Winner, first.conn.Name, first.game.Tick, first.match.Winner)
+		}
+	}
+	if first.match.Winner != 0 {
+		t.Fatalf("tenía que ganar %s, que siguió jugando, y el ganador fue %d", owner.Name, first.match.Winner)
+	}
+	var sent []int
+	for _, p := range first.match.Players {
+		sent = append(sent, p.Sent)
+	}
+	t.Logf("%d ticks, ganó %s; filas mandadas %v", first.game.Tick, owner.Name, sent)
+
+	//Después de la partida la sala vuelve a esperar
+	waitFor(t, owner, "que la sala vuelva a esperar", func() bool { return owner.Room != nil && !owner.Room.Playing })
+}
+
+// Manda la entrada del cliente y lee lo que llegó
+func update(t *testing.T, cl *testClient, in engine.Input) {
+	t.Helper()
+	if _, err := cl.game.Update(in); err != nil {
+		t.Fatalf("%s: %v", cl.conn.Name, err)
+	}
+}
+
+// Lee lo que manda el servidor durante la partida hasta que se cumple ok
+func waitGame(t *testing.T, cl *testClient, what string, ok func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for !ok() {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s no recibió %s", cl.conn.Name, what)
+		}
+		time.Sleep(time.Millisecond)
+		update(t, cl, 0)
+	}
+}
+
+// Lee lo que manda el servidor fuera de la partida hasta que se cumple ok
+func waitFor(t *testing.T, c *netplay.ServerConn, what string, ok func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for !ok() {
+		if time.Now().After(deadline) {
+			t.Fatalf("se acabó el tiempo esperando %s", what)
+		}
+		time.Sleep(time.Millisecond)
+		if _, err := c.Update(); err != nil {
+			t.Fatalf("%s: %v", c.Name, err)
+		}
+	}
+}
+
+// Espera el inicio de la partida
+func waitStart(t *testing.T, c *netplay.ServerConn) *netplay.ServerStart {
+	t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for time.Now().Before(deadline) {
+		start, err := c.Update()
+		if err != nil {
+			t.Fatalf("%s: %v", c.Name, err)
+		}
+		if start != nil {
+			return start
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%s no recibió el inicio", c.Name)
+	return nil
+}
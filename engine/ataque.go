@@ -0,0 +1,67 @@
+package engine
+
+// .... Ataques del versus: filas de basura que manda cada premio ....
+// Lo que se manda primero cancela la basura pendiente propia; lo que sobra
+// queda en Engine.Outgoing para el rival.
+type AttackTable struct {
+	Lines        [6]int //Líneas normales, por cantidad (la 5 vale para 5 o más)
+	TSpin        [4]int //T-spin con 0 a 3 líneas
+	TSpinMini    [3]int //T-spin mini con 0 a 2 líneas
+	PerfectClear int    //Además de las líneas
+	Combo        []int  //Por paso del combo, como Award.Combo (el último vale para los siguientes)
+	BackToBack   int    //Extra por una línea difícil seguida de otra
+}
+
+var attackTable = AttackTable{
+	Lines:        [6]int{0, 0, 1, 2, 4, 5},
+	TSpin:        [4]int{0, 2, 4, 6},
+	TSpinMini:    [3]int{0, 0, 1},
+	PerfectClear: 10,
+	Combo:        []int{0, 1, 1, 2, 2, 3, 3, 4, 4, 4, 5},
+	BackToBack:   1,
+}
+
+// .... Filas que mandan los premios de un lock ....
+func (t AttackTable) Rows(awards []Award) int {
+	rows := 0
+	for _, a := range awards {
+		switch a.Kind {
+		case AwardLines:
+			rows += t.Lines[capped(a.Lines, len(t.Lines))]
+		case AwardTSpin:
+			rows += t.TSpin[capped(a.Lines, len(t.TSpin))]
+		case AwardTSpinMini:
+			rows += t.TSpinMini[capped(a.Lines, len(t.TSpinMini))]
+		case AwardCombo:
+			rows += t.Combo[capped(a.Combo, len(t.Combo))]
+		case AwardPerfectClear:
+			rows += t.PerfectClear
+		}
+		if a.BackToBack {
+			rows += t.BackToBack
+		}
+	}
+	return rows
+}
+
+// .... Las líneas hechas contra la basura pendiente ....
+// Fuera del versus cada línea cancela una fila; en versus cancela el ataque
+// de los premios, y lo que sobra se manda.
+func (e *Engine) counterGarbage(lines int, awards []Award) {
+	if !e.ModeRules().Versus {
+		e.cancelGarbage(lines)
+		return
+	}
+
+	attack := attackTable.Rows(awards)
+	canceled := attack
+	if canceled > e.PendingGarbage {
+		canceled = e.PendingGarbage
+	}
+	e.cancelGarbage(canceled)
+	if sent := attack - canceled; sent > 0 {
+		e.Outgoing += sent
+		e.Sent += sent
+		e.emit(EventAttack)
+	}
+}
@@ -0,0 +1,138 @@
+package engine
+
+// .... Basura: filas con un hueco que suben desde abajo ....
+// Primero quedan pendientes (se ven en el medidor) y entran cuando se lockea una
+// pieza que no hizo líneas. Cada línea hecha cancela una fila pendiente. En la
+// invasión, lo que siga pendiente cuando llega la fila siguiente sube solo.
+
+// .... Dónde va el hueco de las filas de basura ....
+type HoleKind int
+
+const (
+	HoleClean  HoleKind = iota //Todas las filas con el hueco en la misma columna, se puede cavar un pozo
+	HoleMessy                  //Cada fila con el hueco en cualquier columna
+	HoleRandom                 //El hueco suele seguir en su columna, pero a veces se corre
+)
+
+// Probabilidad de que el hueco se corra en HoleRandom
+const holeMoveChance = 0.3
+
+// .... Agrega filas de basura pendientes (la invasión, o los ataques del rival) ....
+func (e *Engine) AddGarbage(rows int) {
+	//No más que el alto del tablero, para que el medidor no crezca sin fin
+	e.PendingGarbage += rows
+	if e.PendingGarbage > e.Height() {
+		e.PendingGarbage = e.Height()
+	}
+}
+
+// Cada línea hecha cancela una fila pendiente
+func (e *Engine) cancelGarbage(lines int) {
+	e.PendingGarbage -= lines
+	if e.PendingGarbage < 0 {
+		e.PendingGarbage = 0
+	}
+}
+
+// .... Un tick de la invasión: cada cierto tiempo llega otra fila ....
+// La fila nueva queda pendiente un intervalo entero, así se puede cancelar con líneas.
+func (e *Engine) tickGarbage() {
+	if !e.ModeRules().Invasion {
+		return
+	}
+	if e.garbageTimer < e.garbageInterval() {
+		e.garbageTimer++
+	}
+	//Con líneas limpiándose la fila espera a que el tablero termine de bajar
+	if e.garbageTimer < e.garbageInterval() || e.Clearing() {
+		return
+	}
+	e.garbageTimer = 0
+
+	//Lo que quedó de la fila anterior ya tuvo su tiempo: sube sin esperar un lock
+	if e.PendingGarbage > 0 {
+		e.riseGarbage()
+
+		//La basura empuja hacia arriba a la pieza que cae
+		for !e.Over && !e.canMove(0, 0) {
+			e.FallingY--
+		}
+		if e.Over {
+			return
+		}
+	}
+	e.AddGarbage(1)
+}
+
+// Ticks entre filas de la invasión: cada nivel un 10% menos, hasta un cuarto del inicial
+func (e *Engine) garbageInterval() int {
+	base := e.Config.GarbageInterval
+	interval := base - (e.Level-1)*base/10
+	if interval < base/4 {
+		interval = base / 4
+	}
+	if interval < 1 {
+		interval = 1
+	}
+	return interval
+}
+
+// .... Ticks que faltan para la siguiente fila de la invasión ....
+func (e *Engine) GarbageCountdown() int {
+	return e.garbageInterval() - e.garbageTimer
+}
+
+// .... Sube las filas pendientes por abajo del tablero ....
+func (e *Engine) riseGarbage() {
+	rows := e.PendingGarbage
+	if rows == 0 {
+		return
+	}
+	e.PendingGarbage = 0
+
+	//Lo que quede arriba del tablero al subir es un top out
+	width, height := e.Width(), e.Height()
+	toppedOut := false
+	for y := 0; y < rows && y < height; y++ {
+		for x := 0; x < width; x++ {
+			if !e.Grid[y][x].Empty() {
+				toppedOut = true
+			}
+		}
+	}
+	for y := 0; y < height-rows; y++ {
+		e.Grid[y] = e.Grid[y+rows]
+	}
+
+	//Las filas de abajo son nuevas, las de antes siguen más arriba
+	for y := height - rows; y < height; y++ {
+		if y < 0 {
+			continue
+		}
+		hole := e.nextHole()
+		e.Grid[y] = make([]Cell, width)
+		for x := 0; x < width; x++ {
+			if x != hole {
+				e.Grid[y][x] = Cell{Piece: GarbagePiece, LockedAt: e.Ticks, Flags: CellGarbage}
+			}
+		}
+	}
+	e.emit(EventGarbage)
+
+	if toppedOut {
+		e.topOut()
+	}
+}
+
+// Columna del hueco de la siguiente fila de basura
+func (e *Engine) nextHole() int {
+	switch e.Config.GarbageHoles {
+	case HoleMessy:
+		e.garbageHole = e.garbageRNG.Intn(e.Width())
+	case HoleRandom:
+		if e.garbageRNG.Float64() < holeMoveChance {
+			e.garbageHole = e.garbageRNG.Intn(e.Width())
+		}
+	}
+	return e.garbageHole
+}
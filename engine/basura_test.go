@@ -0,0 +1,98 @@
+package engine
+
+import "testing"
+
+// Motor de invasión con la pieza ya apoyada en el fondo
+func newInvasionTest(t *testing.T) *Engine {
+	t.Helper()
+	e := New()
+	e.Config.Mode = ModeInvasion
+	e.Config.LineClearDelay = 0
+	e.Config.GarbageInterval = 30
+	e.Start(1)
+	placeTest(t, e, "O")
+	return e
+}
+
+// Avanza sin tocar nada hasta que vence el tiempo de la invasión
+func fireGarbage(e *Engine) []Event {
+	e.garbageTimer = e.garbageInterval() - 1
+	return e.Step(0)
+}
+
+// Celdas de basura de la fila y
+func garbageCells(e *Engine, y int) int {
+	n := 0
+	for _, cell := range e.Grid[y] {
+		if cell.Has(CellGarbage) {
+			n++
+		}
+	}
+	return n
+}
+
+// .... La fila queda pendiente y, si nadie la cancela, sube sola con la siguiente ....
+func TestInvasionRise(t *testing.T) {
+	e := newInvasionTest(t)
+	bottom := e.Height() - 1
+
+	if events := fireGarbage(e); e.PendingGarbage != 1 || hasEvent(events, EventGarbage) {
+		t.Fatalf("al vencer el tiempo quedaron %d filas pendientes y subió basura: %v", e.PendingGarbage, events)
+	}
+	if garbageCells(e, bottom) != 0 {
+		t.Fatal("la fila subió sin esperar")
+	}
+
+	//La pieza apoyada en el fondo: la fila que sube tiene que empujarla
+	e.FallingY += e.DropDistance()
+	if events := fireGarbage(e); !hasEvent(events, EventGarbage) {
+		t.Fatalf("la fila pendiente no subió con la siguiente: %v", events)
+	}
+	if e.Locks != 0 {
+		t.Fatalf("se lockearon %d piezas esperando la fila", e.Locks)
+	}
+	if garbageCells(e, bottom) != e.Width()-1 || garbageCells(e, bottom-1) != 0 {
+		t.Fatalf("subieron %d y %d celdas de basura, tenía que ser una fila", garbageCells(e, bottom), garbageCells(e, bottom-1))
+	}
+	if e.PendingGarbage != 1 {
+		t.Fatalf("la fila nueva no quedó pendiente: %d", e.PendingGarbage)
+	}
+	if !e.canMove(0, 0) {
+		t.Fatalf("la basura quedó encima de la pieza: %v", e.FallingBlocks())
+	}
+}
+
+// .... Una línea hecha a tiempo cancela la fila de la invasión ....
+func TestGarbageCancel(t *testing.T) {
+	e := newInvasionTest(t)
+	fireGarbage(e)
+
+	cols := fallingColumns(e)
+	bottom := e.Height() - 1
+	fillRow(e, bottom, cols...)
+	e.Step(InputHardDrop)
+	if e.Lines != 1 || e.PendingGarbage != 0 {
+		t.Fatalf("con %d líneas quedaron %d filas pendientes", e.Lines, e.PendingGarbage)
+	}
+
+	if events := fireGarbage(e); hasEvent(events, EventGarbage) {
+		t.Fatal("subió basura que ya se había cancelado")
+	}
+	for y := 0; y < e.Height(); y++ {
+		if garbageCells(e, y) != 0 {
+			t.Fatalf("quedó basura en la fila %d", y)
+		}
+	}
+}
+
+// .... Un lock sin líneas sube la fila pendiente sin esperar ....
+func TestGarbageLock(t *testing.T) {
+	e := newInvasionTest(t)
+	fireGarbage(e)
+	if events := e.Step(InputHardDrop); !hasEvent(events, EventGarbage) {
+		t.Fatalf("el lock sin líneas no subió la fila pendiente: %v", events)
+	}
+	if e.PendingGarbage != 0 || garbageCells(e, e.Height()-1) != e.Width()-1 {
+		t.Fatalf("quedaron %d filas pendientes y %d celdas de basura abajo", e.PendingGarbage, garbageCells(e, e.Height()-1))
+	}
+}
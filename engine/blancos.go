@@ -0,0 +1,63 @@
+package engine
+
+// .... A quién le manda basura cada jugador del versus ....
+// De a dos da lo mismo; con más jugadores (todos contra todos) cada uno elige.
+type TargetKind int
+
+const (
+	TargetNext     TargetKind = iota //Al siguiente que siga vivo, en orden
+	TargetRandom                     //A cualquiera, al azar en cada ataque
+	TargetAttacker                   //Al último que le mandó basura (si no hay, al azar)
+	TargetLeader                     //Al que más basura ha mandado
+	NumTargets
+)
+
+// .... A quién le llega la basura del jugador i, -1 si no queda nadie ....
+func (m *Match) target(i int) int {
+	var rivals []int
+	for n := 1; n < len(m.Players); n++ {
+		t := (i + n) % len(m.Players)
+		if !m.Players[t].Over {
+			rivals = append(rivals, t)
+		}
+	}
+	if len(rivals) == 0 {
+		return -1
+	}
+
+	switch m.Targeting[i] {
+	case TargetRandom:
+		return rivals[m.rng.Intn(len(rivals))]
+	case TargetAttacker:
+		if a := m.attackers[i]; a >= 0 && !m.Players[a].Over {
+			return a
+		}
+		return rivals[m.rng.Intn(len(rivals))]
+	case TargetLeader:
+		leader := rivals[0]
+		for _, t := range rivals[1:] {
+			if m.Players[t].Sent > m.Players[leader].Sent {
+				leader = t
+			}
+		}
+		return leader
+	}
+	return rivals[0]
+}
+
+// .... Cambia a quién le manda basura el jugador i ....
+func (m *Match) SetTarget(i int, kind TargetKind) {
+	if kind < 0 || kind >= NumTargets {
+		kind = TargetNext
+	}
+	m.Targeting[i] = kind
+}
+
+// .... El jugador i se rinde (o se fue): pierde en este tick ....
+func (m *Match) Forfeit(i int) {
+	if m.Over || m.Players[i].Over {
+		return
+	}
+	m.Players[i].gameOver()
+	m.checkOver()
+}
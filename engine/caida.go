@@ -0,0 +1,154 @@
+package engine
+
+// .... Velocidad de caída de la pieza ....
+// La gravedad son filas por tick, contadas en 1/GravityUnit de fila para que las
+// velocidades lentas sean fracciones y todo siga siendo entero (los replays y las
+// partidas en red tienen que dar lo mismo en cualquier máquina). Cada tick se suma
+// la gravedad y la pieza baja las filas enteras que se juntaron.
+const (
+	GravityUnit = 65536            //1G: una fila por tick
+	Gravity20G  = 20 * GravityUnit //La pieza aparece ya apoyada en el fondo
+)
+
+// Gravedad de una fila cada tantos ticks (redondeada hacia arriba, así no tarda un tick de más)
+func rowEvery(ticks int) int {
+	return (GravityUnit + ticks - 1) / ticks
+}
+
+// .... Curva de velocidad: la gravedad de cada nivel ....
+type CurveKind int
+
+const (
+	CurveClassic   CurveKind = iota //La de siempre de FETRIS hasta el nivel 10, y de ahí sigue hasta 20G
+	CurveGuideline                  //La de la guía moderna: (0.8-(nivel-1)*0.007)^(nivel-1) segundos por fila
+	Curve20G                        //20G desde el primer nivel
+)
+
+// .... Un tramo de la curva: desde Level en adelante la gravedad es Gravity ....
+type CurveStep struct {
+	Level   int
+	Gravity int //En 1/GravityUnit de fila por tick
+}
+
+var gravityCurves = map[CurveKind][]CurveStep{
+	CurveClassic: {
+		{1, rowEvery(60)},
+		{2, rowEvery(48)},
+		{3, rowEvery(42)},
+		{4, rowEvery(36)},
+		{5, rowEvery(30)},
+		{6, rowEvery(24)},
+		{7, rowEvery(18)},
+		{8, rowEvery(12)},
+		{9, rowEvery(6)},
+		{10, rowEvery(5)},
+		{11, rowEvery(4)},
+		{12, rowEvery(3)},
+		{13, rowEvery(2)},
+		{14, GravityUnit},
+		{15, 2 * GravityUnit},
+		{16, 3 * GravityUnit},
+		{17, 5 * GravityUnit},
+		{18, 10 * GravityUnit},
+		{19, Gravity20G},
+	},
+	//Sale de la fórmula, redondeada a 1/GravityUnit
+	CurveGuideline: {
+		{1, 1092},    //60 ticks por fila
+		{2, 1377},    //47.6
+		{3, 1768},    //37.1
+		{4, 2311},    //28.4
+		{5, 3075},    //21.3
+		{6, 4169},    //15.7
+		{7, 5759},    //11.4
+		{8, 8107},    //8.1
+		{9, 11634},   //5.6
+		{10, 17026},  //3.8
+		{11, 25416},  //2.6
+		{12, 38709},  //1.7
+		{13, 60169},  //1.1
+		{14, 95483},  //1.5G
+		{15, 154742}, //2.4G
+		{16, 256187}, //3.9G
+		{17, 433425}, //6.6G
+		{18, 749597}, //11.4G
+		{19, Gravity20G},
+	},
+	Curve20G: {
+		{1, Gravity20G},
+	},
+}
+
+// Curva de velocidad de la partida (los valores fuera de la tabla juegan con la clásica)
+func (e *Engine) gravityCurve() []CurveStep {
+	if curve, ok := gravityCurves[e.Config.Curve]; ok {
+		return curve
+	}
+	return gravityCurves[CurveClassic]
+}
+
+// .... Gravedad del nivel actual: la del último tramo que ya empezó ....
+func (e *Engine) levelGravity() int {
+	curve := e.gravityCurve()
+	gravity := curve[0].Gravity
+	for _, step := range curve {
+		if step.Level <= e.Level {
+			gravity = step.Gravity
+		}
+	}
+	return gravity
+}
+
+// .... Gravedad con la caída rápida apretada ....
+// Config.SoftDrop multiplica la del nivel; 0 baja la pieza de una, sin lockearla.
+func (e *Engine) softDropGravity() int {
+	if e.Config.SoftDrop <= 0 || e.Gravity >= Gravity20G/e.Config.SoftDrop {
+		return Gravity20G
+	}
+	return e.Gravity * e.Config.SoftDrop
+}
+
+// .... Baja la pieza lo que le toque este tick; devuelve true si la lockeó ....
+func (e *Engine) fall(in Input) bool {
+	gravity := e.Gravity
+	if in.Has(InputSoftDrop) {
+		gravity = e.softDropGravity()
+	}
+
+	e.fallAccum += gravity
+	rows := e.fallAccum / GravityUnit
+	e.fallAccum %= GravityUnit
+	if rows == 0 {
+		return false
+	}
+
+	moved := 0
+	for moved < rows && e.canMove(0, 1) {
+		e.FallingY++
+		moved++
+	}
+	if moved > 0 {
+		e.lastRotated = false
+		e.pieceDescended()
+		if in.Has(InputSoftDrop) {
+			e.Score += moved * e.scoreTable().SoftDrop
+		}
+		return false
+	}
+
+	//Sin lock delay se lockea en el paso de gravedad, como el FETRIS clásico
+	if e.Config.LockDelay == 0 {
+		e.lockAndSpawn()
+		return true
+	}
+	return false
+}
+
+// .... Con 20G la pieza nueva baja al fondo apenas aparece ....
+func (e *Engine) dropOnSpawn() {
+	if e.Gravity < Gravity20G {
+		return
+	}
+	e.FallingY += e.DropDistance()
+	e.lowestY = e.FallingY
+}
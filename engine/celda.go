@@ -0,0 +1,50 @@
+package engine
+
+// .... Marca de una pieza especial, la misma que se dibuja encima del bloque ....
+type Mark uint8
+
+const (
+	MarkNone     Mark = iota //Pieza normal
+	MarkStar                 //Estrella
+	MarkCircle               //Círculo
+	MarkTriangle             //Triángulo
+	numMarks
+)
+
+var markNames = [numMarks]string{"", "star", "circle", "triangle"}
+
+// Nombre de la marca, el mismo de la imagen en componentes/ (vacío si no tiene)
+func (m Mark) String() string {
+	if m >= numMarks {
+		return ""
+	}
+	return markNames[m]
+}
+
+// .... Estados extra de una celda ....
+type CellFlags uint8
+
+const (
+	CellGarbage CellFlags = 1 << iota //La celda no vino de una pieza (basura, tableros armados)
+)
+
+// Id de pieza de las celdas de basura: no es de ninguna pieza del set, pero no está vacía
+const GarbagePiece = -1
+
+// .... Una celda del tablero ....
+type Cell struct {
+	Piece    int       //Id de la pieza que la dejó, 0 = vacía
+	Mark     Mark      //Marca especial que traía la pieza
+	LockedAt int       //Tick en que se lockeó
+	Flags    CellFlags //Estados extra
+}
+
+// ¿Está vacía?
+func (c Cell) Empty() bool {
+	return c.Piece == 0
+}
+
+// ¿Tiene el estado pedido?
+func (c Cell) Has(flag CellFlags) bool {
+	return c.Flags&flag != 0
+}
@@ -0,0 +1,67 @@
+package engine
+
+// .... Cómo se reinicia el lock delay al mover o rotar ....
+type LockReset int
+
+const (
+	LockResetMove     LockReset = iota //Mover o rotar reinicia el tiempo, con un tope de reinicios
+	LockResetStep                      //Solo se reinicia cuando la pieza baja a una fila nueva
+	LockResetInfinite                  //Mover o rotar siempre reinicia el tiempo
+)
+
+// .... Reglas configurables de la partida ....
+type Config struct {
+	LockDelay     int       //Ticks que aguanta la pieza apoyada antes de lockearse, 0 = clásico (se lockea en el paso de gravedad)
+	LockReset     LockReset //Variante de reinicio del lock delay
+	MaxLockResets int       //Tope de reinicios por fila en LockResetMove
+
+	Randomizer     RandomizerKind //Cómo se eligen las piezas de la cola
+	BagCopies      int            //Copias de cada pieza por bolsa en RandomizerBag
+	HistorySize    int            //Piezas que recuerda RandomizerHistory
+	HistoryRerolls int            //Intentos para esquivar el historial
+
+	Scoring ScoringKind //Tabla de puntaje
+
+	LineClearDelay int         //Ticks que tardan en irse las líneas completas, 0 = al instante
+	Gravity        GravityKind //Cómo baja el tablero después de limpiar
+
+	Mode      ModeKind //Modo de juego
+	UltraTime int      //Segundos de una partida de ultra
+
+	GarbageHoles    HoleKind //Dónde va el hueco de las filas de basura
+	GarbageInterval int      //Ticks entre filas de la invasión en el nivel 1
+
+	Width  int //Columnas del tablero, 0 = GridWidth
+	Height int //Filas del tablero, 0 = GridHeight
+
+	Curve    CurveKind //Curva de velocidad de caída por nivel
+	SoftDrop int       //La caída rápida multiplica la gravedad por esto, 0 = baja de una sin lockear
+}
+
+// .... Reglas por defecto de FETRIS ....
+func DefaultConfig() Config {
+	return Config{
+		LockDelay:     0,
+		LockReset:     LockResetMove,
+		MaxLockResets: 15,
+
+		Randomizer:     RandomizerPure,
+		BagCopies:      1,
+		HistorySize:    4,
+		HistoryRerolls: 4,
+
+		Scoring: ScoringClassic,
+
+		LineClearDelay: 20,
+		Gravity:        GravityNaive,
+
+		Mode:      ModeFetris,
+		UltraTime: 120,
+
+		GarbageHoles:    HoleClean,
+		GarbageInterval: 8 * TPS,
+
+		Curve:    CurveClassic,
+		SoftDrop: 20,
+	}
+}
@@ -0,0 +1,77 @@
+package engine
+
+// .... Copias del estado de la partida ....
+// Sirven para volver atrás y jugar de nuevo desde un tick (el rollback de la red).
+// Las piezas, los niveles y el puzzle no cambian durante la partida, así que la
+// copia los comparte; todo lo demás es propio.
+
+// .... Copia completa del motor ....
+func (e *Engine) Clone() *Engine {
+	c := *e
+	c.Grid = make([][]Cell, len(e.Grid))
+	for y, row := range e.Grid {
+		c.Grid[y] = append([]Cell(nil), row...)
+	}
+	c.Awards = append([]Award(nil), e.Awards...)
+	c.Cleared = append([]ClearedRow(nil), e.Cleared...)
+	c.clearingRows = append([]int(nil), e.clearingRows...)
+	c.events = nil
+	if e.randomizer != nil {
+		c.randomizer = e.randomizer.Clone()
+	}
+	return &c
+}
+
+// .... Vuelve el motor al estado de una copia, que sigue sirviendo para volver otra vez ....
+func (e *Engine) Restore(from *Engine) {
+	*e = *from.Clone()
+}
+
+// .... Estado de todo el versus en un tick ....
+type MatchState struct {
+	players   []*Engine
+	targeting []TargetKind
+	attackers []int
+	rng       RNG
+	winner    int
+	over      bool
+}
+
+// .... Guarda el estado del versus ....
+func (m *Match) Save() *MatchState {
+	s := &MatchState{
+		targeting: append([]TargetKind(nil), m.Targeting...),
+		attackers: append([]int(nil), m.attackers...),
+		rng:       m.rng,
+		winner:    m.Winner,
+		over:      m.Over,
+	}
+	for _, p := range m.Players {
+		s.players = append(s.players, p.Clone())
+	}
+	return s
+}
+
+// .... Huella del versus guardado, la misma que daría Match.Hash en ese tick ....
+func (s *MatchState) Hash() uint64 {
+	m := Match{Players: s.players, Targeting: s.targeting, attackers: s.attackers, rng: s.rng}
+	return m.Hash()
+}
+
+// .... Filas que mandó un jugador en el tick guardado ....
+func (s *MatchState) Outgoing(player int) int {
+	return s.players[player].Outgoing
+}
+
+// .... Vuelve el versus a un estado guardado ....
+// Los motores siguen siendo los mismos (quien los dibuja no se entera), solo cambia lo que tienen.
+func (m *Match) Load(s *MatchState) {
+	for i, p := range m.Players {
+		p.Restore(s.players[i])
+	}
+	copy(m.Targeting, s.targeting)
+	copy(m.attackers, s.attackers)
+	m.rng = s.rng
+	m.Winner = s.winner
+	m.Over = s.over
+}
@@ -0,0 +1,389 @@
+/*
+Paquete engine: las reglas de FETRIS sin ventana, sin audio y sin teclado.
+
+El motor guarda el tablero, la pieza que cae, la cola de piezas, el puntaje y el nivel,
+y avanza un tick a la vez a partir de un Input. Quien lo use (la ventana de Ebiten, un
+script o un test) solo tiene que traducir sus teclas a Input y reaccionar a los Event
+que devuelve cada paso (sonidos, mensajes, música).
+*/
+package engine
+
+// ....Constantes de las reglas....
+const (
+	GridWidth             = 10 //Medidas por defecto del tablero, la configuración puede pedir otras
+	GridHeight            = 17
+	ProbabiliSpecialPiece = 0.2
+	LevelTimeLimitSeconds = 122 // 2 minutos por nivel
+	NumPreview            = 3
+	TPS                   = 60 // Ticks por segundo, los mismos de Ebiten: todo el tiempo del juego se cuenta en ticks
+)
+
+// .... Entrada de un tick ....
+// Left, Right y SoftDrop se marcan mientras la tecla esté apretada.
+// HardDrop, Hold y las rotaciones son de un toque: solo van en el tick en que se presionó la tecla.
+type Input uint8
+
+const (
+	InputLeft Input = 1 << iota
+	InputRight
+	InputSoftDrop
+	InputHardDrop
+	InputRotate //Horario
+	InputRotateCCW
+	InputRotate180
+	InputHold
+)
+
+// Has dice si la acción viene marcada en la entrada
+func (in Input) Has(action Input) bool {
+	return in&action != 0
+}
+
+// .... Eventos que el motor le avisa a quien lo dibuja ....
+type Event int
+
+const (
+	EventLock     Event = iota //Se lockeó una pieza
+	EventSpecial               //La pieza lockeada era especial
+	EventMatch                 //Se limpiaron líneas
+	EventLevelUp               //Se pasó de nivel
+	EventGameOver              //Se acabó la partida
+	EventHold                  //Se guardó la pieza en el hold
+	EventAward                 //Un premio de puntaje, en orden en Awards (uno por evento)
+	EventTopOut                //El tablero se llenó y se vació (zen)
+	EventGarbage               //Subieron filas de basura
+	EventAttack                //Se mandó basura al rival, está en Outgoing
+)
+
+// .... Estado completo de una partida ....
+type Engine struct {
+	Grid            [][]Cell //Filas de arriba a abajo, se arma en Start con las medidas de la configuración
+	FallingX        int
+	FallingY        int
+	FallingCol      int
+	FallingSpecial  Mark //Marca de la pieza que cae, MarkNone si es normal
+	FallingRotation int
+	Score           int
+	Level           int
+	Gravity         int //Filas por tick que baja la pieza, en 1/GravityUnit de fila (sale de la curva de velocidad)
+	Timer           int
+	TimeLimit       int              //Segundos por nivel cuando la tabla no dice otra cosa
+	LevelLines      int              //Líneas hechas en el nivel actual
+	Lines           int              //Líneas hechas en toda la partida
+	Locks           int              //Piezas lockeadas en toda la partida
+	PendingGarbage  int              //Filas de basura que entran con el próximo lock sin líneas
+	Outgoing        int              //Filas de basura que se mandan al rival en este tick (versus)
+	Sent            int              //Filas de basura mandadas en toda la partida
+	LevelSpecials   int              //Piezas especiales lockeadas en el nivel actual
+	NextPieces      [NumPreview]int  //almacena 3 piezas spawneadas
+	NextSpecial     [NumPreview]Mark //almacena si las siguientes piezas son especiales (y su marca)
+	HeldPiece       int              //Pieza guardada en el hold, 0 si está vacío
+	HeldSpecial     Mark             //La pieza guardada mantiene su marca especial
+	Ticks           int              //Ticks jugados en la partida
+	Combo           int              //Piezas seguidas haciendo líneas, -1 sin combo
+	BackToBack      bool             //La última línea fue difícil (tetris o T-spin)
+	Awards          []Award          //Premios de este tick
+	Cleared         []ClearedRow     //Filas de la última limpieza, con sus celdas (para la animación)
+	Seed            int64            //Semilla de la partida: la misma semilla da las mismas piezas
+	Over            bool
+	Finished        bool        //La partida terminó cumpliendo la meta del modo, no perdiendo
+	Pieces          *PieceSet   //Set de piezas activo
+	Levels          *LevelTable //Objetivos de cada nivel
+	Puzzle          *Puzzle     //Puzzle que se juega en el modo puzzle
+	Config          Config      //Reglas configurables (lock delay, etc.)
+
+	fallAccum       int   //Gravedad juntada que todavía no alcanza una fila
+	timerTicks      int   //Ticks desde el último segundo descontado
+	levelStartScore int   //Puntaje al empezar el nivel, para el objetivo de puntaje
+	holdUsed        bool  //Ya se usó el hold con esta pieza
+	lastRotated     bool  //Lo último que hizo la pieza fue rotar (para los T-spin)
+	lastKick        int   //Kick de la tabla JLSTZ que usó la última rotación, -1 si fue otra tabla o media vuelta
+	clearTimer      int   //Ticks que le quedan a la limpieza de líneas, 0 si no hay
+	clearingRows    []int //Filas que se están limpiando
+	clearedTick     int   //Tick de la última limpieza, para juntar las de una cadena
+	bufferedInput   Input //Acciones guardadas durante la limpieza
+	puzzleNext      int   //Siguiente pieza de la cola del puzzle
+	garbageTimer    int   //Ticks desde la última fila de la invasión
+	garbageHole     int   //Columna del hueco de la última fila de basura
+	randomizer      Randomizer
+	rng             RNG
+	garbageRNG      RNG //Los huecos de la basura tienen su propio azar, así no cambian las piezas
+	//.... Lock delay ....
+	lockTimer  int
+	lockResets int
+	lowestY    int
+	//.... Pal movimiento de las piezas ....
+	moveDelayCounter int
+	moveDelay        int
+	initialMoveDelay int
+	keyHeldFrames    int
+	lastMoveDir      int
+
+	events []Event
+}
+
+// .... Crea un motor listo para llamar Start ....
+func New() *Engine {
+	return &Engine{
+		Grid:             newGrid(GridWidth, GridHeight),
+		Level:            1,
+		TimeLimit:        LevelTimeLimitSeconds,
+		Pieces:           DefaultPieces,
+		Levels:           DefaultLevels,
+		Config:           DefaultConfig(),
+		moveDelay:        4,
+		initialMoveDelay: 10,
+	}
+}
+
+// .... Reinicia todo para una partida nueva con la semilla dada ....
+func (e *Engine) Start(seed int64) []Event {
+	e.events = e.events[:0]
+	e.Seed = seed
+	e.rng = NewRNG(seed)
+	e.garbageRNG = NewRNG(^seed)
+	width, height := e.Config.BoardSize()
+	if e.puzzling() {
+		//El puzzle trae su propio ancho
+		width = e.Puzzle.Width()
+	}
+	e.Grid = newGrid(width, height)
+	e.Score = 0
+	e.Level = 1
+	e.Gravity = e.levelGravity()
+	e.Over = false
+	e.Finished = false
+	e.Lines = 0
+	e.Locks = 0
+	e.PendingGarbage = 0
+	e.Outgoing = 0
+	e.Sent = 0
+	e.garbageTimer = 0
+	e.garbageHole = e.garbageRNG.Intn(width)
+	e.HeldPiece = 0
+	e.HeldSpecial = MarkNone
+	e.holdUsed = false
+	e.Combo = -1
+	e.BackToBack = false
+	e.Awards = e.Awards[:0]
+	e.Cleared = e.Cleared[:0]
+	e.clearTimer = 0
+	e.clearingRows = e.clearingRows[:0]
+	e.clearedTick = 0
+	e.bufferedInput = 0
+	e.fallAccum = 0
+	e.Ticks = 0
+	e.timerTicks = 0
+	e.moveDelayCounter = 0
+	e.keyHeldFrames = 0
+	e.lastMoveDir = 0
+	config := e.Config
+	if e.ModeRules().Bag {
+		config.Randomizer = RandomizerBag
+	}
+	e.randomizer = NewRandomizer(config, e.Pieces.Len())
+	e.startLevel()
+	if e.ModeRules().TimeLimit {
+		e.Timer = e.Config.UltraTime
+	}
+	if e.puzzling() {
+		e.loadPuzzle()
+	}
+
+	//Inicializa las piezas preview
+	for i := 0; i < NumPreview; i++ {
+		e.NextPieces[i], e.NextSpecial[i] = e.randomPiece()
+	}
+
+	e.spawnPiece()
+	return e.events
+}
+
+// .... Avanza un tick con la entrada dada y devuelve lo que pasó ....
+func (e *Engine) Step(in Input) []Event {
+	e.events = e.events[:0]
+	e.Awards = e.Awards[:0]
+	e.Outgoing = 0
+	if e.Over {
+		return e.events
+	}
+
+	//El reloj también va en ticks, así la pausa lo congela de verdad
+	e.Ticks++
+	if e.tickTimer() {
+		return e.events
+	}
+	e.tickGarbage()
+	if e.Over {
+		return e.events
+	}
+
+	//Con los objetivos cumplidos se pasa de nivel, sin esperar el tiempo
+	if e.checkLevelComplete() {
+		e.nextLevel()
+	}
+
+	//Limpiando líneas no hay pieza: se guarda lo apretado y al terminar sale la siguiente
+	if e.Clearing() {
+		if !e.tickClear(in) || e.Over {
+			return e.events
+		}
+		e.spawnPiece()
+		if e.Over {
+			return e.events
+		}
+		in |= e.bufferedInput
+		e.bufferedInput = 0
+	}
+
+	e.handleMovement(in)
+
+	//Rotar la pieza, con wall kicks
+	rotated := false
+	if in.Has(InputRotate) {
+		rotated = e.rotate(RotateCW)
+	} else if in.Has(InputRotateCCW) {
+		rotated = e.rotate(RotateCCW)
+	} else if in.Has(InputRotate180) {
+		rotated = e.rotate(Rotate180)
+	}
+	if rotated {
+		e.lastRotated = true
+		e.resetLockDelay()
+		e.pieceDescended()
+	}
+
+	//Guardar la pieza
+	if in.Has(InputHold) {
+		e.holdPiece()
+		if e.Over {
+			return e.events
+		}
+	}
+
+	//Caída instantánea
+	if in.Has(InputHardDrop) {
+		dist := e.DropDistance()
+		if dist > 0 {
+			e.lastRotated = false
+		}
+		e.FallingY += dist
+		e.Score += dist * e.scoreTable().HardDrop
+		e.lockAndSpawn()
+		if e.Over || e.Clearing() {
+			return e.events
+		}
+	}
+
+	//Actualización de la caída de la pieza, más rápida con la caída rápida
+	if e.fall(in) {
+		return e.events
+	}
+
+	//Con lock delay, la pieza apoyada espera su tiempo antes de quedar fija
+	if e.Config.LockDelay > 0 && e.tickLockDelay() {
+		e.lockAndSpawn()
+	}
+
+	return e.events
+}
+
+// .... Lockea la pieza y saca la siguiente, salvo que haya que esperar la limpieza ....
+func (e *Engine) lockAndSpawn() {
+	e.lockPiece()
+	if !e.Clearing() && !e.Over {
+		e.spawnPiece()
+	}
+}
+
+// .... Bloques de la pieza que cae, ya ubicados en el tablero ....
+func (e *Engine) FallingBlocks() []Point {
+	shape := e.Pieces.Shape(e.FallingCol, e.FallingRotation)
+	blocks := make([]Point, len(shape))
+	for i, b := range shape {
+		blocks[i] = Point{e.FallingX + b.X, e.FallingY + b.Y}
+	}
+	return blocks
+}
+
+// .... Cuántas filas bajaría la pieza con una caída instantánea ....
+func (e *Engine) DropDistance() int {
+	dist := 0
+	for e.canMove(0, dist+1) {
+		dist++
+	}
+	return dist
+}
+
+// .... ¿Se puede usar el hold con la pieza actual? ....
+func (e *Engine) CanHold() bool {
+	return !e.holdUsed
+}
+
+func (e *Engine) emit(ev Event) {
+	e.events = append(e.events, ev)
+}
+
+// .... Movimiento horizontal con delay inicial y repetición ....
+func (e *Engine) handleMovement(in Input) {
+	moveDir := 0
+	if in.Has(InputLeft) {
+		moveDir = -1
+	} else if in.Has(InputRight) {
+		moveDir = 1
+	}
+
+	if moveDir != 0 {
+		if moveDir != e.lastMoveDir {
+			//Primer movimiento inmediato al presionar la tecla
+			e.shift(moveDir)
+			e.moveDelayCounter = 0
+			e.keyHeldFrames = 1
+			e.lastMoveDir = moveDir
+		} else {
+			e.keyHeldFrames++
+			if e.keyHeldFrames > e.initialMoveDelay {
+				e.moveDelayCounter++
+				if e.moveDelayCounter >= e.moveDelay {
+					e.shift(moveDir)
+					e.moveDelayCounter = 0
+				}
+			}
+		}
+	} else {
+		e.moveDelayCounter = 0
+		e.keyHeldFrames = 0
+		e.lastMoveDir = 0
+	}
+}
+
+// .... Durante la limpieza no hay pieza, pero mantener una flecha va cargando la repetición ....
+func (e *Engine) chargeMovement(in Input) {
+	moveDir := 0
+	if in.Has(InputLeft) {
+		moveDir = -1
+	} else if in.Has(InputRight) {
+		moveDir = 1
+	}
+
+	switch {
+	case moveDir == 0:
+		e.keyHeldFrames = 0
+		e.lastMoveDir = 0
+	case moveDir == e.lastMoveDir:
+		e.keyHeldFrames++
+	default:
+		e.keyHeldFrames = 1
+		e.lastMoveDir = moveDir
+	}
+	e.moveDelayCounter = 0
+}
+
+// .... Corre la pieza una columna, si puede ....
+func (e *Engine) shift(dir int) {
+	if e.canMove(dir, 0) {
+		e.FallingX += dir
+		e.lastRotated = false
+		e.resetLockDelay()
+	}
+}
@@ -0,0 +1,301 @@
+package engine
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// .... Ayudas de los tests del motor ....
+
+// Motor ya empezado en el modo pedido, con las líneas yéndose al instante
+func newTestEngine(t *testing.T, mode ModeKind) *Engine {
+	t.Helper()
+	e := New()
+	e.Config.Mode = mode
+	e.Config.LineClearDelay = 0
+	e.Start(1)
+	return e
+}
+
+// Id de la pieza con ese nombre en el set del motor
+func pieceID(t *testing.T, e *Engine, name string) int {
+	t.Helper()
+	id := e.Pieces.Find(name)
+	if id == 0 {
+		t.Fatalf("el set %q no tiene la pieza %q", e.Pieces.Name, name)
+	}
+	return id
+}
+
+// Pone la pieza con ese nombre como la que cae, sin marca especial
+func placeTest(t *testing.T, e *Engine, name string) {
+	t.Helper()
+	e.placePiece(pieceID(t, e, name), MarkNone)
+	if e.Over {
+		t.Fatalf("la pieza %q no cabe al aparecer", name)
+	}
+}
+
+// Llena la fila y, salvo las columnas dadas
+func fillRow(e *Engine, y int, except ...int) {
+	for x := 0; x < e.Width(); x++ {
+		e.Grid[y][x] = Cell{Piece: GarbagePiece, Flags: CellGarbage}
+	}
+	for _, x := range except {
+		e.Grid[y][x] = Cell{}
+	}
+}
+
+// Columnas que ocupa la pieza que cae
+func fallingColumns(e *Engine) []int {
+	seen := map[int]bool{}
+	var cols []int
+	for _, b := range e.FallingBlocks() {
+		if !seen[b.X] {
+			seen[b.X] = true
+			cols = append(cols, b.X)
+		}
+	}
+	return cols
+}
+
+func hasEvent(events []Event, ev Event) bool {
+	for _, e := range events {
+		if e == ev {
+			return true
+		}
+	}
+	return false
+}
+
+// .... La pieza no atraviesa las paredes, con cualquier ancho de tablero ....
+func TestWalls(t *testing.T) {
+	for _, width := range []int{GridWidth, 6, 16} {
+		e := New()
+		e.Config.Mode = ModeMarathon
+		e.Config.Width = width
+		e.Start(1)
+		placeTest(t, e, "O")
+
+		//Manteniendo la flecha la pieza llega a la pared y ahí se queda
+		for i := 0; i < 100; i++ {
+			e.Step(InputLeft)
+		}
+		for _, b := range e.FallingBlocks() {
+			if b.X < 0 {
+				t.Fatalf("ancho %d: la pieza se salió por la izquierda: %v", width, e.FallingBlocks())
+			}
+		}
+		if e.canMove(-1, 0) {
+			t.Fatalf("ancho %d: la pieza no llegó a la pared izquierda: %v", width, e.FallingBlocks())
+		}
+
+		e.Step(0)
+		for i := 0; i < 100; i++ {
+			e.Step(InputRight)
+		}
+		for _, b := range e.FallingBlocks() {
+			if b.X >= e.Width() {
+				t.Fatalf("ancho %d: la pieza se salió por la derecha: %v", width, e.FallingBlocks())
+			}
+		}
+		if e.canMove(1, 0) {
+			t.Fatalf("ancho %d: la pieza no llegó a la pared derecha: %v", width, e.FallingBlocks())
+		}
+	}
+}
+
+// .... Cayendo sola o de una, la pieza queda apoyada en el fondo ....
+func TestFloor(t *testing.T) {
+	for _, in := range []Input{0, InputSoftDrop, InputHardDrop} {
+		e := newTestEngine(t, ModeMarathon)
+		placeTest(t, e, "O")
+		cols := fallingColumns(e)
+
+		locked := false
+		for i := 0; i < 2000 && !locked; i++ {
+			locked = hasEvent(e.Step(in), EventLock)
+		}
+		if !locked {
+			t.Fatalf("entrada %d: la pieza nunca se lockeó", in)
+		}
+		bottom := e.Height() - 1
+		for _, x := range cols {
+			if e.Grid[bottom][x].Empty() || e.Grid[bottom-1][x].Empty() {
+				t.Fatalf("entrada %d: la O no quedó en las dos filas de abajo, columna %d", in, x)
+			}
+			if !e.Grid[bottom-2][x].Empty() {
+				t.Fatalf("entrada %d: la O quedó más arriba del fondo, columna %d", in, x)
+			}
+		}
+	}
+}
+
+// .... Una doble limpia las filas, baja lo de arriba y suma sus puntos ....
+func TestLineClear(t *testing.T) {
+	e := newTestEngine(t, ModeMarathon)
+	placeTest(t, e, "O")
+	cols := fallingColumns(e)
+
+	//Dos filas llenas salvo donde cae la O, y un bloque suelto arriba que tiene que bajar
+	bottom := e.Height() - 1
+	fillRow(e, bottom, cols...)
+	fillRow(e, bottom-1, cols...)
+	e.Grid[bottom-2][0] = Cell{Piece: GarbagePiece, Flags: CellGarbage}
+
+	events := e.Step(InputHardDrop)
+	if !hasEvent(events, EventMatch) {
+		t.Fatalf("no se avisó la limpieza: %v", events)
+	}
+	table := scoreTables[ScoringClassic]
+	if want := table.Lines[2] + table.Lock; e.Score != want {
+		t.Fatalf("puntaje %d, tenía que ser %d", e.Score, want)
+	}
+	for x := 1; x < e.Width(); x++ {
+		if !e.Grid[bottom][x].Empty() {
+			t.Fatalf("la fila de abajo quedó con la celda %d ocupada", x)
+		}
+	}
+	if e.Grid[bottom][0].Empty() {
+		t.Fatal("el bloque suelto no bajó al fondo")
+	}
+}
+
+// .... Sin lugar para la pieza nueva se pierde; en zen el tablero se vacía ....
+func TestTopOut(t *testing.T) {
+	tests := []struct {
+		mode ModeKind
+		over bool
+		ev   Event
+	}{
+		{ModeMarathon, true, EventGameOver},
+		{ModeZen, false, EventTopOut},
+	}
+	for _, tt := range tests {
+		e := newTestEngine(t, tt.mode)
+		placeTest(t, e, "O")
+
+		//Todo lleno salvo la última columna, así ninguna fila se limpia
+		for y := 2; y < e.Height(); y++ {
+			fillRow(e, y, e.Width()-1)
+		}
+		events := e.Step(InputHardDrop)
+		for i := 0; i < 10 && !hasEvent(events, tt.ev); i++ {
+			events = e.Step(InputHardDrop)
+		}
+		if !hasEvent(events, tt.ev) {
+			t.Fatalf("%s: no llegó el evento %d", Rules(tt.mode).Name, tt.ev)
+		}
+		if e.Over != tt.over || e.Finished {
+			t.Fatalf("%s: Over %v Finished %v después del top out", Rules(tt.mode).Name, e.Over, e.Finished)
+		}
+	}
+}
+
+// .... Se sube de nivel al cumplir la meta del modo ....
+func TestLevelUp(t *testing.T) {
+	//Maratón: cada 10 líneas
+	e := newTestEngine(t, ModeMarathon)
+	e.Lines = 9
+	placeTest(t, e, "O")
+	fillRow(e, e.Height()-1, fallingColumns(e)...)
+	e.Step(InputHardDrop)
+	gravity := e.Gravity
+	if events := e.Step(0); !hasEvent(events, EventLevelUp) || e.Level != 2 {
+		t.Fatalf("maratón: con %d líneas se quedó en el nivel %d", e.Lines, e.Level)
+	}
+	if e.Gravity < gravity {
+		t.Fatalf("maratón: la gravedad bajó al subir de nivel, de %d a %d", gravity, e.Gravity)
+	}
+
+	//FETRIS: al cumplir los objetivos de la tabla, sin esperar el tiempo
+	e = New()
+	e.Config.LineClearDelay = 0
+	e.Levels = &LevelTable{Name: "prueba", Levels: []LevelDef{
+		{Objectives: []Objective{{Kind: ObjectiveLines, Target: 1}}},
+		{Objectives: []Objective{{Kind: ObjectiveLines, Target: 5}}},
+	}}
+	e.Start(1)
+	placeTest(t, e, "O")
+	fillRow(e, e.Height()-1, fallingColumns(e)...)
+	events := e.Step(InputHardDrop)
+	if !hasEvent(events, EventLevelUp) {
+		events = e.Step(0)
+	}
+	if !hasEvent(events, EventLevelUp) || e.Level != 2 {
+		t.Fatalf("FETRIS: con el objetivo cumplido se quedó en el nivel %d", e.Level)
+	}
+	if e.LevelLines != 0 || e.Timer != e.TimeLimit {
+		t.Fatalf("FETRIS: el nivel nuevo empezó con %d líneas y %d segundos", e.LevelLines, e.Timer)
+	}
+
+	//Sin cumplir los objetivos, al acabarse el tiempo se pierde
+	e.Timer, e.timerTicks = 1, TPS-1
+	if events := e.Step(0); !hasEvent(events, EventGameOver) || e.Level != 2 {
+		t.Fatalf("FETRIS: con el tiempo acabado no se perdió: nivel %d", e.Level)
+	}
+}
+
+// .... La misma semilla con las mismas entradas da la misma partida ....
+func TestDeterminism(t *testing.T) {
+	inputs := make([]Input, 5000)
+	r := rand.New(rand.NewSource(42))
+	for i := range inputs {
+		inputs[i] = Input(r.Intn(256))
+	}
+
+	play := func(seed int64) []uint64 {
+		e := New()
+		e.Config.Mode = ModeZen
+		e.Start(seed)
+		hashes := make([]uint64, len(inputs))
+		for i, in := range inputs {
+			e.Step(in)
+			hashes[i] = e.Hash()
+		}
+		return hashes
+	}
+
+	a, b := play(7), play(7)
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("con la misma semilla las partidas se separaron en el tick %d", i)
+		}
+	}
+	if c := play(8); c[len(c)-1] == a[len(a)-1] {
+		t.Fatal("con otra semilla salió la misma partida")
+	}
+}
+
+// .... La huella también cambia con lo que no se ve y decide los ticks siguientes ....
+func TestHashHiddenState(t *testing.T) {
+	changes := map[string]func(e *Engine){
+		"bolsa": func(e *Engine) {
+			bag := e.randomizer.State()
+			bag[0], bag[1] = bag[1], bag[0]
+		},
+		"rotó":          func(e *Engine) { e.lastRotated = !e.lastRotated },
+		"kick":          func(e *Engine) { e.lastKick = 4 },
+		"guardado":      func(e *Engine) { e.bufferedInput = InputHold },
+		"repetición":    func(e *Engine) { e.keyHeldFrames++ },
+		"dirección":     func(e *Engine) { e.lastMoveDir = 1 },
+		"líneas nivel":  func(e *Engine) { e.LevelLines++ },
+		"especiales":    func(e *Engine) { e.LevelSpecials++ },
+		"puntaje nivel": func(e *Engine) { e.levelStartScore++ },
+		"puzzle":        func(e *Engine) { e.puzzleNext++ },
+		"reloj":         func(e *Engine) { e.timerTicks++ },
+		"lockeada":      func(e *Engine) { e.Grid[e.Height()-1][0] = Cell{Piece: 1, LockedAt: 5} },
+	}
+	for name, change := range changes {
+		a, b := newTestEngine(t, ModeSprint), newTestEngine(t, ModeSprint)
+		a.Grid[a.Height()-1][0] = Cell{Piece: 1, LockedAt: 3}
+		b.Grid[b.Height()-1][0] = Cell{Piece: 1, LockedAt: 3}
+		if a.Hash() != b.Hash() {
+			t.Fatal("dos partidas recién empezadas con la misma semilla tienen huellas distintas")
+		}
+		change(b)
+		if a.Hash() == b.Hash() {
+			t.Fatalf("%s: la huella no cambió", name)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package engine
+
+import "sort"
+
+// .... Qué pasa con el resto del tablero después de limpiar líneas ....
+type GravityKind int
+
+const (
+	GravityNaive   GravityKind = iota //Todo lo de arriba baja una fila por línea, como siempre
+	GravityCascade                    //Cada trozo suelto cae hasta apoyarse y puede armar líneas nuevas
+	GravitySticky                     //Como cascada, pero solo se pegan las celdas de la misma pieza
+)
+
+// .... Baja el tablero después de sacar las filas, según la gravedad elegida ....
+func (e *Engine) collapse(rows []int) {
+	if e.Config.Gravity == GravityNaive {
+		e.removeRows(rows)
+		return
+	}
+
+	//Las filas quedan vacías y lo de arriba cae por trozos
+	for _, y := range rows {
+		e.Grid[y] = make([]Cell, e.Width())
+	}
+	e.settle(e.Config.Gravity == GravitySticky)
+
+	//Lo que cayó puede haber llenado otras filas: es una cadena, y cuenta como combo
+	if chain := e.fullRows(); len(chain) > 0 {
+		e.clearLines(chain, spinNone)
+	}
+}
+
+// .... Deja caer cada trozo hasta que nada se mueva ....
+func (e *Engine) settle(samePiece bool) {
+	for {
+		moved := false
+
+		//Los de más abajo caen primero, así dejan espacio a los de arriba
+		chunks := e.chunks(samePiece)
+		sort.SliceStable(chunks, func(i, j int) bool {
+			return chunkBottom(chunks[i]) > chunkBottom(chunks[j])
+		})
+
+		for _, chunk := range chunks {
+			cells := make([]Cell, len(chunk))
+			for i, p := range chunk {
+				cells[i] = e.Grid[p.Y][p.X]
+				e.Grid[p.Y][p.X] = Cell{}
+			}
+
+			drop := 0
+			for e.chunkFits(chunk, drop+1) {
+				drop++
+			}
+			if drop > 0 {
+				moved = true
+			}
+
+			for i, p := range chunk {
+				e.Grid[p.Y+drop][p.X] = cells[i]
+			}
+		}
+
+		if !moved {
+			return
+		}
+	}
+}
+
+// .... Trozos del tablero: celdas ocupadas unidas por los lados ....
+// Con samePiece solo se unen las celdas de la misma pieza: el mismo id lockeado en el
+// mismo tick, así dos piezas iguales que se tocan siguen siendo trozos distintos.
+func (e *Engine) chunks(samePiece bool) [][]Point {
+	seen := make([][]bool, e.Height())
+	for y := range seen {
+		seen[y] = make([]bool, e.Width())
+	}
+	var chunks [][]Point
+
+	for y := 0; y < e.Height(); y++ {
+		for x := 0; x < e.Width(); x++ {
+			if seen[y][x] || e.Grid[y][x].Empty() {
+				continue
+			}
+
+			//Recorre el trozo desde esta celda
+			chunk := []Point{{x, y}}
+			seen[y][x] = true
+			for i := 0; i < len(chunk); i++ {
+				p := chunk[i]
+				for _, d := range []Point{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+					nx, ny := p.X+d.X, p.Y+d.Y
+					if !e.inside(nx, ny) || seen[ny][nx] {
+						continue
+					}
+					next := e.Grid[ny][nx]
+					if next.Empty() || (samePiece && !samePieceCell(next, e.Grid[p.Y][p.X])) {
+						continue
+					}
+					seen[ny][nx] = true
+					chunk = append(chunk, Point{nx, ny})
+				}
+			}
+			chunks = append(chunks, chunk)
+		}
+	}
+	return chunks
+}
+
+// ¿Las dos celdas vienen del mismo lock de la misma pieza?
+func samePieceCell(a, b Cell) bool {
+	return a.Piece == b.Piece && a.LockedAt == b.LockedAt
+}
+
+// ¿El trozo (ya sacado del tablero) cabe bajado dy filas?
+func (e *Engine) chunkFits(chunk []Point, dy int) bool {
+	for _, p := range chunk {
+		y := p.Y + dy
+		if y >= e.Height() || !e.Grid[y][p.X].Empty() {
+			return false
+		}
+	}
+	return true
+}
+
+func chunkBottom(chunk []Point) int {
+	bottom := 0
+	for _, p := range chunk {
+		if p.Y > bottom {
+			bottom = p.Y
+		}
+	}
+	return bottom
+}
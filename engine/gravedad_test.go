@@ -0,0 +1,42 @@
+package engine
+
+import "testing"
+
+// .... Después de limpiar, cada gravedad baja distinto dos piezas iguales que se tocan ....
+func TestGravityChunks(t *testing.T) {
+	bottom := GridHeight - 1
+	tests := []struct {
+		gravity GravityKind
+		rowA    int //Fila donde termina la primera S
+		rowB    int //Fila donde termina la segunda
+	}{
+		{GravityNaive, bottom - 2, bottom - 2},
+		{GravityCascade, bottom - 2, bottom - 2}, //Todo lo que se toca es un trozo
+		{GravitySticky, bottom - 2, bottom},      //Son dos locks distintos, se separan
+	}
+	for _, tt := range tests {
+		e := newTestEngine(t, ModeMarathon)
+		e.Config.Gravity = tt.gravity
+		s := pieceID(t, e, "S")
+
+		//Dos S pegadas arriba de la fila que se limpia: la primera se apoya en una columna
+		//que queda, la segunda tiene hueco abajo
+		fillRow(e, bottom-2)
+		e.Grid[bottom-1][0] = Cell{Piece: GarbagePiece, Flags: CellGarbage}
+		e.Grid[bottom][0] = Cell{Piece: GarbagePiece, Flags: CellGarbage}
+		for x := 0; x < 4; x++ {
+			e.Grid[bottom-3][x] = Cell{Piece: s, LockedAt: 1 + x/2}
+		}
+
+		e.collapse([]int{bottom - 2})
+		for x := 0; x < 4; x++ {
+			row := tt.rowA
+			if x >= 2 {
+				row = tt.rowB
+			}
+			if c := e.Grid[row][x]; c.Piece != s || c.LockedAt != 1+x/2 {
+				t.Fatalf("gravedad %d: la columna %d no quedó en la fila %d", tt.gravity, x, row)
+			}
+		}
+	}
+}
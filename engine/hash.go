@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"encoding/binary"
+	"hash"
+	"hash/fnv"
+)
+
+// .... Huella del estado de la partida ....
+// Dos motores con la misma semilla y las mismas entradas tienen que dar la misma
+// huella; en red se comparan para darse cuenta si las partidas se separaron.
+func (e *Engine) Hash() uint64 {
+	h := fnv.New64a()
+	e.writeHash(h)
+	return h.Sum64()
+}
+
+// Escribe en h todo lo que cambia cómo sigue la partida
+func (e *Engine) writeHash(h hash.Hash64) {
+	put := func(values ...int) {
+		var buf [8]byte
+		for _, v := range values {
+			binary.LittleEndian.PutUint64(buf[:], uint64(v))
+			h.Write(buf[:])
+		}
+	}
+	flag := func(b bool) int {
+		if b {
+			return 1
+		}
+		return 0
+	}
+
+	for _, row := range e.Grid {
+		for _, c := range row {
+			put(c.Piece, int(c.Mark), c.LockedAt, int(c.Flags))
+		}
+	}
+	put(e.FallingX, e.FallingY, e.FallingCol, int(e.FallingSpecial), e.FallingRotation)
+	put(e.Score, e.Level, e.Lines, e.Locks, e.Ticks, e.PendingGarbage, e.Sent, e.HeldPiece, e.Combo)
+	put(int(e.HeldSpecial), flag(e.holdUsed), flag(e.BackToBack), e.Gravity)
+	put(e.LevelLines, e.LevelSpecials, e.levelStartScore, e.puzzleNext)
+	//Lo que todavía no se ve en el tablero: la gravedad juntada, el lock delay y los relojes
+	put(e.fallAccum, e.lockTimer, e.lockResets, e.lowestY, e.clearTimer, e.clearedTick, e.garbageTimer, e.garbageHole, e.Timer, e.timerTicks)
+	put(len(e.clearingRows))
+	put(e.clearingRows...)
+	//El giro que vale para el T-spin, lo guardado en la limpieza y la repetición de las flechas
+	put(flag(e.lastRotated), e.lastKick, int(e.bufferedInput))
+	put(e.moveDelayCounter, e.keyHeldFrames, e.lastMoveDir)
+	for i := range e.NextPieces {
+		put(e.NextPieces[i], int(e.NextSpecial[i]))
+	}
+	put(int(e.rng.state), int(e.garbageRNG.state))
+	//Lo que recuerda el randomizer: la bolsa o el historial
+	if e.randomizer != nil {
+		state := e.randomizer.State()
+		put(len(state))
+		put(state...)
+	}
+	if e.Over {
+		put(1)
+	}
+}
+
+// .... Huella de todas las partidas del versus, en orden, y de a quién apunta cada uno ....
+func (m *Match) Hash() uint64 {
+	h := fnv.New64a()
+	for _, p := range m.Players {
+		p.writeHash(h)
+	}
+	var buf [8]byte
+	for i := range m.Players {
+		binary.LittleEndian.PutUint64(buf[:], uint64(m.Targeting[i])<<32|uint64(uint32(m.attackers[i])))
+		h.Write(buf[:])
+	}
+	binary.LittleEndian.PutUint64(buf[:], m.rng.state)
+	h.Write(buf[:])
+	return h.Sum64()
+}
@@ -0,0 +1,111 @@
+package engine
+
+// .... Limpieza de líneas ....
+// Las filas llenas no desaparecen de inmediato: quedan marcadas LineClearDelay ticks
+// (para que se vean brillar y deshacerse) y recién después el resto del tablero baja
+// y sale la pieza siguiente. Lo que se aprieta en ese rato no se pierde.
+
+// .... Una fila que se limpió, con sus celdas tal como estaban ....
+type ClearedRow struct {
+	Y     int
+	Cells []Cell
+}
+
+// Acciones de un toque que se guardan durante la limpieza y se aplican a la pieza nueva
+const bufferedActions = InputRotate | InputRotateCCW | InputRotate180 | InputHold
+
+// .... Filas llenas del tablero, de arriba a abajo ....
+func (e *Engine) fullRows() []int {
+	var rows []int
+	for y := 0; y < e.Height(); y++ {
+		full := true
+		for x := 0; x < e.Width(); x++ {
+			if e.Grid[y][x].Empty() {
+				full = false
+				break
+			}
+		}
+		if full {
+			rows = append(rows, y)
+		}
+	}
+	return rows
+}
+
+// .... Saca las filas y baja todo lo de arriba una fila por cada una ....
+func (e *Engine) removeRows(rows []int) {
+	for _, y := range rows {
+		for y2 := y; y2 > 0; y2-- {
+			e.Grid[y2] = e.Grid[y2-1]
+		}
+		e.Grid[0] = make([]Cell, e.Width())
+	}
+}
+
+// ¿El tablero queda vacío si se sacan estas filas?
+func (e *Engine) emptyWithout(rows []int) bool {
+	skip := make(map[int]bool, len(rows))
+	for _, y := range rows {
+		skip[y] = true
+	}
+	for y := 0; y < e.Height(); y++ {
+		if skip[y] {
+			continue
+		}
+		for x := 0; x < e.Width(); x++ {
+			if !e.Grid[y][x].Empty() {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// .... Empieza la limpieza de las filas (o las saca altiro si no hay delay) ....
+func (e *Engine) startClear(rows []int) {
+	//Las cadenas de un mismo tick se juntan, para que se vean todas
+	if e.clearedTick != e.Ticks {
+		e.Cleared = e.Cleared[:0]
+		e.clearedTick = e.Ticks
+	}
+	for _, y := range rows {
+		e.Cleared = append(e.Cleared, ClearedRow{Y: y, Cells: append([]Cell(nil), e.Grid[y]...)})
+	}
+
+	if e.Config.LineClearDelay <= 0 {
+		e.collapse(rows)
+		return
+	}
+	e.clearingRows = append(e.clearingRows[:0], rows...)
+	e.clearTimer = e.Config.LineClearDelay
+}
+
+// .... Un tick de la limpieza; devuelve true cuando terminó y el tablero bajó ....
+func (e *Engine) tickClear(in Input) bool {
+	e.bufferedInput |= in & bufferedActions
+	e.chargeMovement(in)
+
+	e.clearTimer--
+	if e.clearTimer > 0 {
+		return false
+	}
+
+	//Al bajar puede empezar otra limpieza (una cadena), y hay que esperarla también
+	e.collapse(e.clearingRows)
+	//La cadena también puede resolver el puzzle
+	e.checkPuzzle()
+	return !e.Clearing()
+}
+
+// .... ¿Se están limpiando líneas? (no hay pieza cayendo) ....
+func (e *Engine) Clearing() bool {
+	return e.clearTimer > 0
+}
+
+// .... Avance de la limpieza, de 0 a 1 (para la animación) ....
+func (e *Engine) ClearProgress() float64 {
+	if e.clearTimer <= 0 || e.Config.LineClearDelay <= 0 {
+		return 1
+	}
+	return 1 - float64(e.clearTimer)/float64(e.Config.LineClearDelay)
+}
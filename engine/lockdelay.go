@@ -0,0 +1,56 @@
+package engine
+
+// .... Lock delay: el tiempo que la pieza apoyada espera antes de quedar fija ....
+
+// Avanza el lock delay un tick; devuelve true si la pieza debe lockearse
+func (e *Engine) tickLockDelay() bool {
+	//En el aire el tiempo no corre
+	if e.canMove(0, 1) {
+		return false
+	}
+
+	e.lockTimer++
+	return e.lockTimer >= e.Config.LockDelay
+}
+
+// Se llama cuando la pieza se movió o rotó con éxito
+func (e *Engine) resetLockDelay() {
+	//Solo cuenta si la pieza ya estaba apoyada
+	if e.lockTimer == 0 {
+		return
+	}
+
+	switch e.Config.LockReset {
+	case LockResetMove:
+		if e.lockResets < e.Config.MaxLockResets {
+			e.lockTimer = 0
+			e.lockResets++
+		}
+	case LockResetInfinite:
+		e.lockTimer = 0
+	}
+}
+
+// Se llama cuando la pieza cambió de fila; al llegar más abajo que nunca se reinicia todo
+func (e *Engine) pieceDescended() {
+	if e.FallingY > e.lowestY {
+		e.lowestY = e.FallingY
+		e.lockTimer = 0
+		e.lockResets = 0
+	}
+}
+
+// Estado inicial del lock delay para una pieza recién puesta
+func (e *Engine) clearLockDelay() {
+	e.lockTimer = 0
+	e.lockResets = 0
+	e.lowestY = e.FallingY
+}
+
+// .... Qué tan cerca está la pieza de lockearse, de 0 a 1 (para dibujarlo) ....
+func (e *Engine) LockProgress() float64 {
+	if e.Config.LockDelay == 0 {
+		return 0
+	}
+	return float64(e.lockTimer) / float64(e.Config.LockDelay)
+}
@@ -0,0 +1,155 @@
+package engine
+
+// .... Modos de juego ....
+// Cada modo decide cómo se sube de nivel, si hay reloj y cuándo se acaba la partida.
+// Las reglas de cada uno están en una tabla, igual que los puntajes.
+type ModeKind int
+
+const (
+	ModeFetris   ModeKind = iota //Niveles con objetivos y tiempo, el FETRIS de siempre
+	ModeMarathon                 //Sin reloj, se sube de nivel cada 10 líneas hasta perder
+	ModeSprint                   //40 líneas lo más rápido posible
+	ModeUltra                    //El mejor puntaje antes de que se acabe el tiempo
+	ModeZen                      //Sin game over: si el tablero se llena, se vacía
+	ModePuzzle                   //Tablero armado y piezas contadas, con una meta
+	ModeInvasion                 //La basura sube desde abajo, cada nivel más rápido
+	ModeVersus                   //Dos jugadores, las líneas de uno le mandan basura al otro
+	NumModes
+)
+
+// .... Reglas de un modo ....
+type ModeRules struct {
+	Name          string
+	Objectives    bool //Los niveles salen de la tabla de niveles, con su tiempo y sus objetivos
+	LinesPerLevel int  //Sin tabla: se sube de nivel cada tantas líneas, 0 = el nivel no cambia
+	LineGoal      int  //La partida termina al hacer estas líneas, 0 = sin meta
+	TimeLimit     bool //La partida termina al acabarse el tiempo (Config.UltraTime)
+	NoTopOut      bool //Si el tablero se llena se vacía y se sigue jugando
+	Puzzle        bool //El tablero y las piezas salen del puzzle elegido
+	Invasion      bool //Cada cierto tiempo llega una fila de basura
+	Versus        bool //Se juega contra otros (Match), los ataques mandan basura
+	ByTime        bool //En la tabla de puntajes gana el menor tiempo, no el mayor puntaje
+	Bag           bool //Las piezas salen de la bolsa, sin importar Config.Randomizer
+}
+
+var modeRules = [NumModes]ModeRules{
+	ModeFetris: {
+		Name:       "FETRIS",
+		Objectives: true,
+	},
+	ModeMarathon: {
+		Name:          "MARATON",
+		LinesPerLevel: 10,
+	},
+	ModeSprint: {
+		Name:     "SPRINT",
+		LineGoal: 40,
+		ByTime:   true,
+		Bag:      true,
+	},
+	ModeUltra: {
+		Name:      "ULTRA",
+		TimeLimit: true,
+		Bag:       true,
+	},
+	ModeZen: {
+		Name:     "ZEN",
+		NoTopOut: true,
+	},
+	ModePuzzle: {
+		Name:   "PUZZLE",
+		Puzzle: true,
+	},
+	ModeInvasion: {
+		Name:          "INVASION",
+		LinesPerLevel: 10,
+		Invasion:      true,
+	},
+	ModeVersus: {
+		Name:          "VERSUS",
+		LinesPerLevel: 10,
+		Versus:        true,
+		Bag:           true,
+	},
+}
+
+// Reglas de un modo (los valores fuera de la tabla juegan como FETRIS)
+func Rules(mode ModeKind) ModeRules {
+	if mode < 0 || mode >= NumModes {
+		mode = ModeFetris
+	}
+	return modeRules[mode]
+}
+
+// .... Reglas del modo de la partida ....
+func (e *Engine) ModeRules() ModeRules {
+	return Rules(e.Config.Mode)
+}
+
+// ¿El reloj de la partida va hacia atrás? (si no, se mide el tiempo jugado con Ticks)
+func (e *Engine) Timed() bool {
+	mode := e.ModeRules()
+	return mode.Objectives || mode.TimeLimit
+}
+
+// .... Un segundo de reloj cada TPS ticks; devuelve true si con él se acabó la partida ....
+func (e *Engine) tickTimer() bool {
+	if !e.Timed() {
+		return false
+	}
+
+	e.timerTicks++
+	if e.timerTicks < TPS {
+		return false
+	}
+	e.timerTicks = 0
+	e.Timer--
+	if e.Timer > 0 {
+		return false
+	}
+
+	//En ultra acabarse el tiempo es la meta; en FETRIS es perder, salvo con el nivel cumplido
+	if e.ModeRules().TimeLimit {
+		e.finish()
+		return true
+	}
+	if !e.checkLevelComplete() {
+		e.gameOver()
+		return true
+	}
+	return false
+}
+
+// .... ¿Se cumplió la meta de líneas del modo? ....
+func (e *Engine) checkLineGoal() {
+	if goal := e.ModeRules().LineGoal; goal > 0 && e.Lines >= goal && !e.Over {
+		e.finish()
+	}
+}
+
+// .... El tablero se llenó: en zen se vacía y se sigue, en el resto se pierde ....
+func (e *Engine) topOut() {
+	if !e.ModeRules().NoTopOut {
+		e.gameOver()
+		return
+	}
+	e.Grid = newGrid(e.Width(), e.Height())
+	e.Combo = -1
+	e.BackToBack = false
+	e.emit(EventTopOut)
+}
+
+// .... La partida terminó cumpliendo la meta del modo ....
+func (e *Engine) finish() {
+	e.Finished = true
+	e.gameOver()
+}
+
+// .... Termina la partida a pedido del jugador (zen no tiene otro final) ....
+func (e *Engine) End() []Event {
+	e.events = e.events[:0]
+	if !e.Over {
+		e.finish()
+	}
+	return e.events
+}
@@ -0,0 +1,167 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// .... Objetivos de cada nivel ....
+// Un nivel se pasa apenas se cumplen todos sus objetivos. Si el tiempo se acaba
+// antes, se acabó la partida. "Sobrevivir" solo se cumple cuando el tiempo llega a 0.
+type ObjectiveKind int
+
+const (
+	ObjectiveLines   ObjectiveKind = iota //Hacer Target líneas
+	ObjectiveScore                        //Ganar Target puntos en el nivel
+	ObjectiveSpecial                      //Lockear Target piezas especiales
+	ObjectiveSurvive                      //Aguantar hasta que se acabe el tiempo
+)
+
+// En los archivos de niveles el tipo va con su nombre
+var objectiveNames = map[ObjectiveKind]string{
+	ObjectiveLines:   "lineas",
+	ObjectiveScore:   "puntaje",
+	ObjectiveSpecial: "especiales",
+	ObjectiveSurvive: "sobrevivir",
+}
+
+func (k ObjectiveKind) MarshalJSON() ([]byte, error) {
+	return json.Marshal(objectiveNames[k])
+}
+
+func (k *ObjectiveKind) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	for kind, n := range objectiveNames {
+		if n == name {
+			*k = kind
+			return nil
+		}
+	}
+	return fmt.Errorf("objetivo desconocido %q", name)
+}
+
+// .... Un objetivo con su meta ....
+type Objective struct {
+	Kind   ObjectiveKind
+	Target int //No se usa en sobrevivir, ahí manda el tiempo del nivel
+}
+
+// .... Definición de un nivel ....
+type LevelDef struct {
+	Time       int //Segundos del nivel, 0 = el tiempo por defecto
+	Objectives []Objective
+}
+
+// .... Tabla de niveles; pasado el último se sigue repitiendo ese ....
+type LevelTable struct {
+	Name   string
+	Levels []LevelDef
+}
+
+// Definición del nivel pedido (desde 1)
+func (t *LevelTable) Get(level int) LevelDef {
+	if level > len(t.Levels) {
+		level = len(t.Levels)
+	}
+	return t.Levels[level-1]
+}
+
+// .... Revisa que la tabla se pueda jugar ....
+func (t *LevelTable) Validate() error {
+	if len(t.Levels) == 0 {
+		return fmt.Errorf("la tabla de niveles %q está vacía", t.Name)
+	}
+	for i, level := range t.Levels {
+		if level.Time < 0 {
+			return fmt.Errorf("el nivel %d tiene tiempo negativo", i+1)
+		}
+		for _, o := range level.Objectives {
+			if o.Kind != ObjectiveSurvive && o.Target <= 0 {
+				return fmt.Errorf("el nivel %d tiene un objetivo de %s sin meta", i+1, objectiveNames[o.Kind])
+			}
+		}
+	}
+	return nil
+}
+
+// .... Carga una tabla de niveles desde un JSON ....
+func LoadLevelTable(path string) (*LevelTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error al abrir la tabla de niveles %s: %w", path, err)
+	}
+
+	table := &LevelTable{}
+	if err := json.Unmarshal(data, table); err != nil {
+		return nil, fmt.Errorf("error al leer la tabla de niveles %s: %w", path, err)
+	}
+	if err := table.Validate(); err != nil {
+		return nil, err
+	}
+	return table, nil
+}
+
+// .... Niveles por defecto de FETRIS ....
+var DefaultLevels = &LevelTable{
+	Name: "FETRIS",
+	Levels: []LevelDef{
+		{Objectives: []Objective{{ObjectiveLines, 4}}},
+		{Objectives: []Objective{{ObjectiveLines, 8}}},
+		{Objectives: []Objective{{ObjectiveScore, 2000}}},
+		{Objectives: []Objective{{ObjectiveLines, 10}, {ObjectiveSpecial, 2}}},
+		{Time: 90, Objectives: []Objective{{ObjectiveSurvive, 0}}},
+		{Objectives: []Objective{{ObjectiveLines, 12}}},
+		{Objectives: []Objective{{ObjectiveScore, 5000}}},
+		{Objectives: []Objective{{ObjectiveLines, 12}, {ObjectiveSpecial, 3}}},
+		{Objectives: []Objective{{ObjectiveLines, 15}}},
+		{Objectives: []Objective{{ObjectiveSurvive, 0}, {ObjectiveLines, 10}}},
+	},
+}
+
+// .... Objetivos del nivel actual (un nivel sin objetivos es de sobrevivir) ....
+// Los modos que no usan la tabla de niveles no tienen.
+func (e *Engine) LevelGoals() []Objective {
+	if !e.ModeRules().Objectives {
+		return nil
+	}
+	if goals := e.Levels.Get(e.Level).Objectives; len(goals) > 0 {
+		return goals
+	}
+	return []Objective{{ObjectiveSurvive, 0}}
+}
+
+// .... Cuánto lleva y cuánto pide un objetivo del nivel actual ....
+func (e *Engine) Goal(o Objective) (progress, target int) {
+	switch o.Kind {
+	case ObjectiveLines:
+		return e.LevelLines, o.Target
+	case ObjectiveScore:
+		return e.Score - e.levelStartScore, o.Target
+	case ObjectiveSpecial:
+		return e.LevelSpecials, o.Target
+	default:
+		limit := e.levelTime()
+		return limit - e.Timer, limit
+	}
+}
+
+// Segundos que dura el nivel actual
+func (e *Engine) levelTime() int {
+	if t := e.Levels.Get(e.Level).Time; t > 0 {
+		return t
+	}
+	return e.TimeLimit
+}
+
+// .... Empieza el nivel actual desde cero ....
+func (e *Engine) startLevel() {
+	e.Timer = e.levelTime()
+	e.timerTicks = 0
+	e.LevelLines = 0
+	e.LevelSpecials = 0
+	e.levelStartScore = e.Score
+}
@@ -0,0 +1,266 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// .... Punto en el tablero (columna, fila) ....
+type Point struct {
+	X, Y int
+}
+
+// En los archivos de piezas un punto se escribe corto, como [x, y]
+func (p Point) MarshalJSON() ([]byte, error) {
+	return json.Marshal([2]int{p.X, p.Y})
+}
+
+func (p *Point) UnmarshalJSON(data []byte) error {
+	var xy [2]int
+	if err := json.Unmarshal(data, &xy); err != nil {
+		return err
+	}
+	p.X, p.Y = xy[0], xy[1]
+	return nil
+}
+
+const NumRotaciones = 4
+
+// .... Definición de una pieza ....
+type Piece struct {
+	Name      string
+	Rotations [][]Point  //Las 4 rotaciones, en orden horario
+	Color     [3]float64 //Escala RGB que se le aplica a la imagen del bloque
+	Glow      float64    //Brillo que se suma encima del color
+	Rainbow   bool       //La pieza va cambiando de color (multicolor)
+	Kicks     string     //Tabla de wall kicks al rotar: "JLSTZ", "I", "O", "Pentomino" o "I5"
+	Spawn     Point      //Desplazamiento desde el centro de la fila de arriba
+}
+
+// .... Set de piezas activo, el id de cada pieza es su posición + 1 (0 es celda vacía) ....
+type PieceSet struct {
+	Name   string
+	Pieces []Piece
+}
+
+// Cantidad de piezas del set
+func (s *PieceSet) Len() int {
+	return len(s.Pieces)
+}
+
+// Pieza con ese id, o nil si no existe
+func (s *PieceSet) Get(id int) *Piece {
+	if id < 1 || id > len(s.Pieces) {
+		return nil
+	}
+	return &s.Pieces[id-1]
+}
+
+// Id de la pieza con ese nombre, 0 si no está en el set
+func (s *PieceSet) Find(name string) int {
+	for i, p := range s.Pieces {
+		if p.Name == name {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Bloques de la pieza en la rotación pedida
+func (s *PieceSet) Shape(id, rotation int) []Point {
+	p := s.Get(id)
+	if p == nil {
+		return nil
+	}
+	return p.Rotations[rotation%NumRotaciones]
+}
+
+// .... Revisa que el set se pueda jugar ....
+func (s *PieceSet) Validate() error {
+	if len(s.Pieces) == 0 {
+		return fmt.Errorf("el set de piezas %q está vacío", s.Name)
+	}
+	for i, p := range s.Pieces {
+		if len(p.Rotations) != NumRotaciones {
+			return fmt.Errorf("la pieza %d (%s) tiene %d rotaciones, deben ser %d", i+1, p.Name, len(p.Rotations), NumRotaciones)
+		}
+		if _, ok := kickTables[p.Kicks]; !ok && p.Kicks != "" {
+			return fmt.Errorf("la pieza %d (%s) usa una tabla de kicks que no existe: %q", i+1, p.Name, p.Kicks)
+		}
+		for r, blocks := range p.Rotations {
+			if len(blocks) == 0 {
+				return fmt.Errorf("la pieza %d (%s) no tiene bloques en la rotación %d", i+1, p.Name, r)
+			}
+		}
+	}
+	return nil
+}
+
+// .... Carga un set de piezas personalizado desde un JSON ....
+func LoadPieceSet(path string) (*PieceSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error al abrir el set de piezas %s: %w", path, err)
+	}
+
+	set := &PieceSet{}
+	if err := json.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("error al leer el set de piezas %s: %w", path, err)
+	}
+	if err := set.Validate(); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// .... Las 11 piezas originales de FETRIS ....
+var DefaultPieces = &PieceSet{
+	Name: "FETRIS",
+	Pieces: []Piece{
+		{ // 1: I - Cian Metálico
+			Name: "I",
+			Rotations: [][]Point{
+				{{0, 1}, {1, 1}, {2, 1}, {3, 1}},
+				{{2, 0}, {2, 1}, {2, 2}, {2, 3}},
+				{{3, 2}, {2, 2}, {1, 2}, {0, 2}},
+				{{1, 3}, {1, 2}, {1, 1}, {1, 0}},
+			},
+			Color: [3]float64{0.8, 1, 1},
+			Glow:  0.1,
+			Kicks: "I",
+			Spawn: Point{-2, -1},
+		},
+		{ // 2: O - No rota - Amarillo Neón
+			Name: "O",
+			Rotations: [][]Point{
+				{{0, 0}, {1, 0}, {0, 1}, {1, 1}},
+				{{0, 0}, {1, 0}, {0, 1}, {1, 1}},
+				{{0, 0}, {1, 0}, {0, 1}, {1, 1}},
+				{{0, 0}, {1, 0}, {0, 1}, {1, 1}},
+			},
+			Color: [3]float64{1, 1, 0.7},
+			Glow:  0.1,
+			Kicks: "O",
+			Spawn: Point{-1, 0},
+		},
+		{ // 3: T - Violeta Fosforescente
+			Name: "T",
+			Rotations: [][]Point{
+				{{1, 0}, {0, 1}, {1, 1}, {2, 1}},
+				{{2, 1}, {1, 0}, {1, 1}, {1, 2}},
+				{{1, 2}, {2, 1}, {1, 1}, {0, 1}},
+				{{0, 1}, {1, 2}, {1, 1}, {1, 0}},
+			},
+			Color: [3]float64{0.8, 0.5, 0.8},
+			Glow:  0.1,
+			Kicks: "JLSTZ",
+			Spawn: Point{-2, 0},
+		},
+		{ // 4: L - Naranja Brillante
+			Name: "L",
+			Rotations: [][]Point{
+				{{2, 0}, {0, 1}, {1, 1}, {2, 1}},
+				{{2, 2}, {1, 0}, {1, 1}, {1, 2}},
+				{{0, 2}, {2, 1}, {1, 1}, {0, 1}},
+				{{0, 0}, {1, 2}, {1, 1}, {1, 0}},
+			},
+			Color: [3]float64{1, 0.8, 0.5},
+			Glow:  0.1,
+			Kicks: "JLSTZ",
+			Spawn: Point{-2, 0},
+		},
+		{ // 5: J - Azul Eléctrico
+			Name: "J",
+			Rotations: [][]Point{
+				{{0, 0}, {0, 1}, {1, 1}, {2, 1}},
+				{{2, 0}, {1, 0}, {1, 1}, {1, 2}},
+				{{2, 2}, {2, 1}, {1, 1}, {0, 1}},
+				{{0, 2}, {1, 2}, {1, 1}, {1, 0}},
+			},
+			Color: [3]float64{0.5, 0.5, 1},
+			Glow:  0.1,
+			Kicks: "JLSTZ",
+			Spawn: Point{-2, 0},
+		},
+		{ // 6: Z - Rojo Rubí
+			Name: "Z",
+			Rotations: [][]Point{
+				{{0, 0}, {1, 0}, {1, 1}, {2, 1}},
+				{{2, 0}, {2, 1}, {1, 1}, {1, 2}},
+				{{2, 2}, {1, 2}, {1, 1}, {0, 1}},
+				{{0, 2}, {0, 1}, {1, 1}, {1, 0}},
+			},
+			Color: [3]float64{1, 0.5, 0.5},
+			Glow:  0.1,
+			Kicks: "JLSTZ",
+			Spawn: Point{-2, 0},
+		},
+		{ // 7: S - Verde Esmeralda
+			Name: "S",
+			Rotations: [][]Point{
+				{{1, 0}, {2, 0}, {0, 1}, {1, 1}},
+				{{2, 1}, {2, 2}, {1, 0}, {1, 1}},
+				{{1, 2}, {0, 2}, {2, 1}, {1, 1}},
+				{{0, 1}, {0, 0}, {1, 2}, {1, 1}},
+			},
+			Color: [3]float64{0.5, 1, 0.5},
+			Glow:  0.1,
+			Kicks: "JLSTZ",
+			Spawn: Point{-2, 0},
+		},
+		{ // 8: U - Negro
+			Name: "U",
+			Rotations: [][]Point{
+				{{1, 0}, {0, 0}, {0, 1}, {0, 2}, {1, 2}},
+				{{2, 1}, {2, 0}, {1, 0}, {0, 0}, {0, 1}},
+				{{1, 2}, {2, 2}, {2, 1}, {2, 0}, {1, 0}},
+				{{0, 1}, {0, 2}, {1, 2}, {2, 2}, {2, 1}},
+			},
+			Color: [3]float64{1, 1, 1},
+			Glow:  0,
+			Kicks: "Pentomino",
+			Spawn: Point{-2, 0},
+		},
+		{ // 9: Pieza Especial 1 - Multicolor/Arcoiris
+			Name: "W",
+			Rotations: [][]Point{
+				{{2, 0}, {2, 1}, {1, 1}, {1, 2}, {0, 2}},
+				{{1, 0}, {1, 1}, {1, 2}, {0, 1}, {2, 1}},
+				{{0, 0}, {0, 1}, {1, 1}, {2, 1}, {2, 2}},
+				{{2, 0}, {2, 1}, {1, 1}, {0, 1}, {0, 2}},
+			},
+			Color:   [3]float64{1, 1, 1},
+			Glow:    0.1,
+			Kicks:   "Pentomino",
+			Spawn:   Point{-2, 0},
+			Rainbow: true,
+		},
+		{ // 10: | grande - Azul Claro
+			Name: "I5",
+			Rotations: [][]Point{
+				{{0, 2}, {1, 2}, {2, 2}, {3, 2}, {4, 2}},
+				{{2, 0}, {2, 1}, {2, 2}, {2, 3}, {2, 4}},
+				{{4, 2}, {3, 2}, {2, 2}, {1, 2}, {0, 2}},
+				{{2, 4}, {2, 3}, {2, 2}, {2, 1}, {2, 0}},
+			},
+			Color: [3]float64{0.7, 0.7, 1},
+			Glow:  0.1,
+			Kicks: "I5",
+			Spawn: Point{-2, -2},
+		},
+		{ // 11: Otra - Rojo Vermellón
+			Name: "V",
+			Rotations: [][]Point{
+				{{0, 2}, {1, 2}, {2, 2}, {0, 1}, {0, 0}},
+				{{0, 0}, {0, 1}, {0, 2}, {1, 0}, {2, 0}},
+				{{2, 0}, {1, 0}, {0, 0}, {2, 1}, {2, 2}},
+				{{2, 2}, {2, 1}, {2, 0}, {1, 2}, {0, 2}},
+			},
+			Color: [3]float64{0.7, 0.2, 0.8},
+			Glow:  0.1,
+			Kicks: "Pentomino",
+			Spawn: Point{-2, 0},
+		},
+	},
+}
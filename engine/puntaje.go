@@ -0,0 +1,239 @@
+package engine
+
+import "strconv"
+
+// .... Puntaje: líneas, T-spins, combos, back-to-back y perfect clears ....
+// Cada premio se avisa con EventAward y queda en Engine.Awards para que quien
+// dibuja muestre el cartelito.
+
+// .... Tabla de puntaje de la partida ....
+type ScoringKind int
+
+const (
+	ScoringClassic   ScoringKind = iota //La tabla de siempre de FETRIS, sin multiplicar por nivel
+	ScoringGuideline                    //La tabla de la guía moderna, todo por el nivel
+)
+
+// .... Puntos de cada premio ....
+type ScoreTable struct {
+	Lines           [6]int  //Líneas normales, por cantidad (la 5 vale para 5 o más)
+	TSpin           [4]int  //T-spin con 0 a 3 líneas
+	TSpinMini       [3]int  //T-spin mini con 0 a 2 líneas
+	PerfectClear    [6]int  //Bonus por dejar el tablero vacío, por cantidad de líneas
+	Combo           int     //Por cada paso del combo
+	BackToBack      float64 //Multiplicador de una línea difícil seguida de otra
+	SpecialLine     int     //Por cada línea especial
+	Lock            int     //Por lockear una pieza
+	SpecialLock     int     //Por lockear una pieza especial
+	SoftDrop        int     //Por fila bajada con caída rápida
+	HardDrop        int     //Por fila bajada con caída instantánea
+	LevelMultiplier bool    //Los premios de líneas se multiplican por el nivel
+}
+
+var scoreTables = map[ScoringKind]ScoreTable{
+	ScoringClassic: {
+		Lines:        [6]int{0, 100, 300, 500, 800, 1200},
+		TSpin:        [4]int{100, 400, 800, 1200},
+		TSpinMini:    [3]int{50, 150, 300},
+		PerfectClear: [6]int{0, 800, 1200, 1800, 2000, 2400},
+		Combo:        50,
+		BackToBack:   1.5,
+		SpecialLine:  200,
+		Lock:         10,
+		SpecialLock:  100,
+	},
+	ScoringGuideline: {
+		Lines:           [6]int{0, 100, 300, 500, 800, 1200},
+		TSpin:           [4]int{400, 800, 1200, 1600},
+		TSpinMini:       [3]int{100, 200, 400},
+		PerfectClear:    [6]int{0, 800, 1200, 1800, 2000, 3200},
+		Combo:           50,
+		BackToBack:      1.5,
+		SpecialLine:     200,
+		SpecialLock:     100,
+		SoftDrop:        1,
+		HardDrop:        2,
+		LevelMultiplier: true,
+	},
+}
+
+// .... Tipo de premio ....
+type AwardKind int
+
+const (
+	AwardLines        AwardKind = iota //Líneas sin giro
+	AwardTSpin                         //T-spin, con o sin líneas
+	AwardTSpinMini                     //T-spin mini
+	AwardCombo                         //Piezas seguidas haciendo líneas
+	AwardPerfectClear                  //Tablero vacío
+	AwardSpecialLine                   //Líneas especiales
+)
+
+// .... Un premio de un lock, con sus puntos ya calculados ....
+type Award struct {
+	Kind       AwardKind
+	Lines      int
+	Combo      int  //Paso del combo (1 = la segunda pieza seguida con líneas)
+	BackToBack bool //Llevaba back-to-back
+	Points     int
+}
+
+var lineNames = []string{"", "SIMPLE", "DOBLE", "TRIPLE", "TETRIS", "PENTRIS"}
+
+// .... Texto del premio para el cartelito ....
+func (a Award) Name() string {
+	lines := lineNames[capped(a.Lines, len(lineNames))]
+	name := ""
+	switch a.Kind {
+	case AwardLines:
+		name = lines
+	case AwardTSpin:
+		name = "T-SPIN " + lines
+	case AwardTSpinMini:
+		name = "T-SPIN MINI " + lines
+	case AwardCombo:
+		return "COMBO x" + strconv.Itoa(a.Combo)
+	case AwardPerfectClear:
+		return "PERFECT CLEAR"
+	case AwardSpecialLine:
+		return "LINEA ESPECIAL"
+	}
+	if a.BackToBack {
+		name = "B2B " + name
+	}
+	return name
+}
+
+// .... Giro detectado al lockear ....
+type spinKind int
+
+const (
+	spinNone spinKind = iota
+	spinMini
+	spinFull
+)
+
+// Esquinas de la caja 3x3 de la T que quedan frente a la punta, por rotación
+var tFrontCorners = [NumRotaciones][2]Point{
+	{{0, 0}, {2, 0}}, //Punta arriba
+	{{2, 0}, {2, 2}}, //Punta a la derecha
+	{{0, 2}, {2, 2}}, //Punta abajo
+	{{0, 0}, {0, 2}}, //Punta a la izquierda
+}
+
+// .... Regla de las 3 esquinas: la T rotó a su lugar y quedó encajada ....
+func (e *Engine) detectTSpin() spinKind {
+	piece := e.Pieces.Get(e.FallingCol)
+	if piece == nil || piece.Name != "T" || !e.lastRotated {
+		return spinNone
+	}
+
+	front := 0
+	for _, c := range tFrontCorners[e.FallingRotation] {
+		if e.cornerBlocked(c) {
+			front++
+		}
+	}
+	back := 0
+	for _, c := range []Point{{0, 0}, {2, 0}, {0, 2}, {2, 2}} {
+		if e.cornerBlocked(c) {
+			back++
+		}
+	}
+	back -= front
+
+	switch {
+	case front+back < 3:
+		return spinNone
+	case front == 2 || e.lastKick == 4:
+		//Con el último kick de la tabla (el que la mete de lado) también cuenta como T-spin completo
+		return spinFull
+	default:
+		return spinMini
+	}
+}
+
+// Una esquina cuenta como ocupada si hay un bloque o está fuera del tablero
+func (e *Engine) cornerBlocked(c Point) bool {
+	x := e.FallingX + c.X
+	y := e.FallingY + c.Y
+	if x < 0 || x >= e.Width() || y >= e.Height() {
+		return true
+	}
+	return y >= 0 && !e.Grid[y][x].Empty()
+}
+
+// .... Calcula y suma los premios de un lock (perfect: el tablero queda vacío) ....
+func (e *Engine) scoreClear(lines, specialLines int, spin spinKind, perfect bool) {
+	table := e.scoreTable()
+	level := 1
+	if table.LevelMultiplier {
+		level = e.Level
+	}
+
+	//Sin líneas se corta el combo; un T-spin sin líneas igual da puntos
+	if lines == 0 {
+		e.Combo = -1
+		switch spin {
+		case spinFull:
+			e.award(Award{Kind: AwardTSpin, Points: table.TSpin[0] * level})
+		case spinMini:
+			e.award(Award{Kind: AwardTSpinMini, Points: table.TSpinMini[0] * level})
+		}
+		return
+	}
+
+	clear := Award{Kind: AwardLines, Lines: lines}
+	switch spin {
+	case spinFull:
+		clear.Kind = AwardTSpin
+		clear.Points = table.TSpin[capped(lines, len(table.TSpin))]
+	case spinMini:
+		clear.Kind = AwardTSpinMini
+		clear.Points = table.TSpinMini[capped(lines, len(table.TSpinMini))]
+	default:
+		clear.Points = table.Lines[capped(lines, len(table.Lines))]
+	}
+
+	//Back-to-back: tetris o más, o cualquier T-spin con líneas, seguido de otro igual
+	difficult := lines >= 4 || spin != spinNone
+	if difficult && e.BackToBack {
+		clear.BackToBack = true
+		clear.Points = int(float64(clear.Points) * table.BackToBack)
+	}
+	e.BackToBack = difficult
+	clear.Points *= level
+	e.award(clear)
+
+	e.Combo++
+	if e.Combo > 0 {
+		e.award(Award{Kind: AwardCombo, Combo: e.Combo, Points: table.Combo * e.Combo * level})
+	}
+
+	if specialLines > 0 {
+		e.award(Award{Kind: AwardSpecialLine, Lines: specialLines, Points: table.SpecialLine * specialLines})
+	}
+
+	if perfect {
+		e.award(Award{Kind: AwardPerfectClear, Lines: lines, Points: table.PerfectClear[capped(lines, len(table.PerfectClear))] * level})
+	}
+}
+
+func (e *Engine) award(a Award) {
+	e.Score += a.Points
+	e.Awards = append(e.Awards, a)
+	e.emit(EventAward)
+}
+
+// Tabla de puntaje que eligió la configuración
+func (e *Engine) scoreTable() ScoreTable {
+	return scoreTables[e.Config.Scoring]
+}
+
+// Índice n en una tabla de largo size: lo que pasa del final usa el último valor
+func capped(n, size int) int {
+	if n >= size {
+		return size - 1
+	}
+	return n
+}
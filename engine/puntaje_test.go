@@ -0,0 +1,160 @@
+package engine
+
+import "testing"
+
+// .... Regla de las 3 esquinas, en tableros armados a mano ....
+func TestDetectTSpin(t *testing.T) {
+	bottom := GridHeight - 1
+	tests := []struct {
+		name    string
+		rot     int     //Rotación de la T (0 punta arriba, 2 punta abajo)
+		y       int     //Fila de arriba de la caja 3x3
+		blocks  []Point //Bloques del tablero además de la fila de abajo
+		rotated bool
+		kick    int
+		want    spinKind
+	}{
+		//Punta abajo en el hueco de una doble: las dos esquinas del frente y una de atrás
+		{"doble", 2, bottom - 2, []Point{{3, bottom - 2}}, true, 0, spinFull},
+		{"doble cerrada", 2, bottom - 2, []Point{{3, bottom - 2}, {5, bottom - 2}}, true, 0, spinFull},
+		{"sin rotar", 2, bottom - 2, []Point{{3, bottom - 2}}, false, 0, spinNone},
+		{"dos esquinas", 2, bottom - 2, nil, true, 0, spinNone},
+		//Punta arriba contra el piso: el piso tapa las de atrás y solo una del frente
+		{"mini", 0, bottom - 1, []Point{{3, bottom - 1}}, true, 0, spinMini},
+		{"mini con el kick de lado", 0, bottom - 1, []Point{{3, bottom - 1}}, true, 4, spinFull},
+		{"mini con otra tabla o media vuelta", 0, bottom - 1, []Point{{3, bottom - 1}}, true, -1, spinMini},
+		{"piso solo", 0, bottom - 1, nil, true, 4, spinNone},
+	}
+	for _, tt := range tests {
+		e := newTestEngine(t, ModeMarathon)
+		placeTest(t, e, "T")
+		if tt.rot == 2 {
+			//La fila de abajo llena salvo la punta de la T
+			fillRow(e, bottom, 4)
+		}
+		for _, b := range tt.blocks {
+			e.Grid[b.Y][b.X] = Cell{Piece: GarbagePiece, Flags: CellGarbage}
+		}
+		e.FallingX, e.FallingY, e.FallingRotation = 3, tt.y, tt.rot
+		if !e.canMove(0, 0) {
+			t.Fatalf("%s: la T no cabe en el tablero armado", tt.name)
+		}
+		e.lastRotated, e.lastKick = tt.rotated, tt.kick
+		if got := e.detectTSpin(); got != tt.want {
+			t.Fatalf("%s: salió el giro %d, tenía que ser %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+// .... Los kicks de media vuelta o de otra tabla no marcan el kick del T-spin ....
+func TestTSpinKickTable(t *testing.T) {
+	e := newTestEngine(t, ModeMarathon)
+	placeTest(t, e, "T")
+	e.FallingY += 5
+	if !e.rotate(Rotate180) || e.lastKick != -1 {
+		t.Fatalf("media vuelta dejó el kick %d", e.lastKick)
+	}
+	if !e.rotate(RotateCW) || e.lastKick != 0 {
+		t.Fatalf("un cuarto en campo abierto dejó el kick %d", e.lastKick)
+	}
+
+	placeTest(t, e, "I")
+	e.FallingY += 5
+	if !e.rotate(RotateCW) || e.lastKick != -1 {
+		t.Fatalf("la I con su tabla dejó el kick %d", e.lastKick)
+	}
+}
+
+// .... Combos y back-to-back a lo largo de varios locks ....
+func TestComboBackToBack(t *testing.T) {
+	table := scoreTables[ScoringClassic]
+	b2b := func(points int) int { return int(float64(points) * table.BackToBack) }
+	steps := []struct {
+		lines  int
+		spin   spinKind
+		points int
+		b2b    bool
+		combo  int
+	}{
+		{4, spinNone, table.Lines[4], true, 0},
+		{4, spinNone, b2b(table.Lines[4]) + table.Combo, true, 1},
+		{1, spinNone, table.Lines[1] + 2*table.Combo, false, 2},
+		{2, spinFull, table.TSpin[2] + 3*table.Combo, true, 3},
+		{1, spinMini, b2b(table.TSpinMini[1]) + 4*table.Combo, true, 4},
+		{0, spinNone, 0, true, -1},
+		{0, spinFull, table.TSpin[0], true, -1},
+		{1, spinNone, table.Lines[1], false, 0},
+	}
+
+	e := newTestEngine(t, ModeMarathon)
+	for i, s := range steps {
+		score := e.Score
+		e.scoreClear(s.lines, 0, s.spin, false)
+		if got := e.Score - score; got != s.points {
+			t.Fatalf("paso %d: sumó %d puntos, tenían que ser %d", i, got, s.points)
+		}
+		if e.BackToBack != s.b2b || e.Combo != s.combo {
+			t.Fatalf("paso %d: back-to-back %v y combo %d, tenían que ser %v y %d", i, e.BackToBack, e.Combo, s.b2b, s.combo)
+		}
+	}
+}
+
+// .... Premios de un solo lock: perfect clear, nivel y líneas especiales ....
+func TestScoreClear(t *testing.T) {
+	classic, guideline := scoreTables[ScoringClassic], scoreTables[ScoringGuideline]
+	tests := []struct {
+		name    string
+		scoring ScoringKind
+		level   int
+		lines   int
+		special int
+		empty   bool //El tablero queda vacío después de las líneas
+		want    int
+	}{
+		{"simple", ScoringClassic, 1, 1, 0, false, classic.Lines[1]},
+		{"clásico no multiplica", ScoringClassic, 5, 2, 0, false, classic.Lines[2]},
+		{"guía multiplica", ScoringGuideline, 3, 2, 0, false, 3 * guideline.Lines[2]},
+		{"una especial", ScoringClassic, 1, 1, 1, false, classic.Lines[1] + classic.SpecialLine},
+		{"dos especiales", ScoringClassic, 1, 3, 2, false, classic.Lines[3] + 2*classic.SpecialLine},
+		{"especial sin nivel", ScoringGuideline, 4, 1, 1, false, 4*guideline.Lines[1] + guideline.SpecialLine},
+		{"perfect clear", ScoringClassic, 1, 4, 0, true, classic.Lines[4] + classic.PerfectClear[4]},
+		{"perfect clear por nivel", ScoringGuideline, 2, 1, 0, true, 2 * (guideline.Lines[1] + guideline.PerfectClear[1])},
+	}
+	for _, tt := range tests {
+		e := New()
+		e.Config.Scoring = tt.scoring
+		e.Start(1)
+		e.Level = tt.level
+		e.scoreClear(tt.lines, tt.special, spinNone, tt.empty)
+		if e.Score != tt.want {
+			t.Fatalf("%s: %d puntos, tenían que ser %d", tt.name, e.Score, tt.want)
+		}
+	}
+}
+
+// .... Al limpiarla, una línea con bloques multicolor suma su bonus una sola vez ....
+func TestSpecialLine(t *testing.T) {
+	e := newTestEngine(t, ModeMarathon)
+	rainbow := 0
+	for i, p := range e.Pieces.Pieces {
+		if p.Rainbow {
+			rainbow = i + 1
+		}
+	}
+	if rainbow == 0 {
+		t.Skip("el set por defecto no trae pieza multicolor")
+	}
+	placeTest(t, e, "O")
+	cols := fallingColumns(e)
+	bottom := e.Height() - 1
+	fillRow(e, bottom, cols...)
+	fillRow(e, bottom-1, cols...)
+	e.Grid[bottom][0] = Cell{Piece: rainbow}
+	e.Grid[bottom-2][0] = Cell{Piece: GarbagePiece, Flags: CellGarbage}
+
+	e.Step(InputHardDrop)
+	table := scoreTables[ScoringClassic]
+	if want := table.Lines[2] + table.SpecialLine + table.Lock; e.Score != want {
+		t.Fatalf("puntaje %d, tenía que ser %d", e.Score, want)
+	}
+}
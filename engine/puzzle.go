@@ -0,0 +1,228 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// .... Puzzles: un tablero armado, piezas contadas y una meta ....
+// El tablero y la cola salen del archivo del puzzle en vez del azar. Se resuelve
+// apenas se cumple la meta; si se acaban las piezas antes, se pierde.
+type PuzzleGoalKind int
+
+const (
+	PuzzleClear PuzzleGoalKind = iota //Dejar el tablero vacío
+	PuzzleLines                       //Hacer Target líneas
+	PuzzleTSpin                       //Un T-spin de Target líneas
+)
+
+// En los archivos de puzzles la meta va con su nombre
+var puzzleGoalNames = map[PuzzleGoalKind]string{
+	PuzzleClear: "limpiar",
+	PuzzleLines: "lineas",
+	PuzzleTSpin: "tspin",
+}
+
+func (k PuzzleGoalKind) MarshalJSON() ([]byte, error) {
+	return json.Marshal(puzzleGoalNames[k])
+}
+
+func (k *PuzzleGoalKind) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	for kind, n := range puzzleGoalNames {
+		if n == name {
+			*k = kind
+			return nil
+		}
+	}
+	return fmt.Errorf("meta de puzzle desconocida %q", name)
+}
+
+// .... Meta de un puzzle ....
+type PuzzleGoal struct {
+	Kind   PuzzleGoalKind
+	Target int //No se usa en limpiar
+}
+
+// .... Definición de un puzzle ....
+type Puzzle struct {
+	Name  string
+	Hint  string     //Ayuda que se muestra al elegirlo
+	Board []string   //Filas de abajo del tablero, la última es la del fondo: '.' vacía, 'X' basura o la letra de una pieza
+	Queue []string   //Nombres de las piezas, en el orden en que salen
+	Goal  PuzzleGoal //Qué hay que hacer con ellas
+}
+
+// .... Revisa que el puzzle se pueda jugar con el set de piezas dado ....
+func (p *Puzzle) Validate(set *PieceSet) error {
+	if len(p.Queue) == 0 {
+		return fmt.Errorf("el puzzle %q no tiene piezas", p.Name)
+	}
+	if len(p.Board) > MaxBoardSize {
+		return fmt.Errorf("el puzzle %q tiene %d filas, el máximo es %d", p.Name, len(p.Board), MaxBoardSize)
+	}
+	//Todas las filas del mismo ancho, que pasa a ser el del tablero
+	width := p.Width()
+	if width < MinBoardSize || width > MaxBoardSize {
+		return fmt.Errorf("el puzzle %q tiene %d columnas, deben ser entre %d y %d", p.Name, width, MinBoardSize, MaxBoardSize)
+	}
+	for i, row := range p.Board {
+		runes := []rune(row)
+		if len(runes) != width {
+			return fmt.Errorf("la fila %d del puzzle %q tiene %d celdas, deben ser %d", i+1, p.Name, len(runes), width)
+		}
+		for _, c := range runes {
+			if _, ok := boardCell(set, c); !ok {
+				return fmt.Errorf("el puzzle %q usa una celda desconocida %q", p.Name, c)
+			}
+		}
+	}
+	for _, name := range p.Queue {
+		if set.Find(name) == 0 {
+			return fmt.Errorf("el puzzle %q usa una pieza que no está en el set: %q", p.Name, name)
+		}
+	}
+	if p.Goal.Kind != PuzzleClear && p.Goal.Target <= 0 {
+		return fmt.Errorf("el puzzle %q tiene una meta de %s sin cantidad", p.Name, puzzleGoalNames[p.Goal.Kind])
+	}
+	return nil
+}
+
+// .... Ancho del tablero del puzzle: el de sus filas, o el de siempre si no trae tablero ....
+func (p *Puzzle) Width() int {
+	if len(p.Board) == 0 {
+		return GridWidth
+	}
+	return len([]rune(p.Board[0]))
+}
+
+// Celda del tablero que representa un carácter del archivo
+func boardCell(set *PieceSet, c rune) (Cell, bool) {
+	switch c {
+	case '.', ' ':
+		return Cell{}, true
+	case 'X', '#':
+		return Cell{Piece: GarbagePiece, Flags: CellGarbage}, true
+	}
+	if id := set.Find(string(c)); id != 0 {
+		return Cell{Piece: id, Flags: CellGarbage}, true
+	}
+	return Cell{}, false
+}
+
+// .... Carga un puzzle desde un JSON ....
+func LoadPuzzle(path string) (*Puzzle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error al abrir el puzzle %s: %w", path, err)
+	}
+
+	p := &Puzzle{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("error al leer el puzzle %s: %w", path, err)
+	}
+	if p.Name == "" {
+		p.Name = filepath.Base(path)
+	}
+	return p, nil
+}
+
+// .... Carga todos los puzzles de una carpeta, en orden de nombre de archivo ....
+func LoadPuzzles(dir string) ([]*Puzzle, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	var puzzles []*Puzzle
+	for _, path := range paths {
+		p, err := LoadPuzzle(path)
+		if err != nil {
+			return nil, err
+		}
+		puzzles = append(puzzles, p)
+	}
+	return puzzles, nil
+}
+
+// .... Arma el tablero del puzzle al empezar la partida ....
+func (e *Engine) loadPuzzle() {
+	e.puzzleNext = 0
+	//Las filas del puzzle van abajo; si el tablero es más bajo, sobran las de arriba
+	top := e.Height() - len(e.Puzzle.Board)
+	for i, row := range e.Puzzle.Board {
+		if top+i < 0 {
+			continue
+		}
+		for x, c := range []rune(row) {
+			if x < e.Width() {
+				e.Grid[top+i][x], _ = boardCell(e.Pieces, c)
+			}
+		}
+	}
+}
+
+// ¿Juega el puzzle? (el modo puzzle sin uno elegido juega con piezas al azar)
+func (e *Engine) puzzling() bool {
+	return e.Puzzle != nil && e.ModeRules().Puzzle
+}
+
+// Siguiente pieza de la cola del puzzle, 0 cuando ya no quedan
+func (e *Engine) puzzlePiece() int {
+	if e.puzzleNext >= len(e.Puzzle.Queue) {
+		return 0
+	}
+	id := e.Pieces.Find(e.Puzzle.Queue[e.puzzleNext])
+	e.puzzleNext++
+	return id
+}
+
+// .... Después de cada lock y de cada limpieza: ¿se resolvió, o ya no quedan piezas? ....
+func (e *Engine) checkPuzzle() {
+	if !e.puzzling() || e.Over {
+		return
+	}
+
+	goal := e.Puzzle.Goal
+	solved := false
+	switch goal.Kind {
+	case PuzzleClear:
+		solved = e.hasAward(AwardPerfectClear, 0)
+	case PuzzleLines:
+		solved = e.Lines >= goal.Target
+	case PuzzleTSpin:
+		solved = e.hasAward(AwardTSpin, goal.Target)
+	}
+
+	if solved {
+		e.finish()
+	} else if e.NextPieces[0] == 0 && e.HeldPiece == 0 && !e.Clearing() {
+		//Sin piezas en la cola ni en el hold ya no hay cómo, salvo que falte terminar una cadena
+		e.gameOver()
+	}
+}
+
+// ¿Este tick dio un premio de ese tipo con al menos esas líneas?
+func (e *Engine) hasAward(kind AwardKind, lines int) bool {
+	for _, a := range e.Awards {
+		if a.Kind == kind && a.Lines >= lines {
+			return true
+		}
+	}
+	return false
+}
+
+// .... Piezas del puzzle ya lockeadas y cuántas trae en total ....
+func (e *Engine) PuzzleProgress() (used, total int) {
+	if e.Puzzle == nil {
+		return 0, 0
+	}
+	return e.Locks, len(e.Puzzle.Queue)
+}
@@ -0,0 +1,56 @@
+package engine
+
+import "testing"
+
+// .... Un puzzle que se resuelve con la cadena, no con el lock ....
+// La I completa la fila del medio; al irse, el bloque suelto cae y llena la de abajo.
+// Con cascada son las 2 líneas de la meta; con la gravedad de siempre no alcanza.
+func TestPuzzleChain(t *testing.T) {
+	puzzle := &Puzzle{
+		Name: "cadena",
+		Board: []string{
+			"X.........",
+			"XXXXXX....",
+			".XXXXXXXXX",
+		},
+		Queue: []string{"I"},
+		Goal:  PuzzleGoal{Kind: PuzzleLines, Target: 2},
+	}
+	if err := puzzle.Validate(DefaultPieces); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		gravity GravityKind
+		solved  bool
+	}{
+		{GravityCascade, true},
+		{GravitySticky, true},
+		{GravityNaive, false},
+	}
+	for _, tt := range tests {
+		e := New()
+		e.Config.Mode = ModePuzzle
+		e.Config.Gravity = tt.gravity
+		e.Puzzle = puzzle
+		e.Start(1)
+
+		for e.canMove(1, 0) {
+			e.FallingX++
+		}
+		e.Step(InputHardDrop)
+		if e.Over {
+			t.Fatalf("gravedad %d: la partida terminó al lockear, antes de la limpieza", tt.gravity)
+		}
+		if !e.Clearing() {
+			t.Fatalf("gravedad %d: la I no completó la fila", tt.gravity)
+		}
+
+		for i := 0; i < 10*e.Config.LineClearDelay && !e.Over; i++ {
+			e.Step(0)
+		}
+		if !e.Over || e.Finished != tt.solved {
+			t.Fatalf("gravedad %d: con %d líneas quedó Over %v Finished %v", tt.gravity, e.Lines, e.Over, e.Finished)
+		}
+	}
+}
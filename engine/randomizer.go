@@ -0,0 +1,131 @@
+package engine
+
+// .... Cómo se eligen las piezas de la cola ....
+type RandomizerKind int
+
+const (
+	RandomizerPure    RandomizerKind = iota //Cada pieza al azar, sin memoria (puede haber sequías largas)
+	RandomizerBag                           //Bolsa con todas las piezas del set, se saca sin reponer
+	RandomizerHistory                       //Estilo TGM: se re-tira si la pieza salió hace poco
+)
+
+// .... Generador de la siguiente pieza, devuelve ids de 1 a n ....
+// Todo el azar sale del RNG de la partida, así la semilla decide la secuencia.
+type Randomizer interface {
+	Next(rng *RNG) int
+	State() []int //Lo que recuerda entre pieza y pieza (la bolsa, el historial), para la huella
+	Clone() Randomizer //Copia con su propio estado (la bolsa, el historial)
+}
+
+// .... Crea el randomizer que pide la configuración para un set de n piezas ....
+func NewRandomizer(config Config, n int) Randomizer {
+	switch config.Randomizer {
+	case RandomizerBag:
+		copies := config.BagCopies
+		if copies < 1 {
+			copies = 1
+		}
+		return &bagRandomizer{n: n, copies: copies}
+	case RandomizerHistory:
+		return &historyRandomizer{
+			n:       n,
+			rerolls: config.HistoryRerolls,
+			history: make([]int, config.HistorySize),
+		}
+	default:
+		return &pureRandomizer{n: n}
+	}
+}
+
+// .... Puro azar, como el FETRIS original ....
+type pureRandomizer struct {
+	n int
+}
+
+func (r *pureRandomizer) Next(rng *RNG) int {
+	return rng.Intn(r.n) + 1
+}
+
+func (r *pureRandomizer) State() []int {
+	return nil
+}
+
+func (r *pureRandomizer) Clone() Randomizer {
+	c := *r
+	return &c
+}
+
+// .... Bolsa de N: cada pieza del set aparece 'copies' veces por bolsa ....
+type bagRandomizer struct {
+	n      int
+	copies int
+	bag    []int
+}
+
+func (r *bagRandomizer) Next(rng *RNG) int {
+	//Bolsa vacía: se llena con todas las piezas y se revuelve
+	if len(r.bag) == 0 {
+		for c := 0; c < r.copies; c++ {
+			for id := 1; id <= r.n; id++ {
+				r.bag = append(r.bag, id)
+			}
+		}
+		rng.Shuffle(len(r.bag), func(i, j int) {
+			r.bag[i], r.bag[j] = r.bag[j], r.bag[i]
+		})
+	}
+
+	id := r.bag[0]
+	r.bag = r.bag[1:]
+	return id
+}
+
+func (r *bagRandomizer) State() []int {
+	return r.bag
+}
+
+func (r *bagRandomizer) Clone() Randomizer {
+	c := *r
+	c.bag = append([]int(nil), r.bag...)
+	return &c
+}
+
+// .... Historial estilo TGM: hasta 'rerolls' intentos de sacar una pieza que no esté en el historial ....
+type historyRandomizer struct {
+	n       int
+	rerolls int
+	history []int //Últimas piezas entregadas, 0 = hueco vacío
+}
+
+func (r *historyRandomizer) Next(rng *RNG) int {
+	id := rng.Intn(r.n) + 1
+	for i := 1; i < r.rerolls && r.inHistory(id); i++ {
+		id = rng.Intn(r.n) + 1
+	}
+
+	//La más vieja sale del historial
+	if len(r.history) > 0 {
+		copy(r.history, r.history[1:])
+		r.history[len(r.history)-1] = id
+	}
+	return id
+}
+
+func (r *historyRandomizer) State() []int {
+	return r.history
+}
+
+func (r *historyRandomizer) Clone() Randomizer {
+	c := *r
+	c.history = append([]int(nil), r.history...)
+	return &c
+}
+
+func (r *historyRandomizer) inHistory(id int) bool {
+	for _, h := range r.history {
+		if h == id {
+			return true
+		}
+	}
+	return false
+}
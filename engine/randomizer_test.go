@@ -0,0 +1,75 @@
+package engine
+
+import "testing"
+
+// .... Cada bolsa trae todas las piezas del set, 'copies' veces cada una ....
+func TestBag(t *testing.T) {
+	const n = 7
+	for _, copies := range []int{1, 2} {
+		r := NewRandomizer(Config{Randomizer: RandomizerBag, BagCopies: copies}, n)
+		rng := NewRNG(3)
+		for bag := 0; bag < 50; bag++ {
+			count := make([]int, n+1)
+			for i := 0; i < n*copies; i++ {
+				id := r.Next(&rng)
+				if id < 1 || id > n {
+					t.Fatalf("copias %d: salió la pieza %d, fuera del set", copies, id)
+				}
+				count[id]++
+			}
+			for id := 1; id <= n; id++ {
+				if count[id] != copies {
+					t.Fatalf("copias %d, bolsa %d: la pieza %d salió %d veces", copies, bag, id, count[id])
+				}
+			}
+		}
+	}
+}
+
+// .... Por defecto las piezas salen al azar, como en el FETRIS original ....
+func TestDefaultRandomizer(t *testing.T) {
+	if DefaultConfig().Randomizer != RandomizerPure {
+		t.Fatalf("el randomizer por defecto es %d, tenía que ser el azar puro", DefaultConfig().Randomizer)
+	}
+	e := newTestEngine(t, ModeMarathon)
+	if _, pure := e.randomizer.(*pureRandomizer); !pure {
+		t.Fatalf("el motor arrancó con el randomizer %T", e.randomizer)
+	}
+}
+
+// .... Los modos que la piden usan la bolsa, los demás lo que diga la configuración ....
+func TestModeRandomizer(t *testing.T) {
+	for mode := ModeKind(0); mode < NumModes; mode++ {
+		e := newTestEngine(t, mode)
+		_, bag := e.randomizer.(*bagRandomizer)
+		if bag != Rules(mode).Bag {
+			t.Fatalf("%s: bolsa %v, las reglas piden %v", Rules(mode).Name, bag, Rules(mode).Bag)
+		}
+	}
+}
+
+// .... La copia sigue la misma secuencia sin tocar la bolsa ni el historial del original ....
+func TestRandomizerClone(t *testing.T) {
+	configs := []Config{
+		{Randomizer: RandomizerBag, BagCopies: 1},
+		{Randomizer: RandomizerHistory, HistorySize: 4, HistoryRerolls: 4},
+	}
+	for _, config := range configs {
+		r := NewRandomizer(config, 7)
+		rng := NewRNG(5)
+		for i := 0; i < 3; i++ {
+			r.Next(&rng)
+		}
+
+		c, cloneRNG := r.Clone(), rng
+		var want []int
+		for i := 0; i < 20; i++ {
+			want = append(want, c.Next(&cloneRNG))
+		}
+		for i, id := range want {
+			if got := r.Next(&rng); got != id {
+				t.Fatalf("randomizer %d: en la pieza %d el original sacó %d y la copia %d", config.Randomizer, i, got, id)
+			}
+		}
+	}
+}
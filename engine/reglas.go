@@ -0,0 +1,248 @@
+package engine
+
+// .... Colisión: ¿puede moverse la pieza que cae en (dx, dy)? ....
+func (e *Engine) canMove(dx, dy int) bool {
+	//Obtenemos la forma del tetromino actual con su rotación correspondiente
+	if blocks := e.Pieces.Shape(e.FallingCol, e.FallingRotation); len(blocks) > 0 {
+		return e.fits(blocks, e.FallingX+dx, e.FallingY+dy)
+	}
+
+	return false
+}
+
+// .... ¿Caben estos bloques con el origen de la pieza en (px, py)? ....
+func (e *Engine) fits(blocks []Point, px, py int) bool {
+	for _, block := range blocks {
+		x := px + block.X
+		y := py + block.Y
+
+		//Verificamos límites del grid (importante)
+		if x < 0 || x >= e.Width() || y >= e.Height() {
+			return false
+		}
+
+		//Aquí es verificar colisión con otras piezas (sin dividir la pieza)
+		if y >= 0 && !e.Grid[y][x].Empty() {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (e *Engine) lockPiece() {
+	//Obtenemos la forma actual según la rotación
+	currentShape := e.Pieces.Shape(e.FallingCol, e.FallingRotation)
+	table := e.scoreTable()
+
+	//El T-spin se mira con la pieza todavía en su lugar
+	spin := e.detectTSpin()
+
+	//Verificamos si toda la pieza puede ser colocada
+	canLock := true
+	for _, block := range currentShape {
+		newX := e.FallingX + block.X
+		newY := e.FallingY + block.Y
+
+		//Importante: límites y colisiones
+		if newX < 0 || newX >= e.Width() || newY >= e.Height() {
+			canLock = false
+			break
+		}
+		if newY >= 0 && !e.Grid[newY][newX].Empty() {
+			canLock = false
+			break
+		}
+	}
+
+	//Si no se puede colocar, ajustar la posición Y hacia arriba
+	if !canLock {
+		e.FallingY--
+	}
+
+	//Colocamos la pieza completa en su posición final, cada celda recuerda su pieza y su marca
+	for _, block := range currentShape {
+		newX := e.FallingX + block.X
+		newY := e.FallingY + block.Y
+
+		if newY >= 0 {
+			e.Grid[newY][newX] = Cell{Piece: e.FallingCol, Mark: e.FallingSpecial, LockedAt: e.Ticks}
+		}
+	}
+
+	//Verificar si la pieza es especial para el sonido combo y sus puntos
+	if e.FallingSpecial != MarkNone {
+		e.emit(EventSpecial)
+		e.Score += table.SpecialLock
+		e.LevelSpecials++
+	}
+
+	//puntos por lockear pieza normal
+	e.Score += table.Lock
+	e.Locks++
+
+	//La siguiente pieza ya puede usar el hold
+	e.holdUsed = false
+
+	e.emit(EventLock)
+	e.checkAndClearMatches(spin)
+	e.checkPuzzle()
+}
+
+// .... Función para chequear si un nivel está completo: todos sus objetivos cumplidos ....
+// Los modos sin tabla de niveles suben cada tantas líneas, o nunca.
+func (e *Engine) checkLevelComplete() bool {
+	if mode := e.ModeRules(); !mode.Objectives {
+		return mode.LinesPerLevel > 0 && e.Lines >= e.Level*mode.LinesPerLevel
+	}
+	for _, o := range e.LevelGoals() {
+		if progress, target := e.Goal(o); progress < target {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *Engine) nextLevel() {
+	e.Level++
+	e.startLevel()
+	e.Gravity = e.levelGravity()
+	e.emit(EventLevelUp)
+}
+
+func (e *Engine) gameOver() {
+	e.Over = true
+	e.emit(EventGameOver)
+}
+
+// Verificamos si una línea (de las que se chequean) es especial: tiene algún bloque
+// con marca (de una pieza especial) o de la pieza multicolor. Que esté llena no
+// basta, toda línea que se limpia lo está.
+func (e *Engine) checkSpecialLine(y int) bool {
+	for _, cell := range e.Grid[y] {
+		if cell.Mark != MarkNone {
+			return true
+		}
+		if piece := e.Pieces.Get(cell.Piece); piece != nil && piece.Rainbow {
+			return true
+		}
+	}
+	return false
+}
+
+// ....Función para chequear y limpiar líneas completas ....
+func (e *Engine) checkAndClearMatches(spin spinKind) {
+	//Los puntos los pone la tabla de puntaje activa (ver puntaje.go): líneas, T-spins,
+	//combos, back-to-back, perfect clear y el bonus de las líneas especiales
+	rows := e.fullRows()
+	e.clearLines(rows, spin)
+
+	//Si la pieza no hizo líneas, la basura pendiente entra
+	if len(rows) == 0 {
+		e.riseGarbage()
+	}
+}
+
+// .... Puntaje y limpieza de las filas llenas (también las de una cadena) ....
+func (e *Engine) clearLines(rows []int, spin spinKind) {
+	e.LevelLines += len(rows)
+	e.Lines += len(rows)
+	specialLines := 0
+	for _, y := range rows {
+		if e.checkSpecialLine(y) {
+			specialLines++
+		}
+	}
+
+	//Calcular puntaje (el bonus de línea especial va una sola vez por línea)
+	first := len(e.Awards)
+	e.scoreClear(len(rows), specialLines, spin, e.emptyWithout(rows))
+	e.counterGarbage(len(rows), e.Awards[first:])
+	if len(rows) > 0 {
+		e.emit(EventMatch)
+		// Eliminar las líneas, después del delay de limpieza si hay
+		e.startClear(rows)
+	}
+	e.checkLineGoal()
+}
+
+func (e *Engine) spawnPiece() {
+	//Usa la primera pieza del preview
+	col, special := e.NextPieces[0], e.NextSpecial[0]
+
+	//Con la cola del puzzle agotada sale la pieza guardada
+	if col == 0 && e.HeldPiece != 0 {
+		col, special = e.HeldPiece, e.HeldSpecial
+		e.HeldPiece, e.HeldSpecial = 0, MarkNone
+	}
+
+	//Esto hace que se muevan todas las piezas una posición
+	for i := 0; i < NumPreview-1; i++ {
+		e.NextPieces[i] = e.NextPieces[i+1]
+		e.NextSpecial[i] = e.NextSpecial[i+1]
+	}
+
+	//Genera nueva pieza para el último espacio
+	e.NextPieces[NumPreview-1], e.NextSpecial[NumPreview-1] = e.randomPiece()
+
+	e.placePiece(col, special)
+}
+
+// .... Pone una pieza arriba del tablero como la pieza que cae ....
+func (e *Engine) placePiece(col int, special Mark) {
+	e.FallingCol = col
+	e.FallingSpecial = special
+
+	//Cada pieza define dónde aparece respecto al centro de arriba
+	spawn := e.Pieces.Get(e.FallingCol).Spawn
+	e.FallingX = e.Width()/2 + spawn.X
+	e.FallingY = spawn.Y
+	e.FallingRotation = 0
+	e.lastRotated = false
+	e.fallAccum = 0
+	e.clearLockDelay()
+
+	//Verifica Game Over
+	if !e.canMove(0, 0) {
+		e.topOut()
+		return
+	}
+	e.dropOnSpawn()
+}
+
+// .... Guarda la pieza que cae y saca la guardada (o la siguiente de la cola) ....
+func (e *Engine) holdPiece() {
+	//Solo una vez por pieza, se libera al lockear
+	if e.holdUsed {
+		return
+	}
+	//Tampoco si no hay con qué reemplazarla (cola del puzzle agotada)
+	if e.HeldPiece == 0 && e.NextPieces[0] == 0 {
+		return
+	}
+	e.holdUsed = true
+
+	held, heldSpecial := e.HeldPiece, e.HeldSpecial
+	e.HeldPiece, e.HeldSpecial = e.FallingCol, e.FallingSpecial
+	e.emit(EventHold)
+
+	if held == 0 {
+		//Slot vacío: sale la siguiente pieza de la cola
+		e.spawnPiece()
+	} else {
+		e.placePiece(held, heldSpecial)
+	}
+}
+
+// .... Pieza al azar del set activo, y si viene especial con qué marca ....
+func (e *Engine) randomPiece() (int, Mark) {
+	//En un puzzle las piezas vienen contadas y sin marca
+	if e.puzzling() {
+		return e.puzzlePiece(), MarkNone
+	}
+	col := e.randomizer.Next(&e.rng)
+	if e.rng.Float64() < ProbabiliSpecialPiece {
+		return col, MarkStar + Mark(e.rng.Intn(int(numMarks-MarkStar)))
+	}
+	return col, MarkNone
+}
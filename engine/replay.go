@@ -0,0 +1,165 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// .... Repeticiones (replays) ....
+// Como el motor es determinista, para repetir una partida basta con la semilla,
+// las reglas, el set de piezas y lo que se apretó en cada tick. Los ticks seguidos
+// con la misma entrada se guardan juntos, así un replay de varios minutos pesa poco.
+
+// Versión del formato y de las reglas: si cambia cómo juega el motor, se sube,
+// y los replays viejos se rechazan en vez de mostrar otra partida
+const ReplayVersion = 5
+
+// .... Entrada repetida Count ticks seguidos ....
+type InputRun struct {
+	Input Input
+	Count int
+}
+
+// En el archivo se escribe corto, como [entrada, ticks]
+func (r InputRun) MarshalJSON() ([]byte, error) {
+	return json.Marshal([2]int{int(r.Input), r.Count})
+}
+
+func (r *InputRun) UnmarshalJSON(data []byte) error {
+	var pair [2]int
+	if err := json.Unmarshal(data, &pair); err != nil {
+		return err
+	}
+	r.Input, r.Count = Input(pair[0]), pair[1]
+	return nil
+}
+
+// .... Todo lo necesario para volver a jugar una partida ....
+type Replay struct {
+	Version int
+	Player  string //Quién jugó, lo llena quien graba
+	Seed    int64
+	Config  Config
+	Pieces  *PieceSet   `json:",omitempty"` //Solo si no es el set por defecto
+	Levels  *LevelTable `json:",omitempty"` //Solo si no es la tabla por defecto
+	Puzzle  *Puzzle     `json:",omitempty"` //Solo en el modo puzzle
+	Ticks   int         //Ticks grabados en total
+	Inputs  []InputRun
+}
+
+// .... Empieza a grabar la partida que el motor acaba de iniciar ....
+func NewReplay(e *Engine) *Replay {
+	r := &Replay{
+		Version: ReplayVersion,
+		Seed:    e.Seed,
+		Config:  e.Config,
+		Puzzle:  e.Puzzle,
+	}
+	//Los sets por defecto no se guardan, al cargar se usan los de este FETRIS
+	if e.Pieces != DefaultPieces {
+		r.Pieces = e.Pieces
+	}
+	if e.Levels != DefaultLevels {
+		r.Levels = e.Levels
+	}
+	return r
+}
+
+// Agrega la entrada de un tick
+func (r *Replay) Record(in Input) {
+	r.Ticks++
+	if n := len(r.Inputs); n > 0 && r.Inputs[n-1].Input == in {
+		r.Inputs[n-1].Count++
+		return
+	}
+	r.Inputs = append(r.Inputs, InputRun{Input: in, Count: 1})
+}
+
+// .... Guarda y carga replays en JSON ....
+func (r *Replay) Save(path string) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func LoadReplay(path string) (*Replay, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error al abrir el replay %s: %w", path, err)
+	}
+
+	r := &Replay{}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("error al leer el replay %s: %w", path, err)
+	}
+	if r.Version != ReplayVersion {
+		return nil, fmt.Errorf("el replay %s es de la versión %d, este FETRIS juega la %d", path, r.Version, ReplayVersion)
+	}
+	if r.Pieces == nil {
+		r.Pieces = DefaultPieces
+	}
+	if err := r.Pieces.Validate(); err != nil {
+		return nil, err
+	}
+	if r.Levels == nil {
+		r.Levels = DefaultLevels
+	}
+	if err := r.Levels.Validate(); err != nil {
+		return nil, err
+	}
+	if r.Puzzle != nil {
+		if err := r.Puzzle.Validate(r.Pieces); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// .... Reproduce un replay en un motor propio, un tick a la vez ....
+type ReplayPlayer struct {
+	Engine *Engine
+	Tick   int //Ticks ya reproducidos
+
+	replay *Replay
+	run    int //Tramo de entradas actual
+	inRun  int //Ticks ya usados del tramo
+}
+
+// Crea el motor con las reglas del replay y lo deja listo en el tick 0
+func NewReplayPlayer(r *Replay) (*ReplayPlayer, []Event) {
+	e := New()
+	e.Config = r.Config
+	e.Pieces = r.Pieces
+	e.Levels = r.Levels
+	e.Puzzle = r.Puzzle
+	events := e.Start(r.Seed)
+	return &ReplayPlayer{Engine: e, replay: r}, events
+}
+
+// Avanza un tick con la entrada grabada
+func (p *ReplayPlayer) Step() []Event {
+	if p.Done() {
+		return nil
+	}
+	in := p.replay.Inputs[p.run].Input
+	p.inRun++
+	if p.inRun >= p.replay.Inputs[p.run].Count {
+		p.run++
+		p.inRun = 0
+	}
+	p.Tick++
+	return p.Engine.Step(in)
+}
+
+// ¿Se acabó lo grabado (o la partida)?
+func (p *ReplayPlayer) Done() bool {
+	return p.run >= len(p.replay.Inputs) || p.Engine.Over
+}
+
+// Ticks que dura el replay
+func (p *ReplayPlayer) Length() int {
+	return p.replay.Ticks
+}
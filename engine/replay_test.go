@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// .... Los ticks seguidos con la misma entrada se guardan en un solo tramo ....
+func TestReplayRecord(t *testing.T) {
+	r := NewReplay(newTestEngine(t, ModeMarathon))
+	for _, in := range []Input{0, 0, 0, InputLeft, InputLeft, 0} {
+		r.Record(in)
+	}
+	want := []InputRun{{0, 3}, {InputLeft, 2}, {0, 1}}
+	if r.Ticks != 6 || len(r.Inputs) != len(want) {
+		t.Fatalf("se grabaron %d ticks en %v", r.Ticks, r.Inputs)
+	}
+	for i := range want {
+		if r.Inputs[i] != want[i] {
+			t.Fatalf("el tramo %d es %v, tenía que ser %v", i, r.Inputs[i], want[i])
+		}
+	}
+}
+
+// .... Grabada, guardada y cargada, la partida se repite igual tick a tick ....
+func TestReplayRoundTrip(t *testing.T) {
+	for _, kind := range []RandomizerKind{RandomizerPure, RandomizerBag, RandomizerHistory} {
+		e := New()
+		e.Config.Randomizer = kind
+		e.Start(11)
+		r := NewReplay(e)
+
+		//Entradas al azar, en tramos para que las teclas se mantengan
+		rnd := rand.New(rand.NewSource(int64(kind)))
+		var hashes []uint64
+		for len(hashes) < 3000 && !e.Over {
+			in := Input(rnd.Intn(256))
+			for n := rnd.Intn(8); n >= 0 && !e.Over; n-- {
+				r.Record(in)
+				e.Step(in)
+				hashes = append(hashes, e.Hash())
+			}
+		}
+
+		path := filepath.Join(t.TempDir(), "partida.json")
+		if err := r.Save(path); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadReplay(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p, _ := NewReplayPlayer(loaded)
+		if p.Length() != len(hashes) {
+			t.Fatalf("randomizer %d: el replay dura %d ticks, se jugaron %d", kind, p.Length(), len(hashes))
+		}
+		for i := 0; !p.Done(); i++ {
+			p.Step()
+			if p.Engine.Hash() != hashes[i] {
+				t.Fatalf("randomizer %d: el replay se separó de la partida en el tick %d", kind, i)
+			}
+		}
+		if p.Tick != len(hashes) || p.Engine.Score != e.Score {
+			t.Fatalf("randomizer %d: el replay terminó en el tick %d con %d puntos, la partida en el %d con %d",
+				kind, p.Tick, p.Engine.Score, len(hashes), e.Score)
+		}
+	}
+}
+
+// .... Los sets por defecto no van en el archivo, uno propio sí ....
+func TestReplayCompact(t *testing.T) {
+	dir := t.TempDir()
+	e := newTestEngine(t, ModeMarathon)
+	path := filepath.Join(dir, "defecto.json")
+	if err := NewReplay(e).Save(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), `"Pieces"`) || strings.Contains(string(data), `"Levels"`) {
+		t.Fatalf("el replay guardó los sets por defecto: %s", data)
+	}
+	if r, err := LoadReplay(path); err != nil || r.Pieces != DefaultPieces || r.Levels != DefaultLevels {
+		t.Fatalf("el replay sin sets no cargó los de por defecto: %v", err)
+	}
+
+	//Un set propio se guarda entero, así el replay se puede ver en otra máquina
+	custom := *DefaultPieces
+	custom.Name = "propio"
+	custom.Pieces = custom.Pieces[:2]
+	e = New()
+	e.Pieces = &custom
+	e.Start(1)
+	path = filepath.Join(dir, "propio.json")
+	if err := NewReplay(e).Save(path); err != nil {
+		t.Fatal(err)
+	}
+	r, err := LoadReplay(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Pieces == nil || r.Pieces.Name != "propio" || r.Pieces.Len() != 2 {
+		t.Fatalf("el set propio no se guardó en el replay: %+v", r.Pieces)
+	}
+}
+
+// .... Un replay de otra versión no se carga ....
+func TestReplayVersion(t *testing.T) {
+	r := NewReplay(newTestEngine(t, ModeMarathon))
+	r.Version = ReplayVersion - 1
+	path := filepath.Join(t.TempDir(), "vieja.json")
+	if err := r.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadReplay(path); err == nil {
+		t.Fatal("se cargó un replay de otra versión")
+	}
+	if _, err := LoadReplay(filepath.Join(t.TempDir(), "no-existe.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("un replay que no existe dio %v", err)
+	}
+}
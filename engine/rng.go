@@ -0,0 +1,42 @@
+package engine
+
+// .... Azar propio de cada partida ....
+// Es un splitmix64: su estado es un solo número, así que la misma semilla da siempre
+// la misma secuencia de piezas (en cualquier máquina y versión de Go) y copiar el
+// motor copia también su azar.
+type RNG struct {
+	state uint64
+}
+
+// Crea el generador a partir de una semilla
+func NewRNG(seed int64) RNG {
+	return RNG{state: uint64(seed)}
+}
+
+func (r *RNG) Uint64() uint64 {
+	r.state += 0x9e3779b97f4a7c15
+	z := r.state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// Entero al azar en [0, n)
+func (r *RNG) Intn(n int) int {
+	if n <= 0 {
+		panic("engine: Intn con n <= 0")
+	}
+	return int(r.Uint64() % uint64(n))
+}
+
+// Decimal al azar en [0, 1)
+func (r *RNG) Float64() float64 {
+	return float64(r.Uint64()>>11) / (1 << 53)
+}
+
+// Revuelve n elementos (Fisher-Yates)
+func (r *RNG) Shuffle(n int, swap func(i, j int)) {
+	for i := n - 1; i > 0; i-- {
+		swap(i, r.Intn(i+1))
+	}
+}
@@ -0,0 +1,112 @@
+package engine
+
+// .... Sistema de rotación con wall kicks (SRS) ....
+// Al rotar se prueban, en orden, los desplazamientos de la tabla de la pieza;
+// se queda con el primero donde la pieza cabe. Si ninguno sirve, no rota.
+
+// Sentidos de giro, en cuartos de vuelta horarios
+const (
+	RotateCW  = 1
+	Rotate180 = 2
+	RotateCCW = 3
+)
+
+// Desplazamientos a probar para cada cambio de rotación (desde, hasta).
+// Están escritos como en las tablas de SRS: x a la derecha, y hacia ARRIBA.
+type KickTable map[[2]int][]Point
+
+// .... Tablas disponibles, las piezas las eligen por nombre ....
+var kickTables = map[string]KickTable{
+	//J, L, S, T, Z: la tabla estándar de SRS
+	"JLSTZ": {
+		{0, 1}: {{0, 0}, {-1, 0}, {-1, 1}, {0, -2}, {-1, -2}},
+		{1, 0}: {{0, 0}, {1, 0}, {1, -1}, {0, 2}, {1, 2}},
+		{1, 2}: {{0, 0}, {1, 0}, {1, -1}, {0, 2}, {1, 2}},
+		{2, 1}: {{0, 0}, {-1, 0}, {-1, 1}, {0, -2}, {-1, -2}},
+		{2, 3}: {{0, 0}, {1, 0}, {1, 1}, {0, -2}, {1, -2}},
+		{3, 2}: {{0, 0}, {-1, 0}, {-1, -1}, {0, 2}, {-1, 2}},
+		{3, 0}: {{0, 0}, {-1, 0}, {-1, -1}, {0, 2}, {-1, 2}},
+		{0, 3}: {{0, 0}, {1, 0}, {1, 1}, {0, -2}, {1, -2}},
+	},
+	//I: la tabla de SRS para la pieza larga
+	"I": {
+		{0, 1}: {{0, 0}, {-2, 0}, {1, 0}, {-2, -1}, {1, 2}},
+		{1, 0}: {{0, 0}, {2, 0}, {-1, 0}, {2, 1}, {-1, -2}},
+		{1, 2}: {{0, 0}, {-1, 0}, {2, 0}, {-1, 2}, {2, -1}},
+		{2, 1}: {{0, 0}, {1, 0}, {-2, 0}, {1, -2}, {-2, 1}},
+		{2, 3}: {{0, 0}, {2, 0}, {-1, 0}, {2, 1}, {-1, -2}},
+		{3, 2}: {{0, 0}, {-2, 0}, {1, 0}, {-2, -1}, {1, 2}},
+		{3, 0}: {{0, 0}, {1, 0}, {-2, 0}, {1, -2}, {-2, 1}},
+		{0, 3}: {{0, 0}, {-1, 0}, {2, 0}, {-1, 2}, {2, -1}},
+	},
+	//O: no se mueve al rotar
+	"O": {},
+	//Pentominos de caja 3x3 (U, la especial, V): como SRS pero con un paso extra
+	//de 2 columnas, porque ocupan toda la caja y chocan más con las paredes
+	"Pentomino": {
+		{0, 1}: {{0, 0}, {-1, 0}, {-1, 1}, {0, -2}, {-1, -2}, {-2, 0}},
+		{1, 0}: {{0, 0}, {1, 0}, {1, -1}, {0, 2}, {1, 2}, {2, 0}},
+		{1, 2}: {{0, 0}, {1, 0}, {1, -1}, {0, 2}, {1, 2}, {2, 0}},
+		{2, 1}: {{0, 0}, {-1, 0}, {-1, 1}, {0, -2}, {-1, -2}, {-2, 0}},
+		{2, 3}: {{0, 0}, {1, 0}, {1, 1}, {0, -2}, {1, -2}, {2, 0}},
+		{3, 2}: {{0, 0}, {-1, 0}, {-1, -1}, {0, 2}, {-1, 2}, {-2, 0}},
+		{3, 0}: {{0, 0}, {-1, 0}, {-1, -1}, {0, 2}, {-1, 2}, {-2, 0}},
+		{0, 3}: {{0, 0}, {1, 0}, {1, 1}, {0, -2}, {1, -2}, {2, 0}},
+	},
+	//I de 5: gira en el centro de su caja 5x5, así que basta con correrla
+	//hacia los lados o subirla
+	"I5": {
+		{0, 1}: {{0, 0}, {0, 1}, {0, 2}, {0, -1}, {0, -2}},
+		{1, 0}: {{0, 0}, {-1, 0}, {1, 0}, {-2, 0}, {2, 0}},
+		{1, 2}: {{0, 0}, {-1, 0}, {1, 0}, {-2, 0}, {2, 0}},
+		{2, 1}: {{0, 0}, {0, 1}, {0, 2}, {0, -1}, {0, -2}},
+		{2, 3}: {{0, 0}, {0, 1}, {0, 2}, {0, -1}, {0, -2}},
+		{3, 2}: {{0, 0}, {-1, 0}, {1, 0}, {-2, 0}, {2, 0}},
+		{3, 0}: {{0, 0}, {-1, 0}, {1, 0}, {-2, 0}, {2, 0}},
+		{0, 3}: {{0, 0}, {0, 1}, {0, 2}, {0, -1}, {0, -2}},
+	},
+}
+
+// Para el giro de 180 SRS no trae tabla, así que se usa esta para todas las piezas
+var kicks180 = []Point{{0, 0}, {0, 1}, {1, 0}, {-1, 0}, {1, 1}, {-1, 1}, {0, -1}}
+
+// .... Desplazamientos a probar para pasar de una rotación a otra ....
+func (t KickTable) offsets(from, to int) []Point {
+	if (to-from+NumRotaciones)%NumRotaciones == Rotate180 {
+		return kicks180
+	}
+	if kicks, ok := t[[2]int{from, to}]; ok {
+		return kicks
+	}
+	return []Point{{0, 0}}
+}
+
+// .... Rota la pieza que cae los cuartos de vuelta pedidos, probando los kicks ....
+func (e *Engine) rotate(turns int) bool {
+	piece := e.Pieces.Get(e.FallingCol)
+	if piece == nil {
+		return false
+	}
+
+	from := e.FallingRotation
+	to := (from + turns) % NumRotaciones
+	shape := piece.Rotations[to]
+
+	for i, kick := range kickTables[piece.Kicks].offsets(from, to) {
+		//La tabla tiene la y hacia arriba, el tablero hacia abajo
+		x := e.FallingX + kick.X
+		y := e.FallingY - kick.Y
+		if e.fits(shape, x, y) {
+			e.FallingX = x
+			e.FallingY = y
+			e.FallingRotation = to
+			e.lastKick = i
+			if turns == Rotate180 || piece.Kicks != "JLSTZ" {
+				//Para el T-spin solo cuentan los kicks de la tabla JLSTZ en giros de un cuarto
+				e.lastKick = -1
+			}
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package engine
+
+import "testing"
+
+// .... En campo abierto se rota sin kicks y cuatro giros vuelven al principio ....
+func TestRotateOpenField(t *testing.T) {
+	e := newTestEngine(t, ModeMarathon)
+	placeTest(t, e, "T")
+	e.FallingY += 5
+	x, y := e.FallingX, e.FallingY
+
+	for i := 1; i <= NumRotaciones; i++ {
+		if !e.rotate(RotateCW) {
+			t.Fatalf("no rotó en campo abierto en el giro %d", i)
+		}
+		if e.FallingX != x || e.FallingY != y {
+			t.Fatalf("giro %d: usó un kick y quedó en (%d, %d)", i, e.FallingX, e.FallingY)
+		}
+		if e.FallingRotation != i%NumRotaciones {
+			t.Fatalf("giro %d: quedó en la rotación %d", i, e.FallingRotation)
+		}
+	}
+
+	//Al revés y media vuelta, también desde las entradas del tick
+	e.Step(InputRotateCCW)
+	if e.FallingRotation != 3 {
+		t.Fatalf("al revés quedó en la rotación %d, tenía que ser 3", e.FallingRotation)
+	}
+	e.Step(InputRotate180)
+	if e.FallingRotation != 1 {
+		t.Fatalf("media vuelta quedó en la rotación %d, tenía que ser 1", e.FallingRotation)
+	}
+}
+
+// .... Contra la pared, la pieza se corre con un kick en vez de no rotar ....
+func TestWallKick(t *testing.T) {
+	tests := []struct {
+		piece string
+		from  int //Rotación con la que se pega a la pared
+		turns int
+		dir   int //-1 pared izquierda, 1 derecha
+	}{
+		{"I", 1, RotateCCW, -1},
+		{"I", 3, RotateCW, 1},
+		{"T", 1, RotateCCW, -1},
+		{"T", 3, RotateCW, 1},
+		{"L", 1, RotateCW, -1},
+	}
+	for _, tt := range tests {
+		e := newTestEngine(t, ModeMarathon)
+		placeTest(t, e, tt.piece)
+		e.FallingY += 5
+		for e.FallingRotation != tt.from {
+			if !e.rotate(RotateCW) {
+				t.Fatalf("%s: no se pudo llegar a la rotación %d", tt.piece, tt.from)
+			}
+		}
+		for e.canMove(tt.dir, 0) {
+			e.FallingX += tt.dir
+		}
+
+		//Sin kick no cabe: la rotación tiene que salir de la tabla
+		to := (tt.from + tt.turns) % NumRotaciones
+		if e.fits(e.Pieces.Shape(e.FallingCol, to), e.FallingX, e.FallingY) {
+			t.Fatalf("%s: la rotación %d cabe sin kick, el caso no prueba nada", tt.piece, to)
+		}
+		x, y := e.FallingX, e.FallingY
+		if !e.rotate(tt.turns) {
+			t.Fatalf("%s: no rotó de %d a %d contra la pared", tt.piece, tt.from, to)
+		}
+		if (e.FallingX == x && e.FallingY == y) || e.FallingRotation != to {
+			t.Fatalf("%s: rotó a %d sin kick, en (%d, %d)", tt.piece, e.FallingRotation, e.FallingX, e.FallingY)
+		}
+		for _, b := range e.FallingBlocks() {
+			if b.X < 0 || b.X >= e.Width() {
+				t.Fatalf("%s: el kick dejó la pieza fuera del tablero: %v", tt.piece, e.FallingBlocks())
+			}
+		}
+	}
+}
+
+// .... Si ningún kick sirve, la pieza no rota ni se mueve ....
+func TestRotateBlocked(t *testing.T) {
+	e := newTestEngine(t, ModeMarathon)
+	placeTest(t, e, "T")
+	e.FallingY += 5
+
+	//Todo lleno salvo las celdas de la pieza
+	own := map[Point]bool{}
+	for _, b := range e.FallingBlocks() {
+		own[b] = true
+	}
+	for y := 0; y < e.Height(); y++ {
+		for x := 0; x < e.Width(); x++ {
+			if !own[Point{x, y}] {
+				e.Grid[y][x] = Cell{Piece: GarbagePiece, Flags: CellGarbage}
+			}
+		}
+	}
+
+	x, y := e.FallingX, e.FallingY
+	for _, turns := range []int{RotateCW, RotateCCW, Rotate180} {
+		if e.rotate(turns) {
+			t.Fatalf("rotó %d cuartos sin lugar", turns)
+		}
+		if e.FallingRotation != 0 || e.FallingX != x || e.FallingY != y {
+			t.Fatal("la pieza se movió sin poder rotar")
+		}
+	}
+}
+
+// .... En las tablas de SRS volver de una rotación es el kick opuesto de ir ....
+func TestKickTablesSymmetric(t *testing.T) {
+	for _, name := range []string{"JLSTZ", "I", "Pentomino"} {
+		table := kickTables[name]
+		for key, kicks := range table {
+			back := table[[2]int{key[1], key[0]}]
+			if len(back) != len(kicks) {
+				t.Fatalf("%s %v: %d kicks de ida y %d de vuelta", name, key, len(kicks), len(back))
+			}
+			for i := range kicks {
+				if back[i].X != -kicks[i].X || back[i].Y != -kicks[i].Y {
+					t.Fatalf("%s %v: el kick %d de vuelta no es el opuesto: %v y %v", name, key, i, kicks[i], back[i])
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package engine
+
+// .... Medidas del tablero ....
+// El tablero se arma al empezar la partida con las medidas de la configuración;
+// GridWidth x GridHeight son las de siempre de FETRIS.
+const (
+	MinBoardSize = 4
+	MaxBoardSize = 40
+)
+
+// Medidas que pide la configuración, dentro de los límites (0 = las de siempre)
+func (c Config) BoardSize() (width, height int) {
+	width, height = c.Width, c.Height
+	if width == 0 {
+		width = GridWidth
+	}
+	if height == 0 {
+		height = GridHeight
+	}
+	return clampBoard(width), clampBoard(height)
+}
+
+func clampBoard(n int) int {
+	if n < MinBoardSize {
+		return MinBoardSize
+	}
+	if n > MaxBoardSize {
+		return MaxBoardSize
+	}
+	return n
+}
+
+// Tablero vacío
+func newGrid(width, height int) [][]Cell {
+	grid := make([][]Cell, height)
+	for y := range grid {
+		grid[y] = make([]Cell, width)
+	}
+	return grid
+}
+
+// .... Columnas y filas del tablero de la partida ....
+func (e *Engine) Width() int {
+	return len(e.Grid[0])
+}
+
+func (e *Engine) Height() int {
+	return len(e.Grid)
+}
+
+// ¿La celda (x, y) está dentro del tablero?
+func (e *Engine) inside(x, y int) bool {
+	return x >= 0 && x < e.Width() && y >= 0 && y < e.Height()
+}
@@ -0,0 +1,88 @@
+package engine
+
+// .... Versus: varias partidas a la vez que se mandan basura ....
+// Todas empiezan con la misma semilla (las mismas piezas) y avanzan juntas, un tick
+// cada una. La basura que manda una en un tick le llega al rival al final de ese
+// tick, así el orden en que se juegan no cambia nada.
+type Match struct {
+	Players   []*Engine
+	Targeting []TargetKind //A quién le manda basura cada uno
+	Winner    int          //Índice del que quedó vivo, -1 si se juega todavía o fue empate
+	Over      bool
+
+	attackers []int //Último que le mandó basura a cada uno, -1 si nadie
+	rng       RNG   //Para los objetivos al azar
+	events    [][]Event
+}
+
+// .... Arma el versus con los motores de cada jugador, ya configurados ....
+func NewMatch(players []*Engine) *Match {
+	return &Match{
+		Players:   players,
+		Targeting: make([]TargetKind, len(players)),
+		Winner:    -1,
+		attackers: make([]int, len(players)),
+		events:    make([][]Event, len(players)),
+	}
+}
+
+// .... Empieza todas las partidas con la misma semilla; devuelve los eventos de cada una ....
+func (m *Match) Start(seed int64) [][]Event {
+	m.Winner = -1
+	m.Over = false
+	m.rng = NewRNG(^seed)
+	for i, p := range m.Players {
+		m.attackers[i] = -1
+		m.events[i] = p.Start(seed)
+	}
+	return m.events
+}
+
+// .... Avanza un tick con la entrada de cada jugador (en el orden de Players) ....
+func (m *Match) Step(inputs []Input) [][]Event {
+	for i, p := range m.Players {
+		m.events[i] = nil
+		if m.Over || p.Over {
+			continue
+		}
+		var in Input
+		if i < len(inputs) {
+			in = inputs[i]
+		}
+		m.events[i] = p.Step(in)
+	}
+	if m.Over {
+		return m.events
+	}
+
+	//La basura se reparte cuando ya jugaron todos
+	for i, p := range m.Players {
+		if p.Outgoing == 0 {
+			continue
+		}
+		if target := m.target(i); target >= 0 {
+			m.Players[target].AddGarbage(p.Outgoing)
+			m.attackers[target] = i
+		}
+	}
+
+	m.checkOver()
+	return m.events
+}
+
+// .... Se acaba cuando queda uno vivo (o ninguno, si cayeron en el mismo tick) ....
+func (m *Match) checkOver() {
+	alive := -1
+	count := 0
+	for i, p := range m.Players {
+		if !p.Over {
+			alive = i
+			count++
+		}
+	}
+	if count > 1 {
+		return
+	}
+	m.Over = true
+	m.Winner = alive
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"github.com/Efocor/FETRIS/engine"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+// .... Lo de cada jugador: su partida, sus controles y lo que se dibuja de su tablero ....
+// Game tiene uno por jugador y dibuja y actualiza de a uno (el que está en Game.playerState).
+type playerState struct {
+	engine         *engine.Engine //Reglas de la partida, sin ventana ni audio
+	controls       controls
+	name           string      //Nombre que se muestra en versus
+	layout         boardLayout //Dónde se dibuja el tablero, según sus medidas
+	message        string
+	messageTicks   int        //Ticks que le quedan al mensaje en pantalla
+	boardParticles []Particle //Las que salen de las líneas que se limpian
+	popups         []popup    //Carteles de los premios de puntaje
+}
+
+func newPlayerState(c controls) *playerState {
+	return &playerState{engine: engine.New(), controls: c}
+}
+
+// .... Borra mensaje, carteles y partículas de la partida anterior ....
+func (p *playerState) resetEffects() {
+	p.popups = p.popups[:0]
+	p.boardParticles = p.boardParticles[:0]
+	p.message = ""
+	p.messageTicks = 0
+}
+
+// .... Teclas de cada acción, y el gamepad si hay uno ....
+// Mover y la caída rápida se leen mientras estén apretadas, el resto al apretarse.
+type controls struct {
+	keys    map[engine.Input][]ebiten.Key
+	gamepad int //Gamepad conectado que usa el jugador (en orden de conexión), -1 = ninguno
+}
+
+// Jugando solo: flechas, Z/X/A/S/C como siempre, y cualquier gamepad
+var soloControls = controls{
+	keys: map[engine.Input][]ebiten.Key{
+		engine.InputLeft:      {ebiten.KeyLeft},
+		engine.InputRight:     {ebiten.KeyRight},
+		engine.InputSoftDrop:  {ebiten.KeyDown},
+		engine.InputHardDrop:  {ebiten.KeyX, ebiten.KeySpace},
+		engine.InputRotate:    {ebiten.KeyZ, ebiten.KeyUp},
+		engine.InputRotateCCW: {ebiten.KeyA},
+		engine.InputRotate180: {ebiten.KeyS},
+		engine.InputHold:      {ebiten.KeyC, ebiten.KeyShift},
+	},
+	gamepad: 0,
+}
+
+// El rival en red no se maneja desde este computador
+var noControls = controls{gamepad: -1}
+
+// En versus cada uno tiene su lado del teclado y su gamepad
+var versusControls = []controls{
+	{
+		keys: map[engine.Input][]ebiten.Key{
+			engine.InputLeft:      {ebiten.KeyA},
+			engine.InputRight:     {ebiten.KeyD},
+			engine.InputSoftDrop:  {ebiten.KeyS},
+			engine.InputHardDrop:  {ebiten.KeyW},
+			engine.InputRotate:    {ebiten.KeyE},
+			engine.InputRotateCCW: {ebiten.KeyQ},
+			engine.InputRotate180: {ebiten.KeyR},
+			engine.InputHold:      {ebiten.KeyShiftLeft},
+		},
+		gamepad: 0,
+	},
+	{
+		keys: map[engine.Input][]ebiten.Key{
+			engine.InputLeft:      {ebiten.KeyLeft},
+			engine.InputRight:     {ebiten.KeyRight},
+			engine.InputSoftDrop:  {ebiten.KeyDown},
+			engine.InputHardDrop:  {ebiten.KeyEnter},
+			engine.InputRotate:    {ebiten.KeyUp},
+			engine.InputRotateCCW: {ebiten.KeyPeriod},
+			engine.InputRotate180: {ebiten.KeySlash},
+			engine.InputHold:      {ebiten.KeyShiftRight},
+		},
+		gamepad: 1,
+	},
+}
+
+// Botones del gamepad (con el layout estándar) de cada acción
+var gamepadButtons = map[engine.Input][]ebiten.StandardGamepadButton{
+	engine.InputLeft:      {ebiten.StandardGamepadButtonLeftLeft},
+	engine.InputRight:     {ebiten.StandardGamepadButtonLeftRight},
+	engine.InputSoftDrop:  {ebiten.StandardGamepadButtonLeftBottom},
+	engine.InputHardDrop:  {ebiten.StandardGamepadButtonLeftTop},
+	engine.InputRotate:    {ebiten.StandardGamepadButtonRightBottom},
+	engine.InputRotateCCW: {ebiten.StandardGamepadButtonRightRight},
+	engine.InputRotate180: {ebiten.StandardGamepadButtonRightTop},
+	engine.InputHold:      {ebiten.StandardGamepadButtonFrontTopLeft, ebiten.StandardGamepadButtonFrontTopRight},
+}
+
+// Acciones que cuentan mientras se mantienen apretadas
+const heldInputs = engine.InputLeft | engine.InputRight | engine.InputSoftDrop
+
+// .... Traduce el teclado y el gamepad del jugador a la entrada del motor ....
+func (c controls) read() engine.Input {
+	pad, hasPad := c.pad()
+
+	var in engine.Input
+	for action := engine.Input(1); action != 0; action <<= 1 {
+		held := heldInputs.Has(action)
+		for _, key := range c.keys[action] {
+			if (held && ebiten.IsKeyPressed(key)) || (!held && inpututil.IsKeyJustPressed(key)) {
+				in |= action
+			}
+		}
+		if !hasPad {
+			continue
+		}
+		for _, button := range gamepadButtons[action] {
+			if (held && ebiten.IsStandardGamepadButtonPressed(pad, button)) ||
+				(!held && inpututil.IsStandardGamepadButtonJustPressed(pad, button)) {
+				in |= action
+			}
+		}
+	}
+
+	//Las dos direcciones a la vez: gana la izquierda, como siempre
+	if in.Has(engine.InputLeft) {
+		in &^= engine.InputRight
+	}
+	return in
+}
+
+// Gamepad del jugador, si está conectado y tiene el layout estándar
+func (c controls) pad() (ebiten.GamepadID, bool) {
+	if c.gamepad < 0 {
+		return 0, false
+	}
+	ids := ebiten.AppendGamepadIDs(nil)
+	if c.gamepad >= len(ids) || !ebiten.IsStandardGamepadLayoutAvailable(ids[c.gamepad]) {
+		return 0, false
+	}
+	return ids[c.gamepad], true
+}
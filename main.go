@@ -36,6 +36,7 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"image"
 	"image/color"
@@ -46,8 +47,11 @@ import (
 	"math/rand"
 	"os"
 	"sort"
+	"strconv"
 	"time"
 
+	"github.com/Efocor/FETRIS/engine"
+	"github.com/Efocor/FETRIS/netplay"
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/audio"
 	"github.com/hajimehoshi/ebiten/v2/audio/vorbis"
@@ -60,15 +64,8 @@ import (
 
 // ....Constantes del juego....
 const (
-	PantallaWidth         = 800
-	PantallaHeight        = 600
-	GridWidth             = 10
-	GridHeight            = 17
-	TamañoCell            = 30
-	SizeDelBlock          = 30
-	VelocidadInicial      = 60
-	ProbabiliSpecialPiece = 0.2
-	LevelTimeLimitSeconds = 122 // 2 minutos por nivel
+	PantallaWidth  = 800
+	PantallaHeight = 600
 
 	//.... Estados del juego....
 	EstadoCompany = iota //Estado primero
@@ -82,6 +79,14 @@ const (
 	EstadoPause
 	EstadoGameOver
 	EstadoHighScores
+	EstadoOpciones
+	EstadoReplay
+	EstadoModos
+	EstadoPuzzles
+	EstadoRed
+	EstadoRedEspera
+	EstadoServidor
+	EstadoSala
 
 	//.... Configuración de audio ....
 	SampleRate      = 44100
@@ -90,39 +95,28 @@ const (
 
 // .... Estructura de datos para los highscores ....
 type HighScore struct {
-	Name  string
-	Score int
-	Level int
-	Date  string
+	Name   string
+	Score  int
+	Level  int
+	Date   string
+	Replay string          //Archivo con el replay de la partida, vacío en puntajes viejos
+	Mode   engine.ModeKind //Cada modo tiene su tabla, los puntajes viejos son de FETRIS
+	Lines  int
+	Time   int //Ticks que duró la partida
 }
 
+// Puntajes que se guardan por modo
+const maxHighScores = 10
+
 // .... Struct principal del juego ....
 type Game struct {
 	Estado          int
-	grid            [GridHeight][GridWidth]int
-	fallingX        int
-	fallingY        int
-	fallingCol      int
-	fallingSpecial  bool
-	fallingRotation int
-	score           int
-	level           int
-	speed           int
-	framesCounter   int
-	message         string
-	timer           int
-	timeLimit       int
+	*playerState                   //Jugador que se actualiza y se dibuja ahora, en versus se van turnando
+	players         []*playerState //Todos los jugadores, el primero es el que juega solo
+	match           *engine.Match  //El versus que se está jugando, nil jugando solo
 	musicWasPlaying bool
 	inputText       string //inputnombre
 	maxInputLength  int
-	nextPieces      [3]int  //almacena 3 piezas spawneadas
-	nextSpecial     [3]bool //almacena si las siguientes piezas son especiales
-	//.... Pal movimiento de las piezas ....
-	moveDelayCounter int
-	moveDelay        int
-	initialMoveDelay int
-	keyHeldFrames    int
-	lastMoveDir      int
 	//.... Campos para la carga de recursos ....
 	blockImage        *ebiten.Image
 	specialMarks      map[string]*ebiten.Image
@@ -139,7 +133,7 @@ type Game struct {
 	retroFont         font.Face
 	gameFont          font.Face
 	storyFont         font.Face
-	lastTimerUpdate   time.Time
+	companyTicks      int           //Ticks que lleva el logo de la compañía
 	backgroundImage   *ebiten.Image //Mi imagen de fondo
 	background2Image  *ebiten.Image //Mi imagen de juego
 	companyImage      *ebiten.Image //Mi imagen de compañía
@@ -147,6 +141,27 @@ type Game struct {
 	particles         []Particle
 	lastParticleSpawn time.Time
 	playMenuOption    int
+	settings          Settings //Opciones del jugador (opciones.json)
+	settingsOption    int
+	highScoreOption   int
+	highScoreMode     engine.ModeKind //Tabla de puntajes que se está viendo
+	flagSeed          string          //Semilla de -semilla, vale solo para esta sesión y no se guarda
+	puzzles           []*engine.Puzzle
+	puzzleOption      int
+	solved            map[string][]string //Puzzles resueltos por cada jugador
+	//.... Replays ....
+	recording    *engine.Replay       //Lo que se va grabando de la partida actual
+	replay       *engine.Replay       //Replay abierto en el visor
+	replayPlayer *engine.ReplayPlayer //Motor que reproduce el replay
+	liveEngine   *engine.Engine       //Motor de la partida mientras el visor usa el suyo
+	//.... Versus en red ....
+	lobby        netLobby
+	net          netplay.Netcode     //Partida en red, nil si se juega en este computador
+	server       *netplay.ServerConn //Conexión con el servidor de salas, nil si no se entró a uno
+	soloEngine   *engine.Engine      //Motor de jugar solo mientras la partida en red usa otros
+	replayPaused bool
+	replaySpeed  int     //Índice en replaySpeeds
+	replayTicks  float64 //Ticks del replay acumulados, para las velocidades lentas
 }
 
 // ..................................................................
@@ -170,20 +185,21 @@ func (g *Game) drawCompanyLogo(screen *ebiten.Image) {
 	//Dibuja la imagen de fondo en la pantalla por 1 segundo:
 	screen.DrawImage(g.companyImage, nil)
 
-	//Espera 2 segundos y pasa al siguiente estado con una animación de fadeout
-	if time.Since(g.lastTimerUpdate) > time.Second*1 {
-		//fadeout
-		if g.companyImage != nil {
-			op := &ebiten.DrawImageOptions{}
-			op.ColorM.Scale(1, 1, 1, 0.5)
-			screen.DrawImage(g.companyImage, op)
-		}
+	//Al cumplir el segundo, fadeout (el cambio de estado lo hace updateCompanyLogo)
+	if g.companyTicks >= engine.TPS {
+		op := &ebiten.DrawImageOptions{}
+		op.ColorM.Scale(1, 1, 1, 0.5)
+		screen.DrawImage(g.companyImage, op)
+	}
+}
 
-		//Pasa al siguiente estado
+// .... Cuenta los ticks del logo y pasa a la pantalla de inicio ....
+func (g *Game) updateCompanyLogo() error {
+	g.companyTicks++
+	if g.companyTicks > engine.TPS {
 		g.Estado = EstadoStart
-		g.lastTimerUpdate = time.Now()
-
 	}
+	return nil
 }
 
 // .... Lógica de presentación y prejugo
@@ -195,6 +211,10 @@ type Particle struct {
 	size     float64
 	lifetime float64
 	alpha    float64
+	decay    float64    //Vida que pierde en cada tick
+	gravity  float64    //Se suma a speedY en cada tick
+	bounce   bool       //Rebota en los bordes de la pantalla
+	color    [3]float64 //Escala RGB, igual que el color de las piezas
 }
 
 // .... Función para crear una nueva partícula ....
@@ -207,40 +227,67 @@ func newParticle() Particle {
 		size:     rand.Float64()*2 + 1,
 		lifetime: 1.0,
 		alpha:    1.0,
+		decay:    0.01,
+		bounce:   true,
+		color:    [3]float64{1, 1, 1},
 	}
 }
 
-// .... Función para actualizar las partículas ....
-func (g *Game) updateParticles() {
-	//Crea nuevas partículas periódicamente
-	if time.Since(g.lastParticleSpawn) > time.Millisecond*50 {
-		if len(g.particles) < 100 { //Límite máximo de partículas
-			g.particles = append(g.particles, newParticle())
-		}
-		g.lastParticleSpawn = time.Now()
+// .... Partícula que se desprende de una celda del tablero (x, y en pantalla, size su lado) ....
+func newCellParticle(x, y, size float64, rgb [3]float64) Particle {
+	return Particle{
+		x:        x + rand.Float64()*size,
+		y:        y + rand.Float64()*size,
+		speedX:   (rand.Float64() - 0.5) * 4,
+		speedY:   -rand.Float64() * 3,
+		size:     rand.Float64()*2 + 1.5,
+		lifetime: 1.0,
+		alpha:    1.0,
+		decay:    0.025,
+		gravity:  0.15,
+		color:    rgb,
 	}
+}
 
-	//Actualiza partículas existentes
+// .... Mueve las partículas un paso y devuelve las que siguen vivas ....
+func stepParticles(particles []Particle) []Particle {
 	var activeParticles []Particle
-	for _, p := range g.particles {
+	for _, p := range particles {
 		p.x += p.speedX
 		p.y += p.speedY
-		p.lifetime -= 0.01
+		p.speedY += p.gravity
+		p.lifetime -= p.decay
 		p.alpha = p.lifetime
 
 		//Mantene solo las partículas vivas
 		if p.lifetime > 0 {
 			//Hace que las partículas reboten en los bordes
-			if p.x < 0 || p.x > float64(PantallaWidth) {
-				p.speedX *= -1
-			}
-			if p.y < 0 || p.y > float64(PantallaHeight) {
-				p.speedY *= -1
+			if p.bounce {
+				if p.x < 0 || p.x > float64(PantallaWidth) {
+					p.speedX *= -1
+				}
+				if p.y < 0 || p.y > float64(PantallaHeight) {
+					p.speedY *= -1
+				}
 			}
 			activeParticles = append(activeParticles, p)
 		}
 	}
-	g.particles = activeParticles
+	return activeParticles
+}
+
+// .... Función para actualizar las partículas ....
+func (g *Game) updateParticles() {
+	//Crea nuevas partículas periódicamente
+	if time.Since(g.lastParticleSpawn) > time.Millisecond*50 {
+		if len(g.particles) < 100 { //Límite máximo de partículas
+			g.particles = append(g.particles, newParticle())
+		}
+		g.lastParticleSpawn = time.Now()
+	}
+
+	//Actualiza partículas existentes
+	g.particles = stepParticles(g.particles)
 }
 
 // .... Función modificada drawStartScreen y que coloca las partículas ....
@@ -401,21 +448,17 @@ func (g *Game) drawPlayerName(screen *ebiten.Image) {
 // .... Inicialización de juego nuevo, o sea un reset ....
 func NewGame() *Game {
 	g := &Game{
-		Estado:           EstadoCompany,
-		speed:            VelocidadInicial,
-		level:            1,
-		fallingRotation:  0,
-		timeLimit:        LevelTimeLimitSeconds,
-		specialMarks:     make(map[string]*ebiten.Image),
-		sounds:           make(map[string]*audio.Player),
-		lastTimerUpdate:  time.Now(),
-		moveDelay:        4,
-		initialMoveDelay: 10,
-		lastMoveDir:      0,
+		Estado:       EstadoCompany,
+		players:      []*playerState{newPlayerState(soloControls)},
+		specialMarks: make(map[string]*ebiten.Image),
+		sounds:       make(map[string]*audio.Player),
 	}
+	g.playerState = g.players[0]
 
 	g.loadResources()
 	g.loadHighScores()
+	g.loadSettings()
+	g.loadSolved()
 	g.initAudio()
 	return g
 }
@@ -574,36 +617,97 @@ func (g *Game) loadHighScores() {
 	if err == nil {
 		json.Unmarshal(data, &g.highScores)
 	}
-	sort.Slice(g.highScores, func(i, j int) bool {
-		return g.highScores[i].Score > g.highScores[j].Score
+	sortHighScores(g.highScores)
+}
+
+// .... Ordena los puntajes por modo, y en cada modo el mejor primero ....
+func sortHighScores(scores []HighScore) {
+	sort.SliceStable(scores, func(i, j int) bool {
+		a, b := scores[i], scores[j]
+		if a.Mode != b.Mode {
+			return a.Mode < b.Mode
+		}
+		//En sprint gana el menor tiempo
+		if engine.Rules(a.Mode).ByTime {
+			return a.Time < b.Time
+		}
+		return a.Score > b.Score
 	})
 }
 
 func (g *Game) saveHighScore() {
 	now := time.Now()
+	replay := g.saveReplay(now)
+
+	//Los puzzles no tienen tabla, se anotan como resueltos; su replay no lo guarda nadie
+	if g.engine.ModeRules().Puzzle {
+		if g.engine.Finished {
+			g.markSolved(g.engine.Puzzle)
+		}
+		if replay != "" {
+			os.Remove(replay)
+		}
+		return
+	}
+
+	//Un sprint que no llegó a la meta no tiene tiempo que comparar
+	if g.engine.ModeRules().ByTime && !g.engine.Finished {
+		if replay != "" {
+			os.Remove(replay)
+		}
+		return
+	}
+
 	newScore := HighScore{
-		Name:  g.playerName,
-		Score: g.score,
-		Level: g.level,
-		Date:  now.Format("2006-01-02 15:04:05"),
+		Name:   g.playerName,
+		Score:  g.engine.Score,
+		Level:  g.engine.Level,
+		Date:   now.Format("2006-01-02 15:04:05"),
+		Replay: replay,
+		Mode:   g.engine.Config.Mode,
+		Lines:  g.engine.Lines,
+		Time:   g.engine.Ticks,
 	}
 
 	g.highScores = append(g.highScores, newScore)
-	sort.Slice(g.highScores, func(i, j int) bool {
-		return g.highScores[i].Score > g.highScores[j].Score
-	})
-
-	if len(g.highScores) > 10 {
-		g.highScores = g.highScores[:10]
+	sortHighScores(g.highScores)
+
+	//Cada modo se queda con sus mejores
+	kept := g.highScores[:0]
+	perMode := make(map[engine.ModeKind]int)
+	for _, score := range g.highScores {
+		if perMode[score.Mode] >= maxHighScores {
+			//Los replays de los puntajes que salen de la tabla ya no se necesitan
+			if score.Replay != "" {
+				os.Remove(score.Replay)
+			}
+			continue
+		}
+		perMode[score.Mode]++
+		kept = append(kept, score)
 	}
+	g.highScores = kept
 
 	data, _ := json.Marshal(g.highScores)
 	ioutil.WriteFile("puntajes.json", data, 0644)
 }
 
+// .... Puntajes del modo que se está viendo, ya ordenados ....
+func (g *Game) modeHighScores() []HighScore {
+	var scores []HighScore
+	for _, score := range g.highScores {
+		if score.Mode == g.highScoreMode {
+			scores = append(scores, score)
+		}
+	}
+	return scores
+}
+
 // .... Actualización del juego, aquí se manejan los estados y las acciones del juego ....
 func (g *Game) Update() error {
 	switch g.Estado {
+	case EstadoCompany:
+		return g.updateCompanyLogo()
 	case EstadoStart:
 		return g.updateStartScreen()
 	case EstadoPlayerName:
@@ -623,6 +727,22 @@ func (g *Game) Update() error {
 		return g.updateGameOver()
 	case EstadoHighScores:
 		return g.updateHighScores()
+	case EstadoOpciones:
+		return g.updateSettings()
+	case EstadoReplay:
+		return g.updateReplay()
+	case EstadoModos:
+		return g.updateModeSelect()
+	case EstadoPuzzles:
+		return g.updatePuzzleSelect()
+	case EstadoRed:
+		return g.updateNetMenu()
+	case EstadoRedEspera:
+		return g.updateNetWait()
+	case EstadoServidor:
+		return g.updateServerRooms()
+	case EstadoSala:
+		return g.updateRoom()
 	}
 	return nil
 }
@@ -636,10 +756,11 @@ func (g *Game) updateMenu() error {
 		g.playBGM()
 	} else if inpututil.IsKeyJustPressed(ebiten.KeyH) {
 		g.Estado = EstadoHighScores
+		g.highScoreMode = scoreTableMode(g.settings.Mode)
 		g.playSound("select")
-		//KeyV o KeyESC:
+		//KeyV o KeyESC: de vuelta a elegir el modo
 	} else if inpututil.IsKeyJustPressed(ebiten.KeyLeft) || inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
-		g.Estado = EstadoPlayMenu
+		g.Estado = EstadoModos
 		g.playSound("select")
 	} else if inpututil.IsKeyJustPressed(ebiten.KeyS) {
 		//salir del juego
@@ -650,6 +771,9 @@ func (g *Game) updateMenu() error {
 
 //..................................................................
 
+// .... Opciones del menú de selección de juego ....
+var playMenuOptions = []string{"JUGAR", "EN RED", "REGLAS", "PUNTAJES", "HISTORIA", "OPCIONES", "ENTRADA", "SALIR"}
+
 // .... Función de menu de selección de juego ....
 func (g *Game) drawPlayMenu(screen *ebiten.Image) {
 	//Se colorea el fondo de pantalla con el mismo que menú
@@ -659,8 +783,7 @@ func (g *Game) drawPlayMenu(screen *ebiten.Image) {
 	text.Draw(screen, "SELECCIONA CON LA FLECHA DERECHA", g.retroFont, 200, 100, color.White)
 
 	//Opciones de menú
-	options := []string{"JUGAR", "REGLAS", "PUNTAJES", "HISTORIA", "ENTRADA", "SALIR"}
-	for i, option := range options {
+	for i, option := range playMenuOptions {
 		text.Draw(screen, option, g.retroFont, 200, 200+i*50, color.White)
 	}
 
@@ -702,10 +825,10 @@ func (g *Game) updatePlayMenu() error { //debe mover la flecha de selección
 	}
 
 	if g.playMenuOption < 0 {
-		g.playMenuOption = 5
+		g.playMenuOption = len(playMenuOptions) - 1
 	}
 
-	if g.playMenuOption > 5 {
+	if g.playMenuOption > len(playMenuOptions)-1 {
 		g.playMenuOption = 0
 	}
 
@@ -719,21 +842,28 @@ func (g *Game) updatePlayMenu() error { //debe mover la flecha de selección
 	if inpututil.IsKeyJustPressed(ebiten.KeyRight) {
 		switch g.playMenuOption {
 		case 0:
-			g.Estado = EstadoMenu
+			g.Estado = EstadoModos
 			g.playSound("select")
 		case 1:
+			g.openNetMenu()
+			g.playSound("select")
+		case 2:
 			g.Estado = EstadoReglas
 			g.playSound("select")
-		case 4:
+		case 5:
+			g.Estado = EstadoOpciones
+			g.playSound("select")
+		case 6:
 			g.Estado = EstadoStart
 			g.playSound("select")
-		case 2:
+		case 3:
 			g.Estado = EstadoHighScores
+			g.highScoreMode = scoreTableMode(g.settings.Mode)
 			g.playSound("select")
-		case 3:
+		case 4:
 			g.Estado = EstadoHistoria
 			g.playSound("select")
-		case 5:
+		case 7:
 			os.Exit(0)
 		}
 	}
@@ -764,14 +894,16 @@ func (g *Game) drawRules(screen *ebiten.Image) {
 	rules := []string{
 		"REGLAS DEL JUEGO",
 		"Moverás las piezas con las flechas de tu teclado.",
-		"Rota con la tecla Z o la flecha arriba.",
+		"Rota con la tecla Z o la flecha arriba,",
+		"con A al revés y con S das media vuelta.",
 		"Acelera la caída con las teclas flecha abajo o X.",
 		"Tu objetivo es hacer líneas horizontales,",
-		"para ganar puntos y aguantar el tiempo.",
+		"y cumplir las metas de cada nivel a tiempo.",
 		"Las piezas marcadas te entregan un pequeño bonus,",
-		"si logras lockearlas.",
+		"si las lockeas, y más si haces línea con ellas.",
 		"La pieza multicolor es especial y cambia de forma,",
 		"hacer una línea con ella da muchos puntos.",
+		"Guarda una pieza para después con C o Shift.",
 		"Al avanzar de nivel, la velocidad aumenta.",
 	}
 
@@ -874,21 +1006,46 @@ func (g *Game) updateHistoria() error {
 
 // .... Función para iniciar un nuevo juego ....
 func (g *Game) startGame() {
-	g.grid = [GridHeight][GridWidth]int{}
-	g.score = 0
-	g.level = 1
-	g.speed = VelocidadInicial
-	g.timer = g.timeLimit
 	g.currentBgm = 0
 	g.bgms[g.currentBgm].Play()
 
-	// Inicializa las piezas preview
-	for i := 0; i < 3; i++ {
-		g.nextPieces[i] = rand.Intn(11) + 1
-		g.nextSpecial[i] = rand.Float64() < ProbabiliSpecialPiece
+	for _, p := range g.players {
+		p.resetEffects()
 	}
 
-	g.spawnPiece()
+	//El versus tiene un motor por jugador y no se graba
+	if engine.Rules(g.settings.Mode).Versus {
+		g.recording = nil
+		g.handleMatchEvents(g.startVersus(g.gameSeed()))
+		return
+	}
+	g.endVersus()
+
+	g.settings.applyTo(&g.engine.Config)
+	g.engine.Puzzle = nil
+	if g.engine.ModeRules().Puzzle {
+		g.engine.Puzzle = g.selectedPuzzle()
+	}
+
+	//El motor reinicia el tablero, el puntaje y las piezas preview
+	events := g.engine.Start(g.gameSeed())
+
+	//Se graba todo lo que se aprieta, para el replay
+	g.recording = engine.NewReplay(g.engine)
+	g.recording.Player = g.playerName
+
+	g.handleEvents(events)
+}
+
+// .... Semilla de la partida: la de -semilla, la fijada en opciones, si no, una nueva ....
+func (g *Game) gameSeed() int64 {
+	if seed, err := strconv.ParseInt(g.flagSeed, 10, 64); err == nil {
+		return seed
+	}
+	if seed, err := strconv.ParseInt(g.settings.Seed, 10, 64); err == nil {
+		return seed
+	}
+	return time.Now().UnixNano()
 }
 
 // La función que se utiliza para el cambio de BGM
@@ -898,8 +1055,8 @@ func (g *Game) changeBgmForLevel() {
 		g.bgms[g.currentBgm].Pause()
 	}
 
-	//Calcula qué BGM debe sonar (de los 7 o los que se definan)
-	newBgm := (g.level - 1) % 8
+	//Calcula qué BGM debe sonar, dando la vuelta cuando se acaban las canciones
+	newBgm := (g.engine.Level - 1) % len(g.bgms)
 
 	//Si es diferente BGM, reiniciar y reproducir
 	if newBgm != g.currentBgm {
@@ -914,158 +1071,41 @@ func (g *Game) changeBgmForLevel() {
 	}
 }
 
-// ..................................................................
-// Pa saber si está cayendo una pieza
-func (g *Game) isFallingPiece() bool {
-	return g.fallingY >= 0
-}
-
-func (g *Game) handleSmoothMovement() {
-	//Obvio, si no hay pieza cayendo, no hacemos nada
-	if !g.isFallingPiece() {
-		return
-	}
-
-	//Detecta entrada del teclado
-	moveDir := 0
-	if ebiten.IsKeyPressed(ebiten.KeyLeft) {
-		moveDir = -1
-	} else if ebiten.IsKeyPressed(ebiten.KeyRight) {
-		moveDir = 1
-	}
-
-	//Si no hay movimiento, resetear contadores
-	if moveDir == 0 {
-		g.moveDelayCounter = 0
-		g.keyHeldFrames = 0
-		g.lastMoveDir = 0
-		return
-	}
-
-	//Si es una nueva dirección, resetear contadores
-	if moveDir != g.lastMoveDir {
-		g.moveDelayCounter = 0
-		g.keyHeldFrames = 0
-		g.lastMoveDir = moveDir
-	}
-
-	g.keyHeldFrames++
-
-	//Mover inmediatamente en el primer frame
-	if g.keyHeldFrames == 1 {
-		if g.canMove(moveDir, 0) {
-			g.fallingX += moveDir
-		}
-		return
-	}
-
-	//Esperar el delay inicial
-	if g.keyHeldFrames <= g.initialMoveDelay {
-		return
-	}
-
-	//Incrementar el contador de delay
-	g.moveDelayCounter++
-
-	//Si alcanzamos el delay deseado, mover la pieza
-	if g.moveDelayCounter >= g.moveDelay {
-		if g.canMove(moveDir, 0) {
-			g.fallingX += moveDir
-		}
-		g.moveDelayCounter = 0
-	}
-}
-
 //..................................................................
 //..................................................................
 
 // .... Función para el manejo de la lógica del juego ....
 func (g *Game) updateGame() error {
-	now := time.Now()
-
-	//Actualizar timer cada segundo, independiente de los frames y teclas
-	if now.Sub(g.lastTimerUpdate) >= time.Second {
-		g.timer--
-		g.lastTimerUpdate = now
-
-		if g.timer <= 0 {
-			if !g.checkLevelComplete() {
-				g.gameOver()
-			} else {
-				g.nextLevel()
-			}
-		}
-	}
-
-	//Sistema de movimiento horizontal
-	moveDir := 0
-	if ebiten.IsKeyPressed(ebiten.KeyLeft) {
-		moveDir = -1
-	} else if ebiten.IsKeyPressed(ebiten.KeyRight) {
-		moveDir = 1
-	}
-
-	if moveDir != 0 {
-		if moveDir != g.lastMoveDir {
-			// Primer movimiento inmediato al presionar la tecla
-			if g.canMove(moveDir, 0) {
-				g.fallingX += moveDir
-			}
-			g.moveDelayCounter = 0
-			g.keyHeldFrames = 1
-			g.lastMoveDir = moveDir
-		} else {
-			g.keyHeldFrames++
-			if g.keyHeldFrames > g.initialMoveDelay {
-				g.moveDelayCounter++
-				if g.moveDelayCounter >= g.moveDelay {
-					if g.canMove(moveDir, 0) {
-						g.fallingX += moveDir
-					}
-					g.moveDelayCounter = 0
-				}
-			}
-		}
+	//Un tick del motor con lo que se está apretando (el tiempo del nivel también va en ticks)
+	if g.match != nil {
+		g.updateVersus()
 	} else {
-		g.moveDelayCounter = 0
-		g.keyHeldFrames = 0
-		g.lastMoveDir = 0
-	}
-
-	//Caída rápida
-	if ebiten.IsKeyPressed(ebiten.KeyDown) {
-		g.framesCounter += g.speed / 4
-	}
-
-	//Caída instantánea (X o Espacio)
-	if inpututil.IsKeyJustPressed(ebiten.KeyX) || inpututil.IsKeyJustPressed(ebiten.KeySpace) {
-		for g.canMove(0, 1) {
-			g.fallingY++
-		}
-		g.lockPiece()
-		g.spawnPiece()
+		in := g.controls.read()
+		g.recording.Record(in)
+		g.handleEvents(g.engine.Step(in))
+		g.tickEffects()
 	}
-
-	//Actualización de la caída de la pieza
-	g.framesCounter++
-	if g.framesCounter >= g.speed {
-		g.framesCounter = 0
-		if g.canMove(0, 1) {
-			g.fallingY++
-		} else {
-			g.lockPiece()
-			g.spawnPiece()
-		}
+	//Si la partida terminó en este tick ya no hay pausa ni ESC
+	if g.Estado != EstadoGame {
+		return nil
 	}
 
-	//Pausita
-	if inpututil.IsKeyJustPressed(ebiten.KeyP) {
+	//Pausita (en red no, el rival se quedaría esperando)
+	if inpututil.IsKeyJustPressed(ebiten.KeyP) && g.net == nil {
 		g.Estado = EstadoPause
 		g.bgms[g.currentBgm].Pause()
 	}
 
-	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+	//En zen no se pierde: ESC termina la partida y guarda el puntaje
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) && g.engine.ModeRules().NoTopOut {
+		g.handleEvents(g.engine.End())
+	} else if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
 		g.Estado = EstadoMenu
+		//En red se le avisa al rival que se terminó (en una sala, se sale del servidor)
+		if g.net != nil {
+			g.net.Close()
+			g.leaveServer()
+		}
 		//parar la música si está sonando y reiniciar, o sea un STOP:
 		if g.bgms[g.currentBgm] != nil && g.bgms[g.currentBgm].IsPlaying() {
 			g.bgms[g.currentBgm].Pause()
@@ -1076,335 +1116,69 @@ func (g *Game) updateGame() error {
 	return nil
 }
 
-func (g *Game) canMove(dx, dy int) bool {
-	//Se definen las formas de los tetrominos con sus 4 rotaciones
-	tetrominos := map[int][][]struct{ x, y int }{
-		1: { // I
-			{{0, 0}, {1, 0}, {2, 0}, {3, 0}},
-			{{1, -1}, {1, 0}, {1, 1}, {1, 2}},
-			{{0, 1}, {1, 1}, {2, 1}, {3, 1}},
-			{{2, -1}, {2, 0}, {2, 1}, {2, 2}},
-		},
-		2: { // O - No rota
-			{{0, 0}, {1, 0}, {0, 1}, {1, 1}},
-			{{0, 0}, {1, 0}, {0, 1}, {1, 1}},
-			{{0, 0}, {1, 0}, {0, 1}, {1, 1}},
-			{{0, 0}, {1, 0}, {0, 1}, {1, 1}},
-		},
-		3: { // T
-			{{1, 0}, {0, 1}, {1, 1}, {2, 1}},
-			{{1, 0}, {1, 1}, {2, 1}, {1, 2}},
-			{{0, 1}, {1, 1}, {2, 1}, {1, 2}},
-			{{1, 0}, {0, 1}, {1, 1}, {1, 2}},
-		},
-		4: { // L
-			{{0, 0}, {0, 1}, {0, 2}, {1, 2}},
-			{{0, 0}, {1, 0}, {2, 0}, {0, 1}},
-			{{0, 0}, {1, 0}, {1, 1}, {1, 2}},
-			{{2, 0}, {0, 1}, {1, 1}, {2, 1}},
-		},
-		5: { // J
-			{{1, 0}, {1, 1}, {0, 2}, {1, 2}},
-			{{0, 0}, {0, 1}, {1, 1}, {2, 1}},
-			{{0, 0}, {1, 0}, {0, 1}, {0, 2}},
-			{{0, 0}, {1, 0}, {2, 0}, {2, 1}},
-		},
-		6: { // Z
-			{{0, 0}, {1, 0}, {1, 1}, {2, 1}},
-			{{2, 0}, {1, 1}, {2, 1}, {1, 2}},
-			{{0, 1}, {1, 1}, {1, 2}, {2, 2}},
-			{{1, 0}, {0, 1}, {1, 1}, {0, 2}},
-		},
-		7: { // S
-			{{1, 0}, {2, 0}, {0, 1}, {1, 1}},
-			{{1, 0}, {1, 1}, {2, 1}, {2, 2}},
-			{{1, 1}, {2, 1}, {0, 2}, {1, 2}},
-			{{0, 0}, {0, 1}, {1, 1}, {1, 2}},
-		},
-		8: { // U
-			{{1, 0}, {0, 0}, {0, 1}, {0, 2}, {1, 2}},
-			{{0, 1}, {0, 0}, {1, 0}, {2, 0}, {2, 1}},
-			{{0, 0}, {1, 0}, {1, 1}, {1, 2}, {0, 2}},
-			{{0, 0}, {0, 1}, {1, 1}, {2, 1}, {2, 0}},
-		},
-		9: { // Pieza Especial 1
-			{{2, 0}, {2, 1}, {1, 1}, {1, 2}, {0, 2}},
-			{{1, 0}, {1, 1}, {1, 2}, {0, 1}, {2, 1}},
-			{{0, 0}, {0, 1}, {1, 1}, {2, 1}, {2, 2}},
-			{{2, 0}, {2, 1}, {1, 1}, {0, 1}, {0, 2}},
-		},
-		10: { // | grande
-			{{0, 0}, {1, 0}, {2, 0}, {3, 0}, {4, 0}},
-			{{2, 0}, {2, 1}, {2, 2}, {2, 3}, {2, 4}},
-			{{0, 0}, {1, 0}, {2, 0}, {3, 0}, {4, 0}},
-			{{2, 0}, {2, 1}, {2, 2}, {2, 3}, {2, 4}},
-		},
-		11: { // Otra
-			{{0, 2}, {1, 2}, {2, 2}, {0, 1}, {0, 0}},
-			{{0, 0}, {1, 0}, {2, 0}, {0, 1}, {0, 2}},
-			{{0, 0}, {1, 0}, {2, 0}, {2, 1}, {2, 2}},
-			{{0, 2}, {1, 2}, {2, 2}, {2, 1}, {2, 0}},
-		},
-	}
-
-	//Obtenemos la forma del tetromino actual con su rotación correspondiente
-	if blocks := tetrominos[g.fallingCol][g.fallingRotation]; len(blocks) > 0 {
-		for _, block := range blocks {
-			//Calcula nueva posición
-			x := g.fallingX + block.x + dx
-			y := g.fallingY + block.y + dy
-
-			//Verificamos límites del grid (importante)
-			if x < 0 || x >= GridWidth || y >= GridHeight {
-				return false
-			}
-
-			//Aquí es verificar colisión con otras piezas (sin dividir la pieza)
-			if y >= 0 && g.grid[y][x] != 0 {
-				return false
-			}
-		}
-		return true
-	}
-
-	return false
-}
-
-// .... Función para obtener la rotación de una pieza en el grid ....
-func (g *Game) rotationFromGrid(y, x int) int {
-	//Se definen nuevamente las formas de los tetrominos con sus 4 rotaciones (soy flojo)
-	tetrominos := map[int][][]struct{ x, y int }{
-		1: { // I
-			{{0, 0}, {1, 0}, {2, 0}, {3, 0}},
-			{{1, -1}, {1, 0}, {1, 1}, {1, 2}},
-			{{0, 1}, {1, 1}, {2, 1}, {3, 1}},
-			{{2, -1}, {2, 0}, {2, 1}, {2, 2}},
-		},
-		2: { // O - No rota
-			{{0, 0}, {1, 0}, {0, 1}, {1, 1}},
-			{{0, 0}, {1, 0}, {0, 1}, {1, 1}},
-			{{0, 0}, {1, 0}, {0, 1}, {1, 1}},
-			{{0, 0}, {1, 0}, {0, 1}, {1, 1}},
-		},
-		3: { // T
-			{{1, 0}, {0, 1}, {1, 1}, {2, 1}},
-			{{1, 0}, {1, 1}, {2, 1}, {1, 2}},
-			{{0, 1}, {1, 1}, {2, 1}, {1, 2}},
-			{{1, 0}, {0, 1}, {1, 1}, {1, 2}},
-		},
-		4: { // L
-			{{0, 0}, {0, 1}, {0, 2}, {1, 2}},
-			{{0, 0}, {1, 0}, {2, 0}, {0, 1}},
-			{{0, 0}, {1, 0}, {1, 1}, {1, 2}},
-			{{2, 0}, {0, 1}, {1, 1}, {2, 1}},
-		},
-		5: { // J
-			{{1, 0}, {1, 1}, {0, 2}, {1, 2}},
-			{{0, 0}, {0, 1}, {1, 1}, {2, 1}},
-			{{0, 0}, {1, 0}, {0, 1}, {0, 2}},
-			{{0, 0}, {1, 0}, {2, 0}, {2, 1}},
-		},
-		6: { // Z
-			{{0, 0}, {1, 0}, {1, 1}, {2, 1}},
-			{{2, 0}, {1, 1}, {2, 1}, {1, 2}},
-			{{0, 1}, {1, 1}, {1, 2}, {2, 2}},
-			{{1, 0}, {0, 1}, {1, 1}, {0, 2}},
-		},
-		7: { // S
-			{{1, 0}, {2, 0}, {0, 1}, {1, 1}},
-			{{1, 0}, {1, 1}, {2, 1}, {2, 2}},
-			{{1, 1}, {2, 1}, {0, 2}, {1, 2}},
-			{{0, 0}, {0, 1}, {1, 1}, {1, 2}},
-		},
-		8: { // U
-			{{1, 0}, {0, 0}, {0, 1}, {0, 2}, {1, 2}},
-			{{0, 1}, {0, 0}, {1, 0}, {2, 0}, {2, 1}},
-			{{0, 0}, {1, 0}, {1, 1}, {1, 2}, {0, 2}},
-			{{0, 0}, {0, 1}, {1, 1}, {2, 1}, {2, 0}},
-		},
-		9: { // Pieza Especial 1
-			{{2, 0}, {2, 1}, {1, 1}, {1, 2}, {0, 2}},
-			{{1, 0}, {1, 1}, {1, 2}, {0, 1}, {2, 1}},
-			{{0, 0}, {0, 1}, {1, 1}, {2, 1}, {2, 2}},
-			{{2, 0}, {2, 1}, {1, 1}, {0, 1}, {0, 2}},
-		},
-		10: { // | grande
-			{{0, 0}, {1, 0}, {2, 0}, {3, 0}, {4, 0}},
-			{{2, 0}, {2, 1}, {2, 2}, {2, 3}, {2, 4}},
-			{{0, 0}, {1, 0}, {2, 0}, {3, 0}, {4, 0}},
-			{{2, 0}, {2, 1}, {2, 2}, {2, 3}, {2, 4}},
-		},
-		11: { // Otra
-			{{0, 2}, {1, 2}, {2, 2}, {0, 1}, {0, 0}},
-			{{0, 0}, {1, 0}, {2, 0}, {0, 1}, {0, 2}},
-			{{0, 0}, {1, 0}, {2, 0}, {2, 1}, {2, 2}},
-			{{0, 2}, {1, 2}, {2, 2}, {2, 1}, {2, 0}},
-		},
-	}
-
-	for i, blocks := range tetrominos[g.grid[y][x]] {
-		for _, b := range blocks {
-			if b.x == x-g.fallingX && b.y == y-g.fallingY {
-				return i
-			}
-		}
-	}
-	return 0
-}
-
-func (g *Game) lockPiece() {
-	//Idem a la función de rotaciónFromGrid
-	tetrominos := map[int][][]struct{ x, y int }{
-		1: { // I
-			{{0, 0}, {1, 0}, {2, 0}, {3, 0}},
-			{{1, -1}, {1, 0}, {1, 1}, {1, 2}},
-			{{0, 1}, {1, 1}, {2, 1}, {3, 1}},
-			{{2, -1}, {2, 0}, {2, 1}, {2, 2}},
-		},
-		2: { // O - No rota
-			{{0, 0}, {1, 0}, {0, 1}, {1, 1}},
-			{{0, 0}, {1, 0}, {0, 1}, {1, 1}},
-			{{0, 0}, {1, 0}, {0, 1}, {1, 1}},
-			{{0, 0}, {1, 0}, {0, 1}, {1, 1}},
-		},
-		3: { // T
-			{{1, 0}, {0, 1}, {1, 1}, {2, 1}},
-			{{1, 0}, {1, 1}, {2, 1}, {1, 2}},
-			{{0, 1}, {1, 1}, {2, 1}, {1, 2}},
-			{{1, 0}, {0, 1}, {1, 1}, {1, 2}},
-		},
-		4: { // L
-			{{0, 0}, {0, 1}, {0, 2}, {1, 2}},
-			{{0, 0}, {1, 0}, {2, 0}, {0, 1}},
-			{{0, 0}, {1, 0}, {1, 1}, {1, 2}},
-			{{2, 0}, {0, 1}, {1, 1}, {2, 1}},
-		},
-		5: { // J
-			{{1, 0}, {1, 1}, {0, 2}, {1, 2}},
-			{{0, 0}, {0, 1}, {1, 1}, {2, 1}},
-			{{0, 0}, {1, 0}, {0, 1}, {0, 2}},
-			{{0, 0}, {1, 0}, {2, 0}, {2, 1}},
-		},
-		6: { // Z
-			{{0, 0}, {1, 0}, {1, 1}, {2, 1}},
-			{{2, 0}, {1, 1}, {2, 1}, {1, 2}},
-			{{0, 1}, {1, 1}, {1, 2}, {2, 2}},
-			{{1, 0}, {0, 1}, {1, 1}, {0, 2}},
-		},
-		7: { // S
-			{{1, 0}, {2, 0}, {0, 1}, {1, 1}},
-			{{1, 0}, {1, 1}, {2, 1}, {2, 2}},
-			{{1, 1}, {2, 1}, {0, 2}, {1, 2}},
-			{{0, 0}, {0, 1}, {1, 1}, {1, 2}},
-		},
-		8: { // U
-			{{1, 0}, {0, 0}, {0, 1}, {0, 2}, {1, 2}},
-			{{0, 1}, {0, 0}, {1, 0}, {2, 0}, {2, 1}},
-			{{0, 0}, {1, 0}, {1, 1}, {1, 2}, {0, 2}},
-			{{0, 0}, {0, 1}, {1, 1}, {2, 1}, {2, 0}},
-		},
-		9: { // Pieza Especial 1
-			{{2, 0}, {2, 1}, {1, 1}, {1, 2}, {0, 2}},
-			{{1, 0}, {1, 1}, {1, 2}, {0, 1}, {2, 1}},
-			{{0, 0}, {0, 1}, {1, 1}, {2, 1}, {2, 2}},
-			{{2, 0}, {2, 1}, {1, 1}, {0, 1}, {0, 2}},
-		},
-		10: { // | grande
-			{{0, 0}, {1, 0}, {2, 0}, {3, 0}, {4, 0}},
-			{{2, 0}, {2, 1}, {2, 2}, {2, 3}, {2, 4}},
-			{{0, 0}, {1, 0}, {2, 0}, {3, 0}, {4, 0}},
-			{{2, 0}, {2, 1}, {2, 2}, {2, 3}, {2, 4}},
-		},
-		11: { // Otra
-			{{0, 2}, {1, 2}, {2, 2}, {0, 1}, {0, 0}},
-			{{0, 0}, {1, 0}, {2, 0}, {0, 1}, {0, 2}},
-			{{0, 0}, {1, 0}, {2, 0}, {2, 1}, {2, 2}},
-			{{0, 2}, {1, 2}, {2, 2}, {2, 1}, {2, 0}},
-		},
-	}
-
-	//Obtenemos la forma actual según la rotación
-	currentShape := tetrominos[g.fallingCol][g.fallingRotation]
-
-	//Verificamos si toda la pieza puede ser colocada
-	canLock := true
-	for _, block := range currentShape {
-		newX := g.fallingX + block.x
-		newY := g.fallingY + block.y
-
-		//Importante: límites y colisiones
-		if newX < 0 || newX >= GridWidth || newY >= GridHeight {
-			canLock = false
-			break
-		}
-		if newY >= 0 && g.grid[newY][newX] != 0 {
-			canLock = false
-			break
-		}
-	}
-
-	//Si no se puede colocar, ajustar la posición Y hacia arriba
-	if !canLock {
-		g.fallingY--
-	}
-
-	//Colocamos la pieza completa en su posición final y mantener color y rotación
-	for _, block := range currentShape {
-
-		newX := g.fallingX + block.x
-		newY := g.fallingY + block.y
+// .... Mensaje, carteles y partículas del tablero avanzan con los ticks del juego ....
+func (g *Game) tickEffects() {
+	g.tickMessage()
+	g.tickPopups()
+	g.boardParticles = stepParticles(g.boardParticles)
+}
 
-		if newY >= 0 {
-			g.grid[newY][newX] = g.fallingCol
+// .... El mensaje se borra solo, y en pausa se queda quieto como todo lo demás ....
+func (g *Game) tickMessage() {
+	if g.messageTicks > 0 {
+		g.messageTicks--
+		if g.messageTicks == 0 {
+			g.message = ""
 		}
 	}
-
-	//Verificar si la pieza es especial y tocar sonido combo al lockear
-	if g.fallingSpecial {
-		g.playSound("special")
-	}
-
-	//Puntos por lockear pieza especial
-	if g.fallingSpecial {
-		g.score += 100
-	}
-
-	//puntos por lockear pieza normal
-	g.score += 10
-
-	//Reproducir sonido de bloqueo
-	g.playSound("lock")
-	g.checkAndClearMatches()
 }
 
-// .... Función para chequear si un nivel está completo ....
-func (g *Game) checkLevelComplete() bool {
-	//Verificar si hay menos del 99% de celdas ocupadas
-	occupied := 0
-	total := GridWidth * GridHeight
-
-	for y := 0; y < GridHeight; y++ {
-		for x := 0; x < GridWidth; x++ {
-			if g.grid[y][x] != 0 {
-				occupied++
+// .... Sonidos, mensajes y música según lo que avisó el motor ....
+func (g *Game) handleEvents(events []engine.Event) {
+	awards := 0 //Cada EventAward trae el siguiente premio de engine.Awards
+	for _, ev := range events {
+		switch ev {
+		case engine.EventSpecial:
+			//Tocar sonido combo al lockear una pieza especial
+			g.playSound("special")
+		case engine.EventLock:
+			g.playSound("lock")
+		case engine.EventMatch:
+			g.playSound("match")
+			g.dissolveRows()
+		case engine.EventHold:
+			g.playSound("select")
+		case engine.EventGarbage:
+			g.playSound("lock")
+		case engine.EventAttack:
+			g.playSound("special")
+		case engine.EventAward:
+			g.addPopup(g.engine.Awards[awards])
+			awards++
+		case engine.EventLevelUp:
+			g.nextLevel()
+		case engine.EventTopOut:
+			//Zen: el tablero se llenó y se vació
+			g.playSound("special")
+			g.message = "TABLERO VACIADO"
+			g.messageTicks = 2 * engine.TPS
+		case engine.EventGameOver:
+			//Un replay ya está guardado, solo se termina; en versus decide el Match
+			if g.match != nil {
+				g.message = "K.O."
+				g.messageTicks = 0
+			} else if g.Estado != EstadoReplay {
+				g.gameOver()
 			}
 		}
 	}
-
-	return float64(occupied)/float64(total) < 0.99
 }
 
 func (g *Game) nextLevel() {
-	g.level++
-	g.timer = g.timeLimit
-	g.speed = max(5, VelocidadInicial-g.level*6)
 	g.playSound("levelup")
 	// Mostrar mensaje de nivel y luego borrarlo
-	g.message = fmt.Sprintf("NIVEL %d", g.level)
-	go func() {
-		time.Sleep(2 * time.Second)
-		g.message = ""
-	}()
+	g.message = fmt.Sprintf("NIVEL %d", g.engine.Level)
+	g.messageTicks = 2 * engine.TPS
 
 	g.changeBgmForLevel()
 }
@@ -1412,6 +1186,7 @@ func (g *Game) nextLevel() {
 // .... Función de game over ....
 func (g *Game) gameOver() {
 	g.Estado = EstadoGameOver
+	g.highScoreMode = scoreTableMode(g.engine.Config.Mode)
 	g.playSound("gameover")
 	// Deja de tocar la música
 	if g.bgms[g.currentBgm] != nil && g.bgms[g.currentBgm].IsPlaying() {
@@ -1421,83 +1196,6 @@ func (g *Game) gameOver() {
 	g.saveHighScore()
 }
 
-// Verificamos si una línea (de las que se chequean) es especial
-func (g *Game) checkSpecialLine(y int) bool {
-	for x := 0; x < GridWidth; x++ {
-		if g.grid[y][x] == 0 {
-			return false
-		}
-	}
-	return true
-}
-
-// ....Función para chequear y limpiar líneas completas ....
-func (g *Game) checkAndClearMatches() {
-	//Reglas de un tetris normal: 1 línea = 100 puntos, 2 líneas = 300 puntos, 3 líneas = 500 puntos, 4 líneas = 800 puntos
-	//Si se eliminan más de 4 líneas a la vez, se obtiene un bonus de 1200 puntos
-	//Si se elimina una línea especial, se obtiene un bonus de 200 puntos
-	//Si se elimina una línea especial y una normal, se obtiene un bonus de 400 puntos
-
-	// Verificar si hay líneas completas
-	lines := 0
-	specialLines := 0
-	for y := 0; y < GridHeight; y++ {
-		full := true
-		for x := 0; x < GridWidth; x++ {
-			if g.grid[y][x] == 0 {
-				full = false
-				break
-			}
-		}
-
-		if full {
-			lines++
-			if g.checkSpecialLine(y) {
-				specialLines++
-			}
-			// Eliminar la línea
-			for y2 := y; y2 > 0; y2-- {
-				for x := 0; x < GridWidth; x++ {
-					g.grid[y2][x] = g.grid[y2-1][x]
-				}
-			}
-		}
-
-	}
-
-	//Calcular puntaje
-	points := 0
-	if lines > 0 {
-		switch lines {
-		case 1:
-			points = 100
-		case 2:
-			points = 300
-		case 3:
-			points = 500
-		case 4:
-			points = 800
-		default:
-			points = 1200
-		}
-
-		//Bonuses por líneas especiales
-		if specialLines > 0 {
-			points += specialLines * 200
-		}
-
-		//Bonus por líneas especiales y normales
-		if specialLines > 0 && lines > 0 {
-			points += specialLines * 200
-
-		}
-
-		//Aplicar puntaje
-		g.score += points
-		g.playSound("match")
-	}
-}
-
 // .... Función de update para el estado de pausa, aquí se manejan las acciones ....
 func (g *Game) updatePause() error {
 	if inpututil.IsKeyJustPressed(ebiten.KeyP) {
@@ -1512,6 +1210,21 @@ func (g *Game) updatePause() error {
 }
 
 func (g *Game) updateGameOver() error {
+	//Después de una partida en red se vuelve a la pantalla de red, o a la sala si sigue en el servidor
+	if g.net != nil && (inpututil.IsKeyJustPressed(ebiten.KeySpace) || inpututil.IsKeyJustPressed(ebiten.KeyEscape)) {
+		if g.sounds["gameover"] != nil && g.sounds["gameover"].IsPlaying() {
+			g.sounds["gameover"].Pause()
+			g.sounds["gameover"].Rewind()
+		}
+		g.endVersus()
+		if g.server != nil {
+			g.openServer(g.server)
+		} else {
+			g.openNetMenu()
+		}
+		return nil
+	}
+
 	if inpututil.IsKeyJustPressed(ebiten.KeySpace) {
 		g.Estado = EstadoMenu
 		//pausar sonido de gameover
@@ -1553,138 +1266,115 @@ func (g *Game) updateGameOver() error {
 
 func (g *Game) updateHighScores() error {
 	//Solo si se preta escape una vez, para no saltar 2 veces de pantalla
-	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) || inpututil.IsKeyJustPressed(ebiten.KeyLeft) {
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
 		g.Estado = EstadoPlayMenu
 		//sonido select
 		g.playSound("select")
 	}
 
-	return nil
-}
-
-func (g *Game) spawnPiece() {
-	g.fallingX = GridWidth / 2
-	g.fallingY = 0
-
-	//Usa la primera pieza del preview
-	g.fallingCol = g.nextPieces[0]
-	g.fallingSpecial = g.nextSpecial[0]
+	//Las flechas de lado cambian la tabla de modo
+	if inpututil.IsKeyJustPressed(ebiten.KeyRight) {
+		g.highScoreMode = nextScoreMode(g.highScoreMode, 1)
+		g.highScoreOption = 0
+		g.playSound("select")
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyLeft) {
+		g.highScoreMode = nextScoreMode(g.highScoreMode, -1)
+		g.highScoreOption = 0
+		g.playSound("select")
+	}
 
-	//Esto hace que se muevan todas las piezas una posición
-	for i := 0; i < 2; i++ {
-		g.nextPieces[i] = g.nextPieces[i+1]
-		g.nextSpecial[i] = g.nextSpecial[i+1]
+	scores := g.modeHighScores()
+	if len(scores) == 0 {
+		return nil
 	}
 
-	//Genera nueva pieza para el último espacio
-	g.nextPieces[2] = rand.Intn(11) + 1
-	g.nextSpecial[2] = rand.Float64() < ProbabiliSpecialPiece
+	//Flecha para elegir un puntaje y ENTER para ver su replay
+	if inpututil.IsKeyJustPressed(ebiten.KeyDown) {
+		g.highScoreOption = (g.highScoreOption + 1) % len(scores)
+		g.playSound("select")
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyUp) {
+		g.highScoreOption = (g.highScoreOption + len(scores) - 1) % len(scores)
+		g.playSound("select")
+	}
+	if g.highScoreOption >= len(scores) {
+		g.highScoreOption = 0
+	}
 
-	//Verifica Game Over
-	if !g.canMove(0, 0) {
-		g.gameOver()
+	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
+		score := scores[g.highScoreOption]
+		if score.Replay == "" {
+			return nil
+		}
+		r, err := engine.LoadReplay(score.Replay)
+		if err != nil {
+			log.Println(err)
+			return nil
+		}
+		g.playSound("select")
+		g.openReplay(r)
 	}
+
+	return nil
 }
 
 // .............................................
 
-func (g *Game) drawNextPieces(screen *ebiten.Image) {
-	previewX := GridWidth*SizeDelBlock - 520
-	previewY := 190
+// Lado de las celdas de las piezas siguientes y la guardada, no cambia con el tablero
+const previewCellSize = 20
 
+func (g *Game) drawNextPieces(screen *ebiten.Image) {
 	text.Draw(screen, "SIGUIENTE:", g.gameFont, 10, 150, (color.RGBA{150, 150, 255, 255}))
 
-	tetrominos := map[int][][]struct{ x, y int }{
-		1: { // I
-			{{0, 0}, {1, 0}, {2, 0}, {3, 0}},
-			{{1, -1}, {1, 0}, {1, 1}, {1, 2}},
-			{{0, 1}, {1, 1}, {2, 1}, {3, 1}},
-			{{2, -1}, {2, 0}, {2, 1}, {2, 2}},
-		},
-		2: { // O - No rota
-			{{0, 0}, {1, 0}, {0, 1}, {1, 1}},
-			{{0, 0}, {1, 0}, {0, 1}, {1, 1}},
-			{{0, 0}, {1, 0}, {0, 1}, {1, 1}},
-			{{0, 0}, {1, 0}, {0, 1}, {1, 1}},
-		},
-		3: { // T
-			{{1, 0}, {0, 1}, {1, 1}, {2, 1}},
-			{{1, 0}, {1, 1}, {2, 1}, {1, 2}},
-			{{0, 1}, {1, 1}, {2, 1}, {1, 2}},
-			{{1, 0}, {0, 1}, {1, 1}, {1, 2}},
-		},
-		4: { // L
-			{{0, 0}, {0, 1}, {0, 2}, {1, 2}},
-			{{0, 0}, {1, 0}, {2, 0}, {0, 1}},
-			{{0, 0}, {1, 0}, {1, 1}, {1, 2}},
-			{{2, 0}, {0, 1}, {1, 1}, {2, 1}},
-		},
-		5: { // J
-			{{1, 0}, {1, 1}, {0, 2}, {1, 2}},
-			{{0, 0}, {0, 1}, {1, 1}, {2, 1}},
-			{{0, 0}, {1, 0}, {0, 1}, {0, 2}},
-			{{0, 0}, {1, 0}, {2, 0}, {2, 1}},
-		},
-		6: { // Z
-			{{0, 0}, {1, 0}, {1, 1}, {2, 1}},
-			{{2, 0}, {1, 1}, {2, 1}, {1, 2}},
-			{{0, 1}, {1, 1}, {1, 2}, {2, 2}},
-			{{1, 0}, {0, 1}, {1, 1}, {0, 2}},
-		},
-		7: { // S
-			{{1, 0}, {2, 0}, {0, 1}, {1, 1}},
-			{{1, 0}, {1, 1}, {2, 1}, {2, 2}},
-			{{1, 1}, {2, 1}, {0, 2}, {1, 2}},
-			{{0, 0}, {0, 1}, {1, 1}, {1, 2}},
-		},
-		8: { // U
-			{{1, 0}, {0, 0}, {0, 1}, {0, 2}, {1, 2}},
-			{{0, 1}, {0, 0}, {1, 0}, {2, 0}, {2, 1}},
-			{{0, 0}, {1, 0}, {1, 1}, {1, 2}, {0, 2}},
-			{{0, 0}, {0, 1}, {1, 1}, {2, 1}, {2, 0}},
-		},
-		9: { // Pieza Especial 1
-			{{2, 0}, {2, 1}, {1, 1}, {1, 2}, {0, 2}},
-			{{1, 0}, {1, 1}, {1, 2}, {0, 1}, {2, 1}},
-			{{0, 0}, {0, 1}, {1, 1}, {2, 1}, {2, 2}},
-			{{2, 0}, {2, 1}, {1, 1}, {0, 1}, {0, 2}},
-		},
-		10: { // | grande
-			{{0, 0}, {1, 0}, {2, 0}, {3, 0}, {4, 0}},
-			{{2, 0}, {2, 1}, {2, 2}, {2, 3}, {2, 4}},
-			{{0, 0}, {1, 0}, {2, 0}, {3, 0}, {4, 0}},
-			{{2, 0}, {2, 1}, {2, 2}, {2, 3}, {2, 4}},
-		},
-		11: { // Otra
-			{{0, 2}, {1, 2}, {2, 2}, {0, 1}, {0, 0}},
-			{{0, 0}, {1, 0}, {2, 0}, {0, 1}, {0, 2}},
-			{{0, 0}, {1, 0}, {2, 0}, {2, 1}, {2, 2}},
-			{{0, 2}, {1, 2}, {2, 2}, {2, 1}, {2, 0}},
-		},
-	}
-
-	// Posiciones fijas para cada pieza preview
-	previewPositions := []struct{ x, y int }{
-		{0, 0},     // Pieza 1
-		{0, 5},     // Pieza 2
-		{200, 200}, // Pieza 3
+	//Las tres piezas en columna bajo el texto
+	for i := 0; i < 3; i++ {
+		g.drawPreviewPiece(screen, 40, 170+i*80, previewCellSize, g.engine.NextPieces[i], g.engine.NextSpecial[i])
 	}
+}
 
-	for i := 0; i < 3; i++ {
-		currentShape := tetrominos[g.nextPieces[i]][0] // Usa la rotación 0
+// .... Pieza entera fuera del tablero, con la esquina de arriba a la izquierda en (x, y) y celdas de size ....
+func (g *Game) drawPreviewPiece(screen *ebiten.Image, x, y, size int, id int, mark engine.Mark) {
+	shape := g.engine.Pieces.Shape(id, 0) //Usa la rotación 0
+	if len(shape) == 0 {
+		return
+	}
+
+	//Las formas están alrededor del centro de giro, se corren para que partan en (x, y)
+	minX, minY := shape[0].X, shape[0].Y
+	for _, block := range shape {
+		minX, minY = min(minX, block.X), min(minY, block.Y)
+	}
 
-		for _, block := range currentShape {
-			x := previewX + previewPositions[i].x*SizeDelBlock + block.x*SizeDelBlock
-			y := previewY + previewPositions[i].y*SizeDelBlock + block.y*SizeDelBlock
+	//Usa un color especial si la pieza es especial
+	blockColor := color.RGBA{255, 255, 255, 255}
+	if mark != engine.MarkNone {
+		blockColor = color.RGBA{255, 215, 0, 255}
+	}
+	for _, block := range shape {
+		px := float64(x + (block.X-minX)*size)
+		py := float64(y + (block.Y-minY)*size)
+		g.drawBlockAt(screen, px, py, size, id, mark, blockColor)
+	}
+}
 
-			// Usa un color especial si la pieza es especial
-			if g.nextSpecial[i] {
-				g.drawBlock(screen, x/SizeDelBlock, y/SizeDelBlock, g.nextPieces[i], true, color.RGBA{255, 215, 0, 255})
-			} else {
-				g.drawBlock(screen, x/SizeDelBlock, y/SizeDelBlock, g.nextPieces[i], false, color.RGBA{255, 255, 255, 255})
-			}
-		}
+// .... Pieza guardada en el hold, a la derecha bajo el tiempo ....
+func (g *Game) drawHeldPiece(screen *ebiten.Image) {
+	labelX := PantallaWidth - 190
+	labelY := 220
+
+	//Gris si ya se usó el hold con esta pieza
+	labelColor := color.RGBA{150, 150, 255, 255}
+	if !g.engine.CanHold() {
+		labelColor = color.RGBA{100, 100, 100, 255}
+	}
+	text.Draw(screen, "GUARDADA:", g.gameFont, labelX, labelY, labelColor)
+
+	if g.engine.HeldPiece == 0 {
+		return
 	}
+
+	g.drawPreviewPiece(screen, labelX, labelY+20, previewCellSize, g.engine.HeldPiece, g.engine.HeldSpecial)
 }
 
 // .............................................
@@ -1731,6 +1421,22 @@ func (g *Game) Draw(screen *ebiten.Image) {
 		g.drawGameOver(screen)
 	case EstadoHighScores:
 		g.drawHighScores(screen)
+	case EstadoOpciones:
+		g.drawSettings(screen)
+	case EstadoReplay:
+		g.drawReplay(screen)
+	case EstadoModos:
+		g.drawModeSelect(screen)
+	case EstadoPuzzles:
+		g.drawPuzzleSelect(screen)
+	case EstadoRed:
+		g.drawNetMenu(screen)
+	case EstadoRedEspera:
+		g.drawNetWait(screen)
+	case EstadoServidor:
+		g.drawServerRooms(screen)
+	case EstadoSala:
+		g.drawRoom(screen)
 	}
 }
 
@@ -1741,10 +1447,16 @@ func (g *Game) drawMenu(screen *ebiten.Image) {
 		PantallaHeight/7,
 		color.White)
 
+	modeText := "MODO: " + engine.Rules(g.settings.Mode).Name
+	text.Draw(screen, modeText, g.retroFont,
+		PantallaWidth/2-len(modeText)*6,
+		PantallaHeight/7+40,
+		color.RGBA{255, 220, 100, 255})
+
 	instructions := []string{
 		"Presiona ESPACIO o ENTER para comenzar",
 		"Presiona H para ver puntajes altos",
-		"Presiona ← o ESC para volver al inicio",
+		"Presiona ← o ESC para cambiar el modo",
 		"Presiona S para salir",
 		"",
 		"--------------------------- RECUERDA ---------------------------",
@@ -1753,9 +1465,16 @@ func (g *Game) drawMenu(screen *ebiten.Image) {
 		"↓ para caída rápida,",
 		"X o Espacio para caída instantánea",
 		"Presiona ↑ o Z para rotar la figura",
+		"A para rotar al revés y S para media vuelta",
+		"C o Shift para guardar la pieza",
 		"Presiona P para pausar durante el juego",
 		"Presiona ESC para volver al menú durante el juego",
 	}
+	//En versus cada jugador tiene sus teclas
+	if engine.Rules(g.settings.Mode).Versus {
+		instructions = append(instructions[:7], versusHelp...)
+		instructions = append(instructions, "P pausa, ESC vuelve al menú")
+	}
 
 	for i, inst := range instructions {
 		text.Draw(screen, inst, g.retroFont,
@@ -1790,13 +1509,6 @@ func (g *Game) drawMenu(screen *ebiten.Image) {
 }
 
 func (g *Game) drawGame(screen *ebiten.Image) {
-	//Vemos draw del fondo del grid
-	gridBg := ebiten.NewImage(GridWidth*TamañoCell, GridHeight*TamañoCell)
-	gridBg.Fill(color.RGBA{40, 40, 40, 255})
-	op := &ebiten.DrawImageOptions{}
-	op.GeoM.Translate(float64((PantallaWidth-GridWidth*TamañoCell)/2), 10)
-	screen.DrawImage(gridBg, op)
-
 	//Cargar imagen de fondo
 	if g.background2Image == nil {
 		file, err := os.Open("componentes/background3.png")
@@ -1814,126 +1526,20 @@ func (g *Game) drawGame(screen *ebiten.Image) {
 	//Dibuja la imagen de fondo en la pantalla
 	screen.DrawImage(g.background2Image, nil)
 
-	//Dibujamos marco alrededor del grid
-	frameColor := color.RGBA{100, 100, 100, 255}
-	for x := 0; x < GridWidth; x++ {
-		g.drawBlock(screen, x, -1, 0, false, frameColor)
-		g.drawBlock(screen, x, GridHeight, 0, false, frameColor)
-	}
-	for y := -1; y <= GridHeight; y++ {
-		g.drawBlock(screen, -1, y, 0, false, frameColor)
-		g.drawBlock(screen, GridWidth, y, 0, false, frameColor)
-	}
-
-	//Dibujar el grid
-	for y := 0; y < GridHeight; y++ {
-		for x := 0; x < GridWidth; x++ {
-			if g.grid[y][x] != 0 {
-				g.drawBlock(screen, x, y, g.grid[y][x], false, color.RGBA{255, 255, 255, 255})
-			}
-		}
+	//En versus van los dos tableros, cada uno con lo suyo
+	if g.match != nil {
+		g.drawVersus(screen)
+		return
 	}
 
-	//Dibuja pieza cayendo
-	if g.Estado == EstadoGame {
-		//Se definen las formas de los tetrominos con sus 4 rotaciones
-		tetrominos := map[int][][]struct{ x, y int }{
-			1: { // I
-				{{0, 0}, {1, 0}, {2, 0}, {3, 0}},
-				{{1, -1}, {1, 0}, {1, 1}, {1, 2}},
-				{{0, 1}, {1, 1}, {2, 1}, {3, 1}},
-				{{2, -1}, {2, 0}, {2, 1}, {2, 2}},
-			},
-			2: { // O - No rota
-				{{0, 0}, {1, 0}, {0, 1}, {1, 1}},
-				{{0, 0}, {1, 0}, {0, 1}, {1, 1}},
-				{{0, 0}, {1, 0}, {0, 1}, {1, 1}},
-				{{0, 0}, {1, 0}, {0, 1}, {1, 1}},
-			},
-			3: { // T
-				{{1, 0}, {0, 1}, {1, 1}, {2, 1}},
-				{{1, 0}, {1, 1}, {2, 1}, {1, 2}},
-				{{0, 1}, {1, 1}, {2, 1}, {1, 2}},
-				{{1, 0}, {0, 1}, {1, 1}, {1, 2}},
-			},
-			4: { // L
-				{{0, 0}, {0, 1}, {0, 2}, {1, 2}},
-				{{0, 0}, {1, 0}, {2, 0}, {0, 1}},
-				{{0, 0}, {1, 0}, {1, 1}, {1, 2}},
-				{{2, 0}, {0, 1}, {1, 1}, {2, 1}},
-			},
-			5: { // J
-				{{1, 0}, {1, 1}, {0, 2}, {1, 2}},
-				{{0, 0}, {0, 1}, {1, 1}, {2, 1}},
-				{{0, 0}, {1, 0}, {0, 1}, {0, 2}},
-				{{0, 0}, {1, 0}, {2, 0}, {2, 1}},
-			},
-			6: { // Z
-				{{0, 0}, {1, 0}, {1, 1}, {2, 1}},
-				{{2, 0}, {1, 1}, {2, 1}, {1, 2}},
-				{{0, 1}, {1, 1}, {1, 2}, {2, 2}},
-				{{1, 0}, {0, 1}, {1, 1}, {0, 2}},
-			},
-			7: { // S
-				{{1, 0}, {2, 0}, {0, 1}, {1, 1}},
-				{{1, 0}, {1, 1}, {2, 1}, {2, 2}},
-				{{1, 1}, {2, 1}, {0, 2}, {1, 2}},
-				{{0, 0}, {0, 1}, {1, 1}, {1, 2}},
-			},
-			8: { // U
-				{{1, 0}, {0, 0}, {0, 1}, {0, 2}, {1, 2}},
-				{{0, 1}, {0, 0}, {1, 0}, {2, 0}, {2, 1}},
-				{{0, 0}, {1, 0}, {1, 1}, {1, 2}, {0, 2}},
-				{{0, 0}, {0, 1}, {1, 1}, {2, 1}, {2, 0}},
-			},
-			9: { // Pieza Especial 1
-				{{2, 0}, {2, 1}, {1, 1}, {1, 2}, {0, 2}},
-				{{1, 0}, {1, 1}, {1, 2}, {0, 1}, {2, 1}},
-				{{0, 0}, {0, 1}, {1, 1}, {2, 1}, {2, 2}},
-				{{2, 0}, {2, 1}, {1, 1}, {0, 1}, {0, 2}},
-			},
-			10: { // | grande
-				{{0, 0}, {1, 0}, {2, 0}, {3, 0}, {4, 0}},
-				{{2, 0}, {2, 1}, {2, 2}, {2, 3}, {2, 4}},
-				{{0, 0}, {1, 0}, {2, 0}, {3, 0}, {4, 0}},
-				{{2, 0}, {2, 1}, {2, 2}, {2, 3}, {2, 4}},
-			},
-			11: { // Otra
-				{{0, 2}, {1, 2}, {2, 2}, {0, 1}, {0, 0}},
-				{{0, 0}, {1, 0}, {2, 0}, {0, 1}, {0, 2}},
-				{{0, 0}, {1, 0}, {2, 0}, {2, 1}, {2, 2}},
-				{{0, 2}, {1, 2}, {2, 2}, {2, 1}, {2, 0}},
-			},
-		}
+	//El tablero se acomoda a sus medidas y a la celda elegida
+	g.layout = g.fitLayout()
+	g.drawBoard(screen)
 
-		//Dibuja preview de las próximas piezas
+	//Dibuja preview de las próximas piezas y la pieza guardada
+	if g.Estado == EstadoGame || g.Estado == EstadoReplay {
 		g.drawNextPieces(screen)
-
-		//Rotar la pieza cuando se presiona Z o Arriba
-		if inpututil.IsKeyJustPressed(ebiten.KeyZ) || inpututil.IsKeyJustPressed(ebiten.KeyUp) {
-			//Incrementa la rotación y hace que vuelva a 0 después de 4
-			g.fallingRotation = (g.fallingRotation + 1) % 4
-
-			//Verificamos si la nueva rotación es válida
-			if !g.isValidPosition(tetrominos[g.fallingCol][g.fallingRotation]) {
-				//Si no es válida, intentar rotar en sentido horario
-				g.fallingRotation = (g.fallingRotation + 3) % 4
-
-				//Si aún no es válida, volver a la rotación anterior
-				if !g.isValidPosition(tetrominos[g.fallingCol][g.fallingRotation]) {
-					g.fallingRotation = (g.fallingRotation + 1) % 4
-				}
-			}
-		}
-
-		//Obtenemos la forma del tetromino actual con su rotación
-		if blocks := tetrominos[g.fallingCol][g.fallingRotation]; len(blocks) > 0 {
-			for _, block := range blocks {
-				x := g.fallingX + block.x
-				y := g.fallingY + block.y
-				g.drawBlock(screen, x, y, g.fallingCol, g.fallingSpecial, color.RGBA{255, 255, 255, 255})
-			}
-		}
+		g.drawHeldPiece(screen)
 	}
 
 	//Dibujamos UI respecto a la posición de la pantalla
@@ -1942,17 +1548,21 @@ func (g *Game) drawGame(screen *ebiten.Image) {
 	uiX := PantallaWidth - 100 - uiPadding
 	uiY := uiPadding - 40
 
-	text.Draw(screen, fmt.Sprintf("Nivel: %d", g.level), g.gameFont,
+	text.Draw(screen, fmt.Sprintf("Nivel: %d", g.engine.Level), g.gameFont,
 		uiX, uiY, color.RGBA{225, 225, 225, 255})
 	uiY += uiTextHeight
 
-	text.Draw(screen, fmt.Sprintf("Puntos: %d", g.score), g.gameFont,
+	text.Draw(screen, fmt.Sprintf("Puntos: %d", g.engine.Score), g.gameFont,
 		uiX, uiY, color.RGBA{225, 225, 225, 255})
 	uiY += uiTextHeight
 
-	text.Draw(screen, fmt.Sprintf("Tiempo: %02d", g.timer), g.gameFont,
+	text.Draw(screen, "Tiempo: "+g.clockText(), g.gameFont,
 		uiX, uiY, color.RGBA{225, 225, 225, 255})
 
+	g.drawObjectives(screen)
+
+	g.drawPopups(screen)
+
 	if g.message != "" {
 		text.Draw(screen, g.message, g.retroFont,
 			PantallaWidth/2-len(g.message)*4,
@@ -1967,100 +1577,283 @@ func (g *Game) drawGame(screen *ebiten.Image) {
 		50, // posición Y
 		(color.RGBA{255, 120, 120, 255}))
 
-	playerText2 := fmt.Sprintf("%s", g.playerName)
+	//En un replay se muestra quién lo jugó
+	name := g.playerName
+	if g.Estado == EstadoReplay {
+		name = g.replay.Player
+	}
+	playerText2 := fmt.Sprintf("%s", name)
 	text.Draw(screen, playerText2, g.gameFont,
 		10,  // posición X
 		100, // posición Y
 		(color.RGBA{255, 120, 120, 255}))
 }
 
-func (g *Game) isValidPosition(blocks []struct{ x, y int }) bool {
-	for _, block := range blocks {
-		x := g.fallingX + block.x
-		y := g.fallingY + block.y
+// .... El tablero del jugador en su layout: marco, celdas, basura, limpiezas y la pieza que cae ....
+func (g *Game) drawBoard(screen *ebiten.Image) {
+	width, height := g.engine.Width(), g.engine.Height()
+
+	//Vemos draw del fondo del grid, encima de la imagen y justo bajo las celdas
+	gridBg := ebiten.NewImage(width*g.layout.cell, height*g.layout.cell)
+	gridBg.Fill(color.RGBA{40, 40, 40, 255})
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Translate(g.cellPosition(0, 0))
+	screen.DrawImage(gridBg, op)
 
-		//Verifica límites del grid
-		if x < 0 || x >= GridWidth || y >= GridHeight {
-			return false
+	//Dibujamos marco alrededor del grid
+	frameColor := color.RGBA{100, 100, 100, 255}
+	for x := 0; x < width; x++ {
+		g.drawBlock(screen, x, -1, 0, engine.MarkNone, frameColor)
+		g.drawBlock(screen, x, height, 0, engine.MarkNone, frameColor)
+	}
+	for y := -1; y <= height; y++ {
+		g.drawBlock(screen, -1, y, 0, engine.MarkNone, frameColor)
+		g.drawBlock(screen, width, y, 0, engine.MarkNone, frameColor)
+	}
+
+	//Dibujar el grid, cada celda con su pieza y su marca
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			cell := g.engine.Grid[y][x]
+			if cell.Empty() {
+				continue
+			}
+			g.drawBlock(screen, x, y, cell.Piece, cell.Mark, color.RGBA{255, 255, 255, 255})
+
+			//Las celdas recién lockeadas brillan un momento (las del tablero armado no se lockearon)
+			if age := g.engine.Ticks - cell.LockedAt; age < lockFlashTicks && !cell.Has(engine.CellGarbage) {
+				op := g.blockOptions(x, y, 0, color.RGBA{255, 255, 255, 255})
+				op.ColorM.Scale(1, 1, 1, 0.5*float64(lockFlashTicks-age)/lockFlashTicks)
+				screen.DrawImage(g.blockImage, op)
+			}
+		}
+	}
+
+	//Basura que viene en camino
+	g.drawGarbageMeter(screen)
+
+	//Líneas que se están limpiando y lo que queda de ellas
+	g.drawClearingRows(screen)
+	g.drawBoardParticles(screen)
+
+	//Dibuja pieza cayendo
+	if g.Estado == EstadoGame || g.Estado == EstadoReplay {
+		//Mientras se limpian líneas no hay pieza cayendo
+		if !g.engine.Clearing() {
+			//Sombra donde caería la pieza, si está activada en opciones
+			if g.settings.Ghost {
+				g.drawGhostPiece(screen)
+			}
+
+			for _, block := range g.engine.FallingBlocks() {
+				g.drawBlock(screen, block.X, block.Y, g.engine.FallingCol, g.engine.FallingSpecial, color.RGBA{255, 255, 255, 255})
+			}
+		}
+	}
+}
+
+// Ticks que brilla una celda recién lockeada
+const lockFlashTicks = 10
+
+// .... Objetivos del nivel con lo que se lleva, a la izquierda bajo las piezas siguientes ....
+func (g *Game) drawObjectives(screen *ebiten.Image) {
+	x, y := 10, 420
+	text.Draw(screen, "OBJETIVO:", g.gameFont, x, y, color.RGBA{150, 150, 255, 255})
+
+	//Los modos sin niveles con objetivos muestran su propia meta
+	for _, line := range g.modeGoals() {
+		y += 30
+		text.Draw(screen, line, g.retroFont, x, y, color.RGBA{225, 225, 225, 255})
+	}
+
+	for _, o := range g.engine.LevelGoals() {
+		y += 30
+		progress, target := g.engine.Goal(o)
+
+		line := ""
+		switch o.Kind {
+		case engine.ObjectiveLines:
+			line = fmt.Sprintf("Líneas %d/%d", progress, target)
+		case engine.ObjectiveScore:
+			line = fmt.Sprintf("Puntos %d/%d", progress, target)
+		case engine.ObjectiveSpecial:
+			line = fmt.Sprintf("Especiales %d/%d", progress, target)
+		case engine.ObjectiveSurvive:
+			line = "Sobrevive al tiempo"
 		}
 
-		//Verifica colisión con otras piezas
-		if y >= 0 && g.grid[y][x] != 0 {
-			return false
+		//Verde si ya está cumplido
+		lineColor := color.RGBA{225, 225, 225, 255}
+		if progress >= target {
+			lineColor = color.RGBA{120, 255, 120, 255}
 		}
+		text.Draw(screen, line, g.retroFont, x, y, lineColor)
+	}
+}
+
+func (g *Game) drawBlock(screen *ebiten.Image, x, y int, colorIdx int, mark engine.Mark, color color.RGBA) {
+	px, py := g.cellPosition(x, y)
+	g.drawBlockAt(screen, px, py, g.layout.cell, colorIdx, mark, color)
+}
 
+// .... Bloque en pantalla con la esquina en (px, py) y de lado size ....
+func (g *Game) drawBlockAt(screen *ebiten.Image, px, py float64, size int, colorIdx int, mark engine.Mark, color color.RGBA) {
+	//La basura de los alienígenas tiene su propio aspecto
+	if colorIdx == engine.GarbagePiece {
+		g.drawGarbageBlock(screen, px, py, size)
+		return
 	}
 
-	return true
+	op := g.blockOptionsAt(px, py, size, colorIdx, color)
+	screen.DrawImage(g.blockImage, op)
 
+	//Marca de la pieza especial (estrella, círculo o triángulo)
+	if markImage := g.specialMarks[mark.String()]; markImage != nil {
+		specialOp := &ebiten.DrawImageOptions{}
+		specialOp.GeoM = op.GeoM
+		screen.DrawImage(markImage, specialOp)
+	}
 }
 
-func (g *Game) drawBlock(screen *ebiten.Image, x, y int, colorIdx int, special bool, color color.RGBA) {
+// .... Bloque de basura: verde apagado, sin brillo y con el centro hundido ....
+func (g *Game) drawGarbageBlock(screen *ebiten.Image, px, py float64, size int) {
+	scale := blockScale(size)
 	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(scale, scale)
+	op.GeoM.Translate(px, py)
+	op.ColorM.Scale(0.35, 0.45, 0.35, 1)
+	screen.DrawImage(g.blockImage, op)
 
-	//Posiciona bloque
-	op.GeoM.Translate(
-		float64((PantallaWidth-GridWidth*TamañoCell)/2+x*TamañoCell),
-		float64(50+y*TamañoCell))
+	inner := &ebiten.DrawImageOptions{}
+	inner.GeoM.Scale(scale/2, scale/2)
+	inner.GeoM.Translate(px+float64(size)/4, py+float64(size)/4)
+	inner.ColorM.Scale(0.15, 0.25, 0.15, 0.9)
+	screen.DrawImage(g.blockImage, inner)
+}
 
-	switch colorIdx {
-	case 1: // I - Cian Metálico
-		op.ColorM.Scale(0.8, 1, 1, 1)
-		op.ColorM.Translate(0.1, 0.1, 0.1, 0)
+// .... Medidor de basura pendiente, una barra roja al lado izquierdo del tablero ....
+func (g *Game) drawGarbageMeter(screen *ebiten.Image) {
+	pending := min(g.engine.PendingGarbage, g.engine.Height())
+	if pending == 0 {
+		return
+	}
 
-	case 2: // O - Amarillo Neón
-		op.ColorM.Scale(1, 1, 0.7, 1)
-		op.ColorM.Translate(0.1, 0.1, 0.1, 0)
+	bar := ebiten.NewImage(6, pending*g.layout.cell)
+	bar.Fill(color.RGBA{255, 60, 60, 220})
+	op := &ebiten.DrawImageOptions{}
+	x, y := g.cellPosition(-1, g.engine.Height()-pending)
+	op.GeoM.Translate(x-10, y)
+	screen.DrawImage(bar, op)
+}
 
-	case 3: // T - Violeta Fosforescente
-		op.ColorM.Scale(0.8, 0.5, 0.8, 1)
-		op.ColorM.Translate(0.1, 0.1, 0.1, 0)
+// .... Sombra de la pieza que cae, donde la dejaría una caída instantánea ....
+func (g *Game) drawGhostPiece(screen *ebiten.Image) {
+	drop := g.engine.DropDistance()
+	if drop == 0 {
+		return
+	}
 
-	case 4: // L - Naranja Brillante
-		op.ColorM.Scale(1, 0.8, 0.5, 1)
-		op.ColorM.Translate(0.1, 0.1, 0.1, 0)
+	for _, block := range g.engine.FallingBlocks() {
+		if block.Y+drop < 0 {
+			continue
+		}
+		//Mismo color de la pieza pero translúcido
+		op := g.blockOptions(block.X, block.Y+drop, g.engine.FallingCol, color.RGBA{255, 255, 255, 255})
+		op.ColorM.Scale(1, 1, 1, 0.3)
+		screen.DrawImage(g.blockImage, op)
+	}
+}
 
-	case 5: // J - Azul Eléctrico
-		op.ColorM.Scale(0.5, 0.5, 1, 1)
-		op.ColorM.Translate(0.1, 0.1, 0.1, 0)
+// .... Las líneas que se limpian parpadean en blanco mientras dura la limpieza ....
+func (g *Game) drawClearingRows(screen *ebiten.Image) {
+	if !g.engine.Clearing() {
+		return
+	}
 
-	case 6: // Z - Rojo Rubí
-		op.ColorM.Scale(1, 0.5, 0.5, 1)
-		op.ColorM.Translate(0.1, 0.1, 0.1, 0)
+	//Se apaga de a poco, con un parpadeo cada 3 ticks
+	flash := 0.8 * (1 - g.engine.ClearProgress())
+	if (g.engine.Ticks/3)%2 == 0 {
+		flash *= 0.5
+	}
+	for _, row := range g.engine.Cleared {
+		for x := range row.Cells {
+			op := g.blockOptions(x, row.Y, 0, color.RGBA{255, 255, 255, 255})
+			op.ColorM.Scale(1, 1, 1, flash)
+			screen.DrawImage(g.blockImage, op)
+		}
+	}
+}
 
-	case 7: // S - Verde Esmeralda
-		op.ColorM.Scale(0.5, 1, 0.5, 1)
-		op.ColorM.Translate(0.1, 0.1, 0.1, 0)
+// .... Las celdas de las líneas limpiadas se deshacen en partículas de su color ....
+func (g *Game) dissolveRows() {
+	for _, row := range g.engine.Cleared {
+		for x, cell := range row.Cells {
+			rgb := [3]float64{1, 1, 1}
+			if cell.Piece == engine.GarbagePiece {
+				rgb = [3]float64{0.35, 0.45, 0.35}
+			}
+			if piece := g.engine.Pieces.Get(cell.Piece); piece != nil {
+				rgb = piece.Color
+				if piece.Rainbow {
+					rgb = [3]float64{rand.Float64(), rand.Float64(), rand.Float64()}
+				}
+			}
 
-	case 8: // U - Negro
+			px, py := g.cellPosition(x, row.Y)
+			for i := 0; i < 4; i++ {
+				g.boardParticles = append(g.boardParticles, newCellParticle(px, py, float64(g.layout.cell), rgb))
+			}
+		}
+	}
+}
 
-	case 9: // Pieza Especial - Multicolor/Arcoiris
-		t := float64(time.Now().UnixNano()/int64(time.Millisecond)) / 1000.0
-		r := math.Sin(t)*0.5 + 0.5
-		g := math.Sin(t+2.0*math.Pi/3.0)*0.5 + 0.5
-		b := math.Sin(t+4.0*math.Pi/3.0)*0.5 + 0.5
-		op.ColorM.Scale(r, g, b, 1)
-		op.ColorM.Translate(0.1, 0.1, 0.1, 0)
+func (g *Game) drawBoardParticles(screen *ebiten.Image) {
+	particleImg := ebiten.NewImage(3, 3)
+	particleImg.Fill(color.RGBA{255, 255, 255, 255})
 
-	case 10: // | grande - Azul Claro
-		op.ColorM.Scale(0.7, 0.7, 1, 1)
-		op.ColorM.Translate(0.1, 0.1, 0.1, 0)
-	case 11: // Otra - Rojo Vermellón
-		op.ColorM.Scale(0.7, 0.2, 0.8, 1)
-		op.ColorM.Translate(0.1, 0.1, 0.1, 0)
+	for _, p := range g.boardParticles {
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Translate(-1.5, -1.5) //Centra la partícula
+		op.GeoM.Scale(p.size, p.size)
+		op.GeoM.Translate(p.x, p.y)
+		op.ColorM.Scale(p.color[0], p.color[1], p.color[2], p.alpha)
+		screen.DrawImage(particleImg, op)
+	}
+}
 
-	default:
+// .... Posición y color de un bloque en el tablero ....
+func (g *Game) blockOptions(x, y int, colorIdx int, color color.RGBA) *ebiten.DrawImageOptions {
+	px, py := g.cellPosition(x, y)
+	return g.blockOptionsAt(px, py, g.layout.cell, colorIdx, color)
+}
+
+// .... Posición, tamaño y color de un bloque en pantalla ....
+func (g *Game) blockOptionsAt(px, py float64, size int, colorIdx int, color color.RGBA) *ebiten.DrawImageOptions {
+	op := &ebiten.DrawImageOptions{}
+
+	//Escala y posiciona bloque
+	op.GeoM.Scale(blockScale(size), blockScale(size))
+	op.GeoM.Translate(px, py)
+
+	//El color sale del set de piezas activo, sin pieza se usa el color pedido (marco, etc.)
+	if piece := g.engine.Pieces.Get(colorIdx); piece != nil {
+		if piece.Rainbow {
+			//Pieza Especial - Multicolor/Arcoiris
+			t := float64(time.Now().UnixNano()/int64(time.Millisecond)) / 1000.0
+			r := math.Sin(t)*0.5 + 0.5
+			g := math.Sin(t+2.0*math.Pi/3.0)*0.5 + 0.5
+			b := math.Sin(t+4.0*math.Pi/3.0)*0.5 + 0.5
+			op.ColorM.Scale(r, g, b, 1)
+		} else {
+			op.ColorM.Scale(piece.Color[0], piece.Color[1], piece.Color[2], 1)
+		}
+		op.ColorM.Translate(piece.Glow, piece.Glow, piece.Glow, 0)
+	} else {
 		op.ColorM.Scale(float64(color.R)/255, float64(color.G)/255, float64(color.B)/255, float64(color.A)/255)
 		op.ColorM.Translate(0.1, 0.1, 0.1, 0)
 	}
 
-	screen.DrawImage(g.blockImage, op)
-
-	if special {
-		specialOp := &ebiten.DrawImageOptions{}
-		specialOp.GeoM = op.GeoM
-		screen.DrawImage(g.specialMarks["star"], specialOp)
-	}
+	return op
 }
 
 func (g *Game) drawPause(screen *ebiten.Image) {
@@ -2084,18 +1877,42 @@ func (g *Game) drawGameOver(screen *ebiten.Image) {
 	overlay.Fill(color.RGBA{0, 0, 0, 180})
 	screen.DrawImage(overlay, nil)
 
+	if g.match != nil {
+		g.drawVersusOver(screen)
+		return
+	}
+
+	//Terminar sprint, ultra o zen no es perder
 	gameOverText := "GAME OVER"
+	gameOverColor := color.RGBA{255, 50, 50, 255}
+	if g.engine.Finished {
+		gameOverText = "TERMINADO"
+		if g.engine.ModeRules().Puzzle {
+			gameOverText = "PUZZLE RESUELTO"
+		}
+		gameOverColor = color.RGBA{120, 255, 120, 255}
+	}
 	text.Draw(screen, gameOverText, g.retroFont,
 		PantallaWidth/2-len(gameOverText)*6,
 		PantallaHeight/2-40,
-		color.RGBA{255, 50, 50, 255})
+		gameOverColor)
 
-	scoreText := fmt.Sprintf("Puntaje Final: %d", g.score)
+	scoreText := fmt.Sprintf("Puntaje Final: %d", g.engine.Score)
+	if g.engine.ModeRules().ByTime && g.engine.Finished {
+		scoreText = "Tiempo: " + formatTicks(g.engine.Ticks)
+	}
 	text.Draw(screen, scoreText, g.retroFont,
 		PantallaWidth/2-len(scoreText)*6,
 		PantallaHeight/2,
 		color.White)
 
+	//Con la semilla se puede jugar de nuevo la misma secuencia de piezas
+	seedText := fmt.Sprintf("Semilla: %d", g.engine.Seed)
+	text.Draw(screen, seedText, g.retroFont,
+		PantallaWidth/2-len(seedText)*6,
+		PantallaHeight/2+80,
+		color.RGBA{150, 150, 150, 255})
+
 	restartText := "Presiona ESPACIO o ESC para volver"
 	text.Draw(screen, restartText, g.retroFont,
 		PantallaWidth/2-len(restartText)*6,
@@ -2104,22 +1921,43 @@ func (g *Game) drawGameOver(screen *ebiten.Image) {
 }
 
 func (g *Game) drawHighScores(screen *ebiten.Image) {
-	titleText := "MEJORES PUNTAJES"
+	titleText := "< MEJORES PUNTAJES - " + engine.Rules(g.highScoreMode).Name + " >"
 	text.Draw(screen, titleText, g.retroFont,
 		PantallaWidth/2-len(titleText)*6,
 		40,
 		color.White)
 
-	for i, score := range g.highScores {
+	scores := g.modeHighScores()
+	for i, score := range scores {
 		scoreText := fmt.Sprintf("%d. %s - %d pts (Nivel %d)",
 			i+1, score.Name, score.Score, score.Level)
+		if engine.Rules(score.Mode).ByTime {
+			scoreText = fmt.Sprintf("%d. %s - %s (%d pts)", i+1, score.Name, formatTicks(score.Time), score.Score)
+		}
+		scoreColor := color.RGBA{200, 200, 200, 255}
+		if i == g.highScoreOption {
+			scoreColor = color.RGBA{255, 220, 100, 255}
+			text.Draw(screen, ">", g.retroFont, PantallaWidth/2-len(scoreText)*6-40, 100+i*30, scoreColor)
+		}
 		text.Draw(screen, scoreText, g.retroFont,
 			PantallaWidth/2-len(scoreText)*6,
 			100+i*30,
-			color.RGBA{200, 200, 200, 255})
+			scoreColor)
 	}
 
-	backText := "Presiona ESC o ← para volver"
+	//Los puntajes de antes de los replays no tienen uno
+	if g.highScoreOption < len(scores) {
+		replayText := "ENTER para ver el replay"
+		if scores[g.highScoreOption].Replay == "" {
+			replayText = "Este puntaje no tiene replay"
+		}
+		text.Draw(screen, replayText, g.retroFont,
+			PantallaWidth/2-len(replayText)*6,
+			PantallaHeight-80,
+			color.RGBA{150, 150, 150, 255})
+	}
+
+	backText := "← → cambia el modo, ESC para volver"
 	text.Draw(screen, backText, g.retroFont,
 		PantallaWidth/2-len(backText)*6,
 		PantallaHeight-40,
@@ -2148,10 +1986,24 @@ func min(a, b int) int {
 // ...............................................................
 // .... Función para hacer todo el setup del juego ....
 func main() {
+	piecesPath := flag.String("piezas", "", "archivo JSON con un set de piezas personalizado")
+	seed := flag.String("semilla", "", "semilla fija para las piezas (la misma semilla da la misma partida)")
+	levelsPath := flag.String("niveles", "", "archivo JSON con una tabla de niveles y sus objetivos")
+	replayPath := flag.String("replay", "", "archivo de replay para ver al abrir el juego (por ejemplo replays/ultima.json)")
+	hostAddr := flag.String("hostear", "", "hostea un versus en red en esa dirección al abrir el juego (por ejemplo :7777)")
+	joinAddr := flag.String("unirse", "", "se une al versus en red hosteado en esa dirección (por ejemplo 127.0.0.1:7777)")
+	serverAddr := flag.String("servidor", "", "entra al servidor de salas en esa dirección (por ejemplo 127.0.0.1:7779)")
+	name := flag.String("nombre", "", "nombre del jugador, sin pasar por la pantalla de nombre")
+	latency := flag.Duration("latencia", 0, "simula atraso en lo que se manda por la red (por ejemplo 80ms)")
+	jitter := flag.Duration("jitter", 0, "simula variación al azar del atraso de la red (por ejemplo 20ms)")
+	loss := flag.Float64("perdida", 0, "simula pérdida de mensajes de la red, entre 0 y 1 (por ejemplo 0.05; solo con rollback)")
+	flag.Parse()
+
 	ebiten.SetWindowSize(PantallaWidth, PantallaHeight)
 	ebiten.SetWindowTitle("FETRIS")
 	ebiten.SetWindowResizable(true)
 
+	//El azar global queda solo para lo visual (partículas), cada partida usa su semilla
 	rand.Seed(time.Now().UnixNano())
 
 	//Colocar ícono de la ventana
@@ -2180,7 +2032,70 @@ func main() {
 		log.Fatalf("Error al inicializar el audio: %v", err)
 	}
 
-	if err := ebiten.RunGame(NewGame()); err != nil {
+	//Set de piezas personalizado, si se pidió uno
+	if *piecesPath != "" {
+		set, err := engine.LoadPieceSet(*piecesPath)
+		if err != nil {
+			log.Fatalf("Error al cargar las piezas: %v", err)
+		}
+		game.engine.Pieces = set
+	}
+
+	//Los puzzles nombran sus piezas, así que se cargan con el set ya elegido
+	game.loadPuzzles(puzzleDir)
+
+	//Tabla de niveles personalizada, si se pidió una
+	if *levelsPath != "" {
+		levels, err := engine.LoadLevelTable(*levelsPath)
+		if err != nil {
+			log.Fatalf("Error al cargar los niveles: %v", err)
+		}
+		game.engine.Levels = levels
+	}
+
+	//Semilla fija desde la línea de comandos
+	if *seed != "" {
+		if _, err := strconv.ParseInt(*seed, 10, 64); err != nil {
+			log.Fatalf("Semilla inválida %q: %v", *seed, err)
+		}
+		game.flagSeed = *seed
+	}
+
+	if *name != "" {
+		game.playerName = *name
+		game.Estado = EstadoPlayMenu
+	}
+
+	//Replay adjunto a un reporte: se abre directo en el visor, aunque venga con -nombre
+	if *replayPath != "" {
+		r, err := engine.LoadReplay(*replayPath)
+		if err != nil {
+			log.Fatalf("Error al cargar el replay: %v", err)
+		}
+		game.openReplay(r)
+	}
+
+	//Red simulada, para probar el versus en red sin salir del computador
+	if *loss < 0 || *loss > 1 {
+		log.Fatalf("Pérdida inválida %v: tiene que ser entre 0 y 1", *loss)
+	}
+	game.lobby.conditions = netplay.Conditions{Latency: *latency, Jitter: *jitter, Loss: *loss}
+
+	//Versus en red directo, para probar con dos ventanas en el mismo computador
+	if *hostAddr != "" {
+		game.openNetMenu()
+		game.hostNet(*hostAddr)
+	} else if *joinAddr != "" {
+		game.openNetMenu()
+		game.lobby.address = *joinAddr
+		game.joinNet(*joinAddr)
+	} else if *serverAddr != "" {
+		game.openNetMenu()
+		game.lobby.server = *serverAddr
+		game.connectServer(*serverAddr)
+	}
+
+	if err := ebiten.RunGame(game); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+
+	"github.com/Efocor/FETRIS/engine"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+)
+
+// .... Qué pide cada modo, para la pantalla de selección ....
+func (g *Game) modeDescription(mode engine.ModeKind) string {
+	switch mode {
+	case engine.ModeMarathon:
+		return "Sin reloj: cada 10 líneas sube el nivel, hasta que pierdas"
+	case engine.ModeSprint:
+		return fmt.Sprintf("Haz %d líneas lo más rápido que puedas", engine.Rules(mode).LineGoal)
+	case engine.ModeUltra:
+		return fmt.Sprintf("El mejor puntaje en %d minutos", g.settings.UltraTime/60)
+	case engine.ModeZen:
+		return "Sin game over, termina cuando quieras con ESC"
+	case engine.ModePuzzle:
+		return "Tableros armados y piezas contadas, piensa y sobrevivirás"
+	case engine.ModeInvasion:
+		return "Los alienígenas atacan la Fetris: la basura sube desde abajo"
+	case engine.ModeVersus:
+		return "Dos jugadores en el mismo teclado, tus líneas son su basura"
+	default:
+		return "Cumple los objetivos de cada nivel antes del tiempo"
+	}
+}
+
+// .... Pantalla de selección de modo, entre JUGAR y las instrucciones ....
+func (g *Game) drawModeSelect(screen *ebiten.Image) {
+	screen.Fill(color.RGBA{29, 29, 41, 255})
+
+	text.Draw(screen, "ELIGE EL MODO DE JUEGO", g.retroFont, 200, 100, color.White)
+
+	for i := engine.ModeKind(0); i < engine.NumModes; i++ {
+		y := 150 + int(i)*48
+		nameColor := color.RGBA{200, 200, 200, 255}
+		if i == g.settings.Mode {
+			nameColor = color.RGBA{255, 220, 100, 255}
+			text.Draw(screen, ">", g.retroFont, 150, y, color.White)
+		}
+		text.Draw(screen, engine.Rules(i).Name, g.retroFont, 200, y, nameColor)
+		text.Draw(screen, g.modeDescription(i), g.storyFont, 200, y+25, color.RGBA{150, 150, 150, 255})
+	}
+
+	text.Draw(screen, "Elige con ↑ ↓, ENTER o → para seguir, ESC vuelve", g.retroFont, 100, 560, color.RGBA{150, 150, 150, 255})
+
+	g.drawParticles(screen)
+}
+
+// .... Update de la selección de modo; el modo elegido queda en las opciones ....
+func (g *Game) updateModeSelect() error {
+	if inpututil.IsKeyJustPressed(ebiten.KeyDown) {
+		g.settings.Mode = (g.settings.Mode + 1) % engine.NumModes
+		g.playSound("select")
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyUp) {
+		g.settings.Mode = (g.settings.Mode + engine.NumModes - 1) % engine.NumModes
+		g.playSound("select")
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) || inpututil.IsKeyJustPressed(ebiten.KeyRight) {
+		g.saveSettings()
+		g.Estado = EstadoMenu
+		//El modo puzzle pasa antes por la lista de puzzles
+		if engine.Rules(g.settings.Mode).Puzzle {
+			g.Estado = EstadoPuzzles
+		}
+		g.playSound("select")
+	} else if inpututil.IsKeyJustPressed(ebiten.KeyEscape) || inpututil.IsKeyJustPressed(ebiten.KeyLeft) {
+		g.Estado = EstadoPlayMenu
+		g.playSound("select")
+	}
+	return nil
+}
+
+// ¿El modo guarda puntajes? (los puzzles y el versus no)
+func hasScores(mode engine.ModeKind) bool {
+	rules := engine.Rules(mode)
+	return !rules.Puzzle && !rules.Versus
+}
+
+// .... Modo cuya tabla de puntajes se muestra (los puzzles y el versus no tienen) ....
+func scoreTableMode(mode engine.ModeKind) engine.ModeKind {
+	if !hasScores(mode) {
+		return engine.ModeFetris
+	}
+	return mode
+}
+
+// .... Siguiente tabla de puntajes hacia un lado ....
+func nextScoreMode(mode engine.ModeKind, dir int) engine.ModeKind {
+	for {
+		mode = (mode + engine.ModeKind(dir) + engine.NumModes) % engine.NumModes
+		if hasScores(mode) {
+			return mode
+		}
+	}
+}
+
+// .... Reloj de la partida: lo que queda si el modo tiene tiempo, si no lo jugado ....
+func (g *Game) clockText() string {
+	if g.engine.Timed() {
+		return fmt.Sprintf("%02d", g.engine.Timer)
+	}
+	return formatTicks(g.engine.Ticks)
+}
+
+// .... Ticks como minutos, segundos y centésimas (1:23.45) ....
+func formatTicks(ticks int) string {
+	cents := ticks * 100 / engine.TPS
+	return fmt.Sprintf("%d:%02d.%02d", cents/6000, cents/100%60, cents%100)
+}
+
+// .... Lo que pide el modo cuando no hay objetivos de nivel ....
+func (g *Game) modeGoals() []string {
+	mode := g.engine.ModeRules()
+	switch {
+	case mode.Puzzle && g.engine.Puzzle != nil:
+		used, total := g.engine.PuzzleProgress()
+		return []string{g.engine.Puzzle.Name, puzzleGoalText(g.engine.Puzzle.Goal), fmt.Sprintf("Piezas %d/%d", used, total)}
+	case mode.Versus:
+		return []string{
+			fmt.Sprintf("Líneas %d", g.engine.Lines),
+			fmt.Sprintf("Basura en camino: %d", g.engine.PendingGarbage),
+			fmt.Sprintf("Enviadas: %d", g.engine.Sent),
+		}
+	case mode.Invasion:
+		return []string{
+			fmt.Sprintf("Líneas %d", g.engine.Lines),
+			fmt.Sprintf("Basura en camino: %d", g.engine.PendingGarbage),
+			fmt.Sprintf("Otra fila en %ds", (g.engine.GarbageCountdown()+engine.TPS-1)/engine.TPS),
+		}
+	case mode.LineGoal > 0:
+		return []string{fmt.Sprintf("Líneas %d/%d", g.engine.Lines, mode.LineGoal)}
+	case mode.LinesPerLevel > 0:
+		return []string{
+			fmt.Sprintf("Líneas %d", g.engine.Lines),
+			fmt.Sprintf("Faltan %d para subir", g.engine.Level*mode.LinesPerLevel-g.engine.Lines),
+		}
+	case mode.TimeLimit:
+		return []string{"Haz todos los puntos", "antes del tiempo"}
+	case mode.NoTopOut:
+		return []string{fmt.Sprintf("Líneas %d", g.engine.Lines), "ESC termina"}
+	}
+	return nil
+}
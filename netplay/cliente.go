@@ -0,0 +1,291 @@
+package netplay
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/Efocor/FETRIS/engine"
+)
+
+// .... Conexión con el servidor dedicado ....
+// Fuera de la partida se usa para ver las salas, entrar a una y empezarla; cuando
+// el dueño la empieza, Update devuelve el inicio y la partida sigue con ServerMatch.
+type ServerConn struct {
+	*Peer
+	Name   string
+	Rooms  []RoomInfo //Última lista de salas que mandó el servidor
+	Room   *RoomInfo  //Sala donde se está, nil si no se entró a ninguna
+	Player int        //Índice propio en la sala
+	Notice string     //Último pedido que el servidor no hizo, y por qué
+}
+
+// .... Partida de la sala que el dueño mandó a empezar ....
+type ServerStart struct {
+	Setup   Setup
+	Player  int //Índice propio en la partida
+	Names   []string
+	Targets []engine.TargetKind //Objetivo con que empieza cada uno
+}
+
+// .... Se conecta al servidor en addr ....
+func DialServer(addr, name string) (*ServerConn, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, strconv.Itoa(DefaultServerPort))
+	}
+	conn, err := net.DialTimeout("tcp", addr, handshakeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return ConnectServer(conn, name)
+}
+
+// .... Saludo con el servidor sobre una conexión ya abierta ....
+func ConnectServer(conn net.Conn, name string) (*ServerConn, error) {
+	p := NewPeer(conn)
+	hello := Message{Kind: KindHello, Version: Version, Engine: engine.ReplayVersion, Name: name}
+	if err := p.Send(hello); err != nil {
+		p.Close("")
+		return nil, err
+	}
+
+	rooms, err := p.Receive(handshakeTimeout)
+	if err == nil {
+		err = checkHello(rooms, KindRooms)
+	}
+	if err != nil {
+		p.Close(err.Error())
+		return nil, &HandshakeError{err}
+	}
+	return &ServerConn{Peer: p, Name: name, Rooms: rooms.Rooms}, nil
+}
+
+// .... Pedidos al servidor; la respuesta llega después, por Update ....
+
+func (c *ServerConn) Refresh() error {
+	return c.Send(Message{Kind: KindRooms})
+}
+
+func (c *ServerConn) Create(name string) error {
+	return c.Send(Message{Kind: KindCreate, Name: name})
+}
+
+func (c *ServerConn) JoinRoom(id int) error {
+	return c.Send(Message{Kind: KindJoin, RoomID: id})
+}
+
+// Solo el dueño de la sala puede empezarla
+func (c *ServerConn) Start() error {
+	return c.Send(Message{Kind: KindStart})
+}
+
+// Desde el tick que sigue la basura propia va a kind
+func (c *ServerConn) SetTarget(kind engine.TargetKind) error {
+	return c.Send(Message{Kind: KindTarget, Target: kind})
+}
+
+// ¿Es el dueño de la sala?
+func (c *ServerConn) Owner() bool {
+	return c.Room != nil && c.Player == 0
+}
+
+// .... Lee lo que mandó el servidor fuera de la partida ....
+// Si la sala empezó devuelve el inicio; lo que llegó después queda para ServerMatch.
+func (c *ServerConn) Update() (*ServerStart, error) {
+	for {
+		m, ok, err := c.Poll()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, nil
+		}
+		if m.Kind == KindStart {
+			return c.startFrom(m)
+		}
+		if err := c.lobbyMessage(m); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Mensajes de las salas, que pueden llegar también durante la partida
+func (c *ServerConn) lobbyMessage(m Message) error {
+	switch m.Kind {
+	case KindRooms:
+		c.Rooms = m.Rooms
+	case KindRoom:
+		c.Room = m.Room
+		c.Player = m.Player
+	case KindError:
+		c.Notice = m.Reason
+	case KindBye:
+		if m.Reason != "" {
+			return fmt.Errorf("el servidor cortó: %s", m.Reason)
+		}
+		return ErrClosed
+	}
+	return nil
+}
+
+// Revisa el inicio que mandó el servidor
+func (c *ServerConn) startFrom(m Message) (*ServerStart, error) {
+	if m.Setup == nil || m.Room == nil || len(m.Room.Players) < MinRoomPlayers || m.Player >= len(m.Room.Players) {
+		return nil, fmt.Errorf("el servidor mandó una partida que no se puede jugar")
+	}
+	if err := m.Setup.validate(); err != nil {
+		return nil, err
+	}
+	c.Room = m.Room
+	c.Player = m.Player
+	return &ServerStart{Setup: *m.Setup, Player: m.Player, Names: m.Room.Players, Targets: m.Targets}, nil
+}
+
+// .... Partida de una sala del servidor, vista desde un cliente ....
+// Se juega cada tick que manda el servidor, con las entradas de todos; la entrada
+// propia se le manda y vuelve con el tick en que la jugó. Las huellas que manda
+// el servidor avisan si esta copia se separó de la suya.
+type ServerMatch struct {
+	Conn    *ServerConn
+	Match   *engine.Match
+	Tick    int //Ticks jugados
+	Waiting int //Updates seguidos sin ticks nuevos
+
+	player int
+	last   engine.Input //Última entrada mandada
+	over   bool
+	err    error
+}
+
+// .... Arma la partida con lo que mandó el servidor ....
+// m ya tiene un motor por jugador con Setup y empezó con su semilla.
+func NewServerMatch(c *ServerConn, start *ServerStart, m *engine.Match) *ServerMatch {
+	for i, t := range start.Targets {
+		if i < len(m.Players) {
+			m.SetTarget(i, t)
+		}
+	}
+	return &ServerMatch{Conn: c, Match: m, player: start.Player}
+}
+
+func (s *ServerMatch) Local() int {
+	return s.player
+}
+
+func (s *ServerMatch) Stalled() int {
+	return s.Waiting
+}
+
+func (s *ServerMatch) Over() bool {
+	return s.over
+}
+
+// .... Un update del juego con lo que se aprieta ahora ....
+// Juega todos los ticks que llegaron; los eventos de cada jugador van juntos.
+func (s *ServerMatch) Update(in engine.Input) ([][]engine.Event, error) {
+	if s.err != nil || s.over {
+		return nil, s.err
+	}
+
+	//Mantener algo apretado se manda una vez; los toques, siempre
+	if in != s.last || in&^heldInputs != 0 {
+		if err := s.Conn.Send(Message{Kind: KindInput, Input: in}); err != nil {
+			return nil, s.fail(err)
+		}
+		s.last = in
+	}
+
+	var events [][]engine.Event
+	for !s.over {
+		m, ok, err := s.Conn.Poll()
+		if err != nil {
+			return events, s.fail(err)
+		}
+		if !ok {
+			break
+		}
+		switch m.Kind {
+		case KindFrame:
+			step, err := s.frame(m)
+			if err != nil {
+				return events, s.fail(err)
+			}
+			if events == nil {
+				events = make([][]engine.Event, len(step))
+			}
+			for i := range step {
+				events[i] = append(events[i], step[i]...)
+			}
+		case KindEnd:
+			if err := s.end(m); err != nil {
+				return events, s.fail(err)
+			}
+		default:
+			if err := s.Conn.lobbyMessage(m); err != nil {
+				return events, s.fail(err)
+			}
+		}
+	}
+
+	if events == nil {
+		s.Waiting++
+	} else {
+		s.Waiting = 0
+	}
+	return events, nil
+}
+
+// Juega un tick como lo jugó el servidor
+func (s *ServerMatch) frame(m Message) ([][]engine.Event, error) {
+	if m.Tick != s.Tick || len(m.Inputs) != len(s.Match.Players) {
+		return nil, fmt.Errorf("%w: el servidor mandó el tick %d y acá va el %d", ErrDesync, m.Tick, s.Tick)
+	}
+	for _, i := range m.Left {
+		if i >= 0 && i < len(s.Match.Players) {
+			s.Match.Forfeit(i)
+		}
+	}
+	for i, t := range m.Targets {
+		if i < len(s.Match.Players) {
+			s.Match.SetTarget(i, t)
+		}
+	}
+	events := s.Match.Step(m.Inputs)
+	s.Tick++
+	if m.Hash != 0 && m.Hash != s.Match.Hash() {
+		return nil, fmt.Errorf("%w: en el tick %d el tablero no es el del servidor", ErrDesync, m.Tick)
+	}
+	return events, nil
+}
+
+// El servidor dice cómo terminó: tiene que ser lo mismo que acá
+func (s *ServerMatch) end(m Message) error {
+	if !s.Match.Over || m.Tick != s.Tick || m.Hash != s.Match.Hash() {
+		return fmt.Errorf("%w: el servidor terminó la partida en el tick %d y acá no", ErrDesync, m.Tick)
+	}
+	s.Match.Winner = m.Winner
+	s.over = true
+	return nil
+}
+
+// Guarda el error y se va del servidor
+func (s *ServerMatch) fail(err error) error {
+	if s.err == nil {
+		s.err = err
+		s.Conn.Close(closeReason(err))
+	}
+	return s.err
+}
+
+// .... Error que terminó la partida, nil si sigue ....
+func (s *ServerMatch) Err() error {
+	return s.err
+}
+
+// .... Deja la partida; si no había terminado se pierde, y se sale del servidor ....
+func (s *ServerMatch) Close() {
+	if s.err == nil && !s.over {
+		s.err = ErrClosed
+		s.Conn.Close("")
+	}
+}
@@ -0,0 +1,296 @@
+package netplay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Efocor/FETRIS/engine"
+)
+
+// Lo que se espera al conectarse y al saludo antes de rendirse
+const handshakeTimeout = 10 * time.Second
+
+// .... Errores de la conexión ....
+var (
+	ErrClosed   = errors.New("la conexión se cerró")
+	ErrPeerLeft = errors.New("el rival se fue")
+	ErrDesync   = errors.New("las partidas se desincronizaron")
+	ErrStalled  = errors.New("el rival dejó de contestar")
+)
+
+// .... Conexión con el otro jugador ....
+// Los mensajes que llegan se leen en otra goroutine y quedan en una cola, así el
+// juego los revisa en cada tick sin quedarse esperando.
+type Peer struct {
+	conn  net.Conn
+	enc   *json.Encoder
+	inbox chan Message
+	done  chan struct{} //Se cierra con Close, para que la lectura no quede esperando a nadie
+	link  *link         //Condiciones de red simuladas, nil si se manda directo
+
+	writeMu   sync.Mutex //Con la red simulada se escribe desde otra goroutine
+	mu        sync.Mutex
+	err       error //Primer error de la conexión, después de él no llega nada más
+	closeOnce sync.Once
+}
+
+// .... Empieza a leer los mensajes de conn ....
+func NewPeer(conn net.Conn) *Peer {
+	p := &Peer{
+		conn:  conn,
+		enc:   json.NewEncoder(conn),
+		inbox: make(chan Message, 256),
+		done:  make(chan struct{}),
+	}
+	go p.readLoop()
+	return p
+}
+
+// Lee mensajes hasta que la conexión se corta
+func (p *Peer) readLoop() {
+	dec := json.NewDecoder(p.conn)
+	for {
+		var m Message
+		if err := dec.Decode(&m); err != nil {
+			p.fail(err)
+			close(p.inbox)
+			return
+		}
+		select {
+		case p.inbox <- m:
+		case <-p.done:
+			close(p.inbox)
+			return
+		}
+	}
+}
+
+// Guarda el primer error, los siguientes son consecuencia de ese
+func (p *Peer) fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+// .... Error que cortó la conexión, nil si sigue abierta ....
+func (p *Peer) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// .... Manda un mensaje (con la red simulada, más tarde o nunca) ....
+func (p *Peer) Send(m Message) error {
+	if p.link != nil {
+		p.link.send(m)
+		return p.Err()
+	}
+	return p.write(m)
+}
+
+// Escribe el mensaje en la conexión
+func (p *Peer) write(m Message) error {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	if err := p.enc.Encode(m); err != nil {
+		p.fail(err)
+		return err
+	}
+	return nil
+}
+
+// .... Siguiente mensaje que llegó, sin esperar; false si no hay ....
+// Cuando la conexión se cortó y ya no quedan mensajes, devuelve el error.
+func (p *Peer) Poll() (Message, bool, error) {
+	select {
+	case m, ok := <-p.inbox:
+		if !ok {
+			return Message{}, false, p.closedErr()
+		}
+		return m, true, nil
+	default:
+		return Message{}, false, nil
+	}
+}
+
+// .... Espera el siguiente mensaje, como mucho timeout ....
+func (p *Peer) Receive(timeout time.Duration) (Message, error) {
+	select {
+	case m, ok := <-p.inbox:
+		if !ok {
+			return Message{}, p.closedErr()
+		}
+		return m, nil
+	case <-time.After(timeout):
+		return Message{}, fmt.Errorf("el rival no contestó en %v", timeout)
+	}
+}
+
+// .... Espera el siguiente mensaje sin límite (el servidor, con una goroutine por cliente) ....
+func (p *Peer) Next() (Message, error) {
+	m, ok := <-p.inbox
+	if !ok {
+		return Message{}, p.closedErr()
+	}
+	return m, nil
+}
+
+// Error para devolver con la cola ya cerrada
+func (p *Peer) closedErr() error {
+	if err := p.Err(); err != nil {
+		return err
+	}
+	return ErrClosed
+}
+
+// .... Avisa que se va (si todavía se puede) y cierra la conexión ....
+func (p *Peer) Close(reason string) error {
+	return p.CloseWith(Message{Kind: KindBye, Reason: reason})
+}
+
+// .... Cierra mandando bye, que puede llevar algo más (las últimas entradas) ....
+// El bye no pasa por la red simulada: lo que estaba atrasado sale de una vez y
+// después el bye, que llega siempre.
+func (p *Peer) CloseWith(bye Message) error {
+	if p.Err() == nil {
+		if p.link != nil {
+			p.link.flush()
+		}
+		p.write(bye)
+	}
+	p.fail(ErrClosed)
+	p.closeOnce.Do(func() { close(p.done) })
+	return p.conn.Close()
+}
+
+// .... Dirección del otro lado ....
+func (p *Peer) RemoteAddr() string {
+	return p.conn.RemoteAddr().String()
+}
+
+// .... Una partida ya acordada con el rival ....
+type Session struct {
+	*Peer
+	Local  int    //Índice del jugador propio en el versus: el host es el 0, el que se une el 1
+	Remote string //Nombre del rival
+	Setup  Setup  //Semilla y reglas de la partida
+}
+
+// .... Dirección para escuchar o conectarse: si no trae puerto, el de siempre ....
+func Address(addr string) string {
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	return net.JoinHostPort(addr, strconv.Itoa(DefaultPort))
+}
+
+// .... Hostea: espera a que se una alguien y le manda cómo se juega ....
+// Bloquea hasta que llega un rival (o se cierra ln); el juego lo llama en otra goroutine.
+func Host(ln net.Listener, name string, setup Setup) (*Session, error) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return nil, err
+		}
+		s, err := Accept(conn, name, setup)
+		if err == nil {
+			return s, nil
+		}
+		//Un cliente que no saluda bien no cierra la partida, se sigue esperando
+		var hsErr *HandshakeError
+		if !errors.As(err, &hsErr) {
+			return nil, err
+		}
+	}
+}
+
+// .... Se une a la partida hosteada en addr ....
+func Join(addr, name string) (*Session, error) {
+	conn, err := net.DialTimeout("tcp", Address(addr), handshakeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return Connect(conn, name)
+}
+
+// .... Saludo del lado del host sobre una conexión ya abierta ....
+// Sirve con cualquier net.Conn, por ejemplo los dos lados de un net.Pipe.
+func Accept(conn net.Conn, name string, setup Setup) (*Session, error) {
+	p := NewPeer(conn)
+	hello, err := p.Receive(handshakeTimeout)
+	if err == nil {
+		err = checkHello(hello, KindHello)
+	}
+	if err != nil {
+		p.Close(err.Error())
+		return nil, &HandshakeError{err}
+	}
+
+	start := Message{Kind: KindStart, Version: Version, Engine: engine.ReplayVersion, Name: name, Setup: &setup}
+	if err := p.Send(start); err != nil {
+		p.Close("")
+		return nil, err
+	}
+	return &Session{Peer: p, Local: 0, Remote: hello.Name, Setup: setup}, nil
+}
+
+// .... Saludo del lado del que se une ....
+func Connect(conn net.Conn, name string) (*Session, error) {
+	p := NewPeer(conn)
+	hello := Message{Kind: KindHello, Version: Version, Engine: engine.ReplayVersion, Name: name}
+	if err := p.Send(hello); err != nil {
+		p.Close("")
+		return nil, err
+	}
+
+	start, err := p.Receive(handshakeTimeout)
+	if err == nil {
+		err = checkHello(start, KindStart)
+	}
+	if err == nil && start.Setup == nil {
+		err = errors.New("el host no mandó las reglas de la partida")
+	}
+	if err == nil {
+		err = start.Setup.validate()
+	}
+	if err != nil {
+		p.Close(err.Error())
+		return nil, &HandshakeError{err}
+	}
+	return &Session{Peer: p, Local: 1, Remote: start.Name, Setup: *start.Setup}, nil
+}
+
+// Revisa que el saludo sea el esperado y del mismo FETRIS
+func checkHello(m Message, want Kind) error {
+	switch {
+	case m.Kind == KindBye:
+		return fmt.Errorf("el rival no quiso jugar: %s", m.Reason)
+	case m.Kind != want:
+		return fmt.Errorf("se esperaba un saludo y llegó un mensaje de tipo %d", m.Kind)
+	case m.Version != Version:
+		return fmt.Errorf("el rival habla la versión %d del protocolo, este FETRIS la %d", m.Version, Version)
+	case m.Engine != engine.ReplayVersion:
+		return fmt.Errorf("el rival juega con las reglas de la versión %d, este FETRIS con las de la %d", m.Engine, engine.ReplayVersion)
+	}
+	return nil
+}
+
+// .... El saludo no resultó: otra versión, otro programa, o el rival no contestó ....
+type HandshakeError struct {
+	Err error
+}
+
+func (e *HandshakeError) Error() string {
+	return "no se pudo acordar la partida: " + e.Err.Error()
+}
+
+func (e *HandshakeError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,227 @@
+package netplay
+
+import (
+	"encoding/json"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Efocor/FETRIS/engine"
+)
+
+// .... Partidas en la red local ....
+// El que hostea se queda escuchando en un grupo multicast; el que busca pregunta
+// al grupo cada tanto y cada host le contesta con su nombre, el modo y el puerto
+// donde espera. Como cada respuesta repite el número de la pregunta, de ahí sale
+// el ping. Varios FETRIS en el mismo computador escuchan el grupo a la vez, así
+// que también sirve para probar con varias ventanas.
+
+// Grupo multicast y puerto donde se buscan las partidas
+var lanGroup = &net.UDPAddr{IP: net.IPv4(239, 77, 77, 77), Port: DefaultPort + 1}
+
+// Cada cuánto se pregunta, y cuánto sin contestar antes de sacar al host de la lista
+const (
+	lanQueryInterval = time.Second
+	lanExpire        = 3 * lanQueryInterval
+)
+
+// Para ignorar otros programas que usen el mismo grupo
+const lanGame = "FETRIS"
+
+// .... Pregunta o respuesta por la red local ....
+// La pregunta lleva solo Game y Query; la respuesta además cómo es la partida.
+type lanMessage struct {
+	Game    string
+	Query   int
+	Version int             `json:",omitempty"`
+	Engine  int             `json:",omitempty"`
+	Name    string          `json:",omitempty"`
+	Mode    engine.ModeKind `json:",omitempty"`
+	Netcode NetcodeKind     `json:",omitempty"`
+	Port    int             `json:",omitempty"` //Puerto TCP donde espera el host, 0 en las preguntas
+}
+
+// .... Una partida hosteada que se encontró ....
+type LANGame struct {
+	Name       string
+	Mode       engine.ModeKind
+	Netcode    NetcodeKind
+	Addr       string        //Dónde unirse, IP y puerto
+	Ping       time.Duration //Ida y vuelta de la última respuesta
+	Compatible bool          //Habla el mismo protocolo y juega con el mismo motor
+
+	seen time.Time
+}
+
+// .... Anuncio de una partida hosteada: contesta a los que buscan ....
+type Announcer struct {
+	conn *net.UDPConn
+	info lanMessage
+}
+
+// .... Anuncia en la red local la partida que espera rival en port ....
+func Announce(name string, setup Setup, port int) (*Announcer, error) {
+	conn, err := net.ListenMulticastUDP("udp4", nil, lanGroup)
+	if err != nil {
+		return nil, err
+	}
+	a := &Announcer{conn: conn, info: lanMessage{
+		Game:    lanGame,
+		Version: Version,
+		Engine:  engine.ReplayVersion,
+		Name:    name,
+		Mode:    setup.Config.Mode,
+		Netcode: setup.Netcode,
+		Port:    port,
+	}}
+	go a.run()
+	return a, nil
+}
+
+// Contesta cada pregunta, repitiendo su número
+func (a *Announcer) run() {
+	buf := make([]byte, 1024)
+	for {
+		n, from, err := a.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		var q lanMessage
+		if json.Unmarshal(buf[:n], &q) != nil || q.Game != lanGame || q.Port != 0 {
+			continue
+		}
+		reply := a.info
+		reply.Query = q.Query
+		data, _ := json.Marshal(reply)
+		a.conn.WriteToUDP(data, from)
+	}
+}
+
+// .... Deja de anunciar la partida ....
+func (a *Announcer) Close() error {
+	return a.conn.Close()
+}
+
+// .... Búsqueda de partidas en la red local ....
+// Pregunta en otra goroutine; el juego revisa Games en cada tick sin esperar.
+type Browser struct {
+	conn *net.UDPConn
+	done chan struct{}
+
+	mu    sync.Mutex
+	query int               //Número de la última pregunta
+	asked map[int]time.Time //Cuándo salió cada pregunta, para el ping
+	games map[string]*LANGame
+	err   error //Por qué no salió la última pregunta (sin red, por ejemplo)
+}
+
+// .... Empieza a buscar partidas ....
+func Browse() (*Browser, error) {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	b := &Browser{
+		conn:  conn,
+		done:  make(chan struct{}),
+		asked: make(map[int]time.Time),
+		games: make(map[string]*LANGame),
+	}
+	go b.read()
+	go b.ask()
+	return b, nil
+}
+
+// Pregunta al grupo cada lanQueryInterval, hasta que se cierra
+func (b *Browser) ask() {
+	ticker := time.NewTicker(lanQueryInterval)
+	defer ticker.Stop()
+	for {
+		b.mu.Lock()
+		b.query++
+		q := b.query
+		b.asked[q] = time.Now()
+		delete(b.asked, q-int(lanExpire/lanQueryInterval))
+		b.mu.Unlock()
+
+		data, _ := json.Marshal(lanMessage{Game: lanGame, Query: q})
+		_, err := b.conn.WriteToUDP(data, lanGroup)
+		b.mu.Lock()
+		b.err = err
+		b.mu.Unlock()
+
+		select {
+		case <-ticker.C:
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// Junta las respuestas de los hosts
+func (b *Browser) read() {
+	buf := make([]byte, 1024)
+	for {
+		n, from, err := b.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		var m lanMessage
+		if json.Unmarshal(buf[:n], &m) != nil || m.Game != lanGame || m.Port <= 0 {
+			continue
+		}
+
+		now := time.Now()
+		addr := net.JoinHostPort(from.IP.String(), strconv.Itoa(m.Port))
+		b.mu.Lock()
+		sent, ok := b.asked[m.Query]
+		if ok {
+			b.games[addr] = &LANGame{
+				Name:       m.Name,
+				Mode:       m.Mode,
+				Netcode:    m.Netcode,
+				Addr:       addr,
+				Ping:       now.Sub(sent),
+				Compatible: m.Version == Version && m.Engine == engine.ReplayVersion,
+				seen:       now,
+			}
+		}
+		b.mu.Unlock()
+	}
+}
+
+// .... Partidas que contestaron hace poco, por nombre ....
+func (b *Browser) Games() []LANGame {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var games []LANGame
+	for addr, g := range b.games {
+		if time.Since(g.seen) > lanExpire {
+			delete(b.games, addr)
+			continue
+		}
+		games = append(games, *g)
+	}
+	sort.Slice(games, func(i, j int) bool {
+		if games[i].Name != games[j].Name {
+			return games[i].Name < games[j].Name
+		}
+		return games[i].Addr < games[j].Addr
+	})
+	return games
+}
+
+// .... Error de la última pregunta, nil si salió bien ....
+func (b *Browser) Err() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+// .... Deja de buscar ....
+func (b *Browser) Close() error {
+	close(b.done)
+	return b.conn.Close()
+}
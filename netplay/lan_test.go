@@ -0,0 +1,57 @@
+package netplay
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Efocor/FETRIS/engine"
+)
+
+// .... Una partida anunciada aparece al buscar, con su nombre y su puerto ....
+func TestLANDiscovery(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	setup := Setup{Config: engine.DefaultConfig(), Netcode: NetcodeLockstep}
+	setup.Config.Mode = engine.ModeVersus
+	name := "prueba-" + strconv.Itoa(port)
+
+	//Sin multicast (sin red, o un firewall) no hay nada que probar
+	a, err := Announce(name, setup, port)
+	if err != nil {
+		t.Skipf("no se puede escuchar el grupo multicast: %v", err)
+	}
+	defer a.Close()
+	b, err := Browse()
+	if err != nil {
+		t.Skipf("no se puede buscar en la red local: %v", err)
+	}
+	defer b.Close()
+
+	deadline := time.Now().Add(3 * lanQueryInterval)
+	for time.Now().Before(deadline) {
+		for _, g := range b.Games() {
+			if g.Name != name {
+				continue
+			}
+			if _, p, _ := net.SplitHostPort(g.Addr); p != strconv.Itoa(port) {
+				t.Fatalf("la partida se anunció en %s, esperaba en el puerto %d", g.Addr, port)
+			}
+			if !g.Compatible || g.Mode != engine.ModeVersus || g.Netcode != NetcodeLockstep {
+				t.Fatalf("la partida encontrada no es la anunciada: %+v", g)
+			}
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err := b.Err(); err != nil {
+		t.Skipf("la pregunta no salió por multicast: %v", err)
+	}
+	t.Fatal("no se encontró la partida anunciada")
+}
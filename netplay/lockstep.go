@@ -0,0 +1,202 @@
+package netplay
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Efocor/FETRIS/engine"
+)
+
+// .... Versus en red, tick a tick ....
+// La entrada de cada tick se manda Delay ticks antes de jugarla. Si la del
+// rival todavía no llega, la partida espera (Update no avanza) hasta que llegue.
+type Lockstep struct {
+	Session *Session
+	Match   *engine.Match
+	Delay   int //Ticks entre lo que se aprieta y el tick en que se juega
+	Tick    int //Ticks ya jugados
+	Waiting int //Updates seguidos esperando al rival
+
+	local  map[int]engine.Input //Entradas propias ya mandadas, por tick
+	remote map[int]engine.Input //Entradas del rival que llegaron, por tick
+	sent   int                  //Siguiente tick para el que se manda entrada
+	carry  engine.Input         //Lo apretado mientras se esperaba, va con la siguiente
+	checks checker
+	gone   error //El rival se fue o se cortó: se juega lo que alcanzó a mandar
+	err    error
+}
+
+// .... Arma el lockstep sobre la sesión y el versus ya empezado con su semilla ....
+func NewLockstep(s *Session, m *engine.Match, delay int) *Lockstep {
+	l := &Lockstep{
+		Session: s,
+		Match:   m,
+		Delay:   delay,
+		local:   make(map[int]engine.Input),
+		remote:  make(map[int]engine.Input),
+		checks:  newChecker(),
+	}
+	//Los primeros ticks no tienen entrada, pero se mandan igual: el rival no sabe el retraso propio
+	for l.sent < delay {
+		l.sendInput(0)
+	}
+	return l
+}
+
+// Manda la entrada del siguiente tick
+func (l *Lockstep) sendInput(in engine.Input) error {
+	l.local[l.sent] = in
+	l.sent++
+	return l.Session.Send(Message{Kind: KindInput, Tick: l.sent - 1, Input: in})
+}
+
+func (l *Lockstep) Local() int {
+	return l.Session.Local
+}
+
+func (l *Lockstep) Stalled() int {
+	return l.Waiting
+}
+
+func (l *Lockstep) Over() bool {
+	return l.Match.Over
+}
+
+// Índice del rival en el versus
+func (l *Lockstep) remoteIndex() int {
+	return 1 - l.Session.Local
+}
+
+// .... Un update del juego con lo que se aprieta ahora ....
+// Devuelve los eventos de cada jugador si se pudo jugar un tick, o nil si se
+// está esperando al rival. Cuando hay un error la partida ya no sigue.
+func (l *Lockstep) Update(in engine.Input) ([][]engine.Event, error) {
+	if l.err != nil {
+		return nil, l.err
+	}
+	if err := l.receive(); err != nil {
+		return nil, l.fail(err)
+	}
+
+	//Lo de este update se juega Delay ticks más adelante
+	in |= l.carry
+	l.carry = 0
+	if l.sent <= l.Tick+l.Delay {
+		if err := l.sendInput(in); err != nil {
+			return nil, l.fail(err)
+		}
+	} else {
+		//Solo las acciones de un toque se guardan para no perderlas
+		l.carry = in &^ heldInputs
+	}
+
+	theirs, ok := l.remote[l.Tick]
+	if !ok {
+		if l.gone != nil {
+			return nil, l.fail(l.gone)
+		}
+		l.Waiting++
+		if l.Waiting > StallLimit {
+			return nil, l.fail(ErrStalled)
+		}
+		return nil, nil
+	}
+	l.Waiting = 0
+
+	inputs := make([]engine.Input, 2)
+	inputs[l.Session.Local] = l.local[l.Tick]
+	inputs[l.remoteIndex()] = theirs
+	delete(l.local, l.Tick)
+	delete(l.remote, l.Tick)
+
+	events := l.Match.Step(inputs)
+	if err := l.check(l.Tick); err != nil {
+		return events, l.fail(err)
+	}
+	l.Tick++
+	return events, nil
+}
+
+// Lee todo lo que llegó. Si el rival se fue, lo que mandó antes igual se juega
+// (al terminar el versus los dos cierran, y el último tick puede no estar jugado acá)
+func (l *Lockstep) receive() error {
+	for l.gone == nil {
+		m, ok, err := l.Session.Poll()
+		if err != nil {
+			l.gone = err
+		}
+		if !ok {
+			return nil
+		}
+		switch m.Kind {
+		case KindInput:
+			l.remote[m.Tick] = m.Input
+		case KindCheck:
+			if err := l.checks.addTheirs(m); err != nil {
+				return err
+			}
+		case KindBye:
+			l.gone = byeError(m)
+		}
+	}
+	return nil
+}
+
+// Error de un rival que se fue, con lo que dijo
+func byeError(m Message) error {
+	if m.Reason != "" {
+		return fmt.Errorf("%w: %s", ErrPeerLeft, m.Reason)
+	}
+	return ErrPeerLeft
+}
+
+// .... Después de jugar un tick: se manda la huella propia y se guarda la que debería mandar el rival ....
+func (l *Lockstep) check(t int) error {
+	local := l.Match.Players[l.Session.Local]
+	if mustCheck(t, local.Outgoing) {
+		m := Message{Kind: KindCheck, Tick: t, Hash: l.Match.Hash(), Garbage: local.Outgoing}
+		if err := l.Session.Send(m); err != nil {
+			return err
+		}
+	}
+
+	//Lo mismo que el rival tuvo que mandar, según la copia propia de su partida
+	rival := l.Match.Players[l.remoteIndex()]
+	own := Message{Kind: KindCheck, Tick: t, Hash: l.Match.Hash(), Garbage: rival.Outgoing}
+	return l.checks.addOwn(t, own, mustCheck(t, rival.Outgoing))
+}
+
+// Guarda el error y avisa al rival por qué se corta
+func (l *Lockstep) fail(err error) error {
+	if l.err == nil {
+		//Si no se pudo mandar es porque el rival cortó: vale más lo que dijo él
+		l.receive()
+		if l.gone != nil && !errors.Is(err, ErrDesync) {
+			err = l.gone
+		}
+		l.err = err
+		l.Session.Close(closeReason(err))
+	}
+	return l.err
+}
+
+// Lo que se le dice al rival al cortar por un error
+func closeReason(err error) string {
+	if errors.Is(err, ErrPeerLeft) {
+		return ""
+	}
+	return err.Error()
+}
+
+// .... Error que terminó la partida en red, nil si sigue ....
+func (l *Lockstep) Err() error {
+	return l.err
+}
+
+// .... Termina la partida en red y cierra la conexión ....
+func (l *Lockstep) Close() {
+	if l.err == nil {
+		l.err = ErrClosed
+		l.Session.Close("")
+	}
+}
@@ -0,0 +1,138 @@
+package netplay
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Efocor/FETRIS/engine"
+)
+
+// .... Dos lados de un versus en lockstep, conectados por un net.Pipe ....
+func lockstepPair(t *testing.T, seed int64) [2]*Lockstep {
+	t.Helper()
+	//Los dos leen antes de mandar nada: en el pipe escribir espera al que lee
+	connA, connB := net.Pipe()
+	peers := []*Peer{NewPeer(connA), NewPeer(connB)}
+	var pair [2]*Lockstep
+	for i, peer := range peers {
+		s := &Session{Peer: peer, Local: i}
+		pair[i] = NewLockstep(s, newVersus(seed), DefaultInputDelay)
+	}
+	t.Cleanup(func() {
+		pair[0].Close()
+		pair[1].Close()
+	})
+	return pair
+}
+
+// Versus de dos ya empezado con la semilla
+func newVersus(seed int64) *engine.Match {
+	engines := []*engine.Engine{engine.New(), engine.New()}
+	for _, e := range engines {
+		e.Config.Mode = engine.ModeVersus
+	}
+	m := engine.NewMatch(engines)
+	m.Start(seed)
+	return m
+}
+
+// Entrada al azar: teclas que se mantienen un rato, y de vez en cuando una caída
+func randomInput(rnd *rand.Rand) engine.Input {
+	in := engine.Input(rnd.Intn(int(engine.InputHardDrop)))
+	if rnd.Intn(20) == 0 {
+		in |= engine.InputHardDrop
+	}
+	return in
+}
+
+// Juega los dos lados hasta que cada uno llegue al tick until, o hasta el primer error
+func playLockstep(pair [2]*Lockstep, rnd *rand.Rand, until int) error {
+	deadline := time.Now().Add(10 * time.Second)
+	for pair[0].Tick < until || pair[1].Tick < until {
+		if time.Now().After(deadline) {
+			return errors.New("los dos lados se quedaron esperando")
+		}
+		waiting := true
+		for _, l := range pair {
+			if l.Tick >= until || l.Over() {
+				continue
+			}
+			events, err := l.Update(randomInput(rnd))
+			if err != nil {
+				return err
+			}
+			if events != nil {
+				waiting = false
+			}
+		}
+		if pair[0].Over() && pair[1].Over() {
+			return nil
+		}
+		//Lo del rival llega por otra goroutine
+		if waiting {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	return nil
+}
+
+// .... Con las mismas entradas, los dos lados juegan la misma partida ....
+func TestLockstepSync(t *testing.T) {
+	pair := lockstepPair(t, 21)
+	const ticks = 10 * HashInterval
+	if err := playLockstep(pair, rand.New(rand.NewSource(1)), ticks); err != nil {
+		t.Fatal(err)
+	}
+	a, b := pair[0], pair[1]
+	if a.Tick != b.Tick {
+		t.Fatalf("los lados quedaron en ticks distintos: %d y %d", a.Tick, b.Tick)
+	}
+	if a.Match.Hash() != b.Match.Hash() {
+		t.Fatalf("en el tick %d las partidas no son iguales", a.Tick)
+	}
+	if a.Match.Players[0].Locks == 0 {
+		t.Fatal("no se lockeó ninguna pieza, la prueba no probó nada")
+	}
+}
+
+// .... Si un lado juega otra entrada que la que mandó, se avisa la desincronización ....
+func TestLockstepDesync(t *testing.T) {
+	pair := lockstepPair(t, 22)
+	rnd := rand.New(rand.NewSource(2))
+	if err := playLockstep(pair, rnd, 2*HashInterval+1); err != nil {
+		t.Fatal(err)
+	}
+
+	//La entrada ya mandada sigue igual para el rival, pero acá se juega otra
+	a := pair[0]
+	tick := a.Tick
+	in, ok := a.local[tick]
+	if !ok {
+		t.Fatalf("no hay entrada propia para el tick %d", tick)
+	}
+	a.local[tick] = in ^ engine.InputHardDrop
+
+	err := playLockstep(pair, rnd, tick+2*HashInterval)
+	if !errors.Is(err, ErrDesync) {
+		t.Fatalf("después de la entrada distinta del tick %d el error fue %v", tick, err)
+	}
+}
+
+// .... Si el rival deja de mandar entradas, la partida se corta en vez de esperar para siempre ....
+func TestLockstepStall(t *testing.T) {
+	pair := lockstepPair(t, 23)
+	a := pair[0]
+	var err error
+	for i := 0; i < 2*StallLimit && err == nil; i++ {
+		_, err = a.Update(0)
+	}
+	if !errors.Is(err, ErrStalled) {
+		t.Fatalf("después de %d updates esperando el error fue %v", a.Waiting, err)
+	}
+	if a.Waiting != StallLimit+1 {
+		t.Fatalf("se cortó después de %d updates esperando, el límite es %d", a.Waiting, StallLimit)
+	}
+}
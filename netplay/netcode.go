@@ -0,0 +1,118 @@
+package netplay
+
+import (
+	"fmt"
+
+	"github.com/Efocor/FETRIS/engine"
+)
+
+// .... Cómo se sincronizan las dos partidas ....
+type NetcodeKind int
+
+const (
+	NetcodeRollback NetcodeKind = iota //Se adivina la entrada del rival y se corrige al llegar
+	NetcodeLockstep                    //Se espera la entrada del rival en cada tick
+	NumNetcodes
+)
+
+// Ticks por defecto entre lo que se aprieta y el tick en que se juega
+const DefaultInputDelay = 2
+
+// Updates seguidos esperando al rival antes de dar la partida por cortada
+const StallLimit = 10 * engine.TPS
+
+// Cada tantos ticks se compara la huella de la partida (y siempre que alguien manda basura)
+const HashInterval = 30
+
+// Acciones que siguen mientras la tecla está apretada: se guardan y se adivinan distinto
+const heldInputs = engine.InputLeft | engine.InputRight | engine.InputSoftDrop
+
+// .... Lo que el juego necesita de la sincronización, sea cual sea ....
+type Netcode interface {
+	//Un update con lo que se aprieta ahora; devuelve los eventos de cada jugador
+	//si se jugó un tick, o nil si se está esperando al rival
+	Update(in engine.Input) ([][]engine.Event, error)
+	Local() int   //Índice del jugador propio en el versus
+	Stalled() int //Updates seguidos esperando al rival (más de StallLimit corta la partida)
+	Over() bool   //El versus terminó de verdad (no solo en lo que se adivinó)
+	Err() error   //Error que terminó la partida en red, nil si sigue
+	Close()       //Termina la partida en red y cierra la conexión
+}
+
+// .... Arma la sincronización que eligió el host, con el retraso de entrada propio ....
+// Cada lado puede usar otro retraso: las entradas van marcadas con su tick.
+func NewNetcode(s *Session, m *engine.Match, delay int) Netcode {
+	if delay < 0 {
+		delay = 0
+	}
+	if s.Setup.Netcode == NetcodeLockstep {
+		return NewLockstep(s, m, delay)
+	}
+	return NewRollback(s, m, delay)
+}
+
+// ¿Se manda huella en este tick?
+func mustCheck(t, garbage int) bool {
+	return t%HashInterval == 0 || garbage > 0
+}
+
+// Ticks que se guarda una huella propia esperando la del rival (puede haberse perdido)
+const checkWindow = 10 * engine.TPS
+
+// .... Huellas propias y del rival, para compararlas cuando están las dos ....
+type checker struct {
+	own    map[int]Message
+	theirs map[int]Message
+	done   int //Ticks propios ya revisados: hasta ahí se sabe cuáles llevan huella
+}
+
+func newChecker() checker {
+	return checker{own: make(map[int]Message), theirs: make(map[int]Message)}
+}
+
+// Resultado propio de un tick ya jugado con las entradas de los dos. has dice si
+// según la copia propia el rival tenía que mandar huella en ese tick.
+func (c *checker) addOwn(t int, m Message, has bool) error {
+	c.done = t + 1
+	delete(c.own, t-checkWindow)
+
+	theirs, hasTheirs := c.theirs[t]
+	delete(c.theirs, t)
+	switch {
+	case hasTheirs && !has:
+		return fmt.Errorf("%w: en el tick %d el rival mandó %d filas y acá no mandó nada", ErrDesync, t, theirs.Garbage)
+	case hasTheirs:
+		return compareChecks(m, theirs)
+	case has:
+		c.own[t] = m
+	}
+	return nil
+}
+
+// Huella que mandó el rival
+func (c *checker) addTheirs(m Message) error {
+	if m.Tick >= c.done {
+		c.theirs[m.Tick] = m
+		return nil
+	}
+	if m.Tick < c.done-checkWindow {
+		return nil
+	}
+	own, ok := c.own[m.Tick]
+	delete(c.own, m.Tick)
+	if !ok {
+		return fmt.Errorf("%w: en el tick %d el rival mandó %d filas y acá no mandó nada", ErrDesync, m.Tick, m.Garbage)
+	}
+	return compareChecks(own, m)
+}
+
+// Las dos huellas de un tick tienen que ser iguales
+func compareChecks(own, theirs Message) error {
+	switch {
+	case own.Garbage != theirs.Garbage:
+		return fmt.Errorf("%w: en el tick %d el rival mandó %d filas y acá salen %d", ErrDesync, own.Tick, theirs.Garbage, own.Garbage)
+	case own.Hash != theirs.Hash:
+		return fmt.Errorf("%w: en el tick %d el tablero no es el mismo", ErrDesync, own.Tick)
+	}
+	return nil
+}
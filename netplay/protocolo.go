@@ -0,0 +1,129 @@
+/*
+Paquete netplay: versus de a dos por la red.
+
+Los dos lados juegan la misma partida: el que hostea elige la semilla y las reglas
+y se las manda al otro al conectarse. Después cada uno manda lo que aprieta en cada
+tick. Con lockstep la partida avanza recién cuando llegaron las entradas de los dos;
+con rollback se adivina la del rival y, si llega otra, se vuelve atrás y se juega de
+nuevo. De vez en cuando se mandan la huella del estado y la basura enviada, para
+darse cuenta si las dos simulaciones se separaron.
+
+Con el servidor dedicado (cmd/fetris-server) se juega en salas de 2 a 8: cada
+cliente le manda lo que aprieta, el servidor juega cada tick con las entradas de
+todos y se las reparte, así todos juegan la misma partida y el que gana lo decide
+él, no los clientes.
+
+Los mensajes van por TCP como JSON, uno tras otro.
+*/
+package netplay
+
+import (
+	"fmt"
+
+	"github.com/Efocor/FETRIS/engine"
+)
+
+// Versión del protocolo: los dos lados tienen que hablar la misma
+const Version = 3
+
+// Puerto donde se hostea si no se dice otro
+const DefaultPort = 7777
+
+// .... Tipos de mensaje ....
+type Kind int
+
+const (
+	KindHello Kind = iota //El que se une se presenta
+	KindStart             //El host acepta y manda cómo se juega
+	KindInput             //Entrada de un tick
+	KindCheck             //Huella y basura de un tick ya jugado
+	KindBye               //Se va, la partida termina
+
+	//.... Con el servidor dedicado ....
+	KindRooms  //Lista de salas: el servidor la manda al saludar y cuando se le pide
+	KindCreate //Crear una sala y entrar
+	KindJoin   //Entrar a una sala
+	KindRoom   //Cómo está la sala donde se está
+	KindFrame  //Un tick jugado por el servidor, con las entradas de todos
+	KindTarget //A quién se le manda basura
+	KindEnd    //Terminó la partida de la sala
+	KindError  //El servidor no hizo lo que se le pidió
+)
+
+// .... Un mensaje del protocolo ....
+// Cada tipo usa solo algunos campos, el resto no se escribe.
+type Message struct {
+	Kind Kind
+
+	//KindHello y KindStart
+	Version int    `json:",omitempty"`
+	Engine  int    `json:",omitempty"` //engine.ReplayVersion: el motor tiene que jugar igual en los dos lados
+	Name    string `json:",omitempty"` //En KindCreate, el nombre de la sala
+	Setup   *Setup `json:",omitempty"` //Solo en KindStart
+	Player  int    `json:",omitempty"` //Con el servidor: índice propio en la sala y en la partida
+
+	//KindInput y KindCheck
+	Tick    int            `json:",omitempty"`
+	Input   engine.Input   `json:",omitempty"`
+	Inputs  []engine.Input `json:",omitempty"` //Rollback: las entradas desde Tick que el rival todavía no confirma
+	Ack     int            `json:",omitempty"` //Rollback: ticks del rival que ya llegaron, sin huecos
+	Hash    uint64         `json:",omitempty"`
+	Garbage int            `json:",omitempty"` //Filas que mandó el jugador en ese tick
+
+	//Salas y partidas del servidor
+	Rooms   []RoomInfo          `json:",omitempty"`
+	Room    *RoomInfo           `json:",omitempty"`
+	RoomID  int                 `json:",omitempty"`
+	Left    []int               `json:",omitempty"` //Jugadores que se fueron antes de este tick: pierden
+	Targets []engine.TargetKind `json:",omitempty"` //A quién apunta cada uno, cuando alguien cambió
+	Target  engine.TargetKind   `json:",omitempty"`
+	Winner  int                 `json:",omitempty"`
+
+	//KindBye y KindError
+	Reason string `json:",omitempty"`
+}
+
+// .... Cómo se juega la partida, lo decide el host ....
+type Setup struct {
+	Seed    int64
+	Netcode NetcodeKind //Cómo se sincronizan, los dos lados tienen que usar lo mismo
+	Config  engine.Config
+	Pieces  *engine.PieceSet
+	Levels  *engine.LevelTable
+}
+
+// .... Reglas y sets de un motor, para mandarlos al otro lado ....
+func SetupFrom(e *engine.Engine, seed int64, netcode NetcodeKind) Setup {
+	return Setup{Seed: seed, Netcode: netcode, Config: e.Config, Pieces: e.Pieces, Levels: e.Levels}
+}
+
+// .... Deja el motor listo para jugar con lo que mandó el host ....
+func (s Setup) Apply(e *engine.Engine) {
+	e.Config = s.Config
+	e.Config.Mode = engine.ModeVersus
+	e.Puzzle = nil
+	if s.Pieces != nil {
+		e.Pieces = s.Pieces
+	}
+	if s.Levels != nil {
+		e.Levels = s.Levels
+	}
+}
+
+// Revisa que los sets que llegaron se puedan jugar
+func (s Setup) validate() error {
+	if s.Netcode < 0 || s.Netcode >= NumNetcodes {
+		return fmt.Errorf("el host usa una sincronización desconocida (%d)", s.Netcode)
+	}
+	if s.Pieces != nil {
+		if err := s.Pieces.Validate(); err != nil {
+			return err
+		}
+	}
+	if s.Levels != nil {
+		if err := s.Levels.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
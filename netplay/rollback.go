@@ -0,0 +1,313 @@
+package netplay
+
+import (
+	"errors"
+
+	"github.com/Efocor/FETRIS/engine"
+)
+
+// Ticks que la partida puede ir adelante de lo confirmado; más allá se espera al rival
+const MaxRollback = 15
+
+// .... Versus en red con rollback ....
+// La partida no espera al rival: si su entrada de un tick todavía no llega, se
+// adivina (sigue apretando lo mismo que antes, sin repetir los toques) y se juega.
+// Antes de cada tick se guarda el estado; cuando llega una entrada distinta a la
+// adivinada, se vuelve a ese tick y se juega de nuevo hasta el presente.
+// Las entradas propias se reenvían hasta que el rival avisa que le llegaron, así
+// que también aguanta mensajes perdidos.
+type Rollback struct {
+	Session   *Session
+	Match     *engine.Match
+	Delay     int //Ticks entre lo que se aprieta y el tick en que se juega
+	Tick      int //Ticks jugados, contando los adivinados
+	Confirmed int //Ticks jugados con la entrada de verdad del rival
+	Rollbacks int //Veces que hubo que volver atrás
+	Waiting   int //Updates seguidos esperando al rival
+
+	local     map[int]engine.Input       //Entradas propias, hasta que el rival las tiene y están confirmadas
+	remote    map[int]engine.Input       //Entradas del rival que llegaron
+	predicted map[int]engine.Input       //Lo que se adivinó del rival en cada tick sin confirmar
+	states    map[int]*engine.MatchState //Estado antes de cada tick sin confirmar
+	sent      int                        //Siguiente tick propio sin entrada
+	acked     int                        //Ticks propios que el rival ya tiene
+	received  int                        //Ticks del rival que llegaron, sin huecos
+	last      engine.Input               //Última entrada del rival que llegó, de ahí se adivina
+	replayAt  int                        //Primer tick mal adivinado, -1 si no hay
+	carry     engine.Input               //Lo apretado mientras se esperaba, va con la siguiente
+	checks    checker
+	gone      error //El rival se fue o se cortó: se juega lo que alcanzó a mandar
+	err       error
+}
+
+// .... Arma el rollback sobre la sesión y el versus ya empezado con su semilla ....
+func NewRollback(s *Session, m *engine.Match, delay int) *Rollback {
+	r := &Rollback{
+		Session:   s,
+		Match:     m,
+		Delay:     delay,
+		local:     make(map[int]engine.Input),
+		remote:    make(map[int]engine.Input),
+		predicted: make(map[int]engine.Input),
+		states:    make(map[int]*engine.MatchState),
+		replayAt:  -1,
+		checks:    newChecker(),
+	}
+	//Los primeros ticks no tienen entrada; van en el primer envío
+	for r.sent < delay {
+		r.local[r.sent] = 0
+		r.sent++
+	}
+	return r
+}
+
+func (r *Rollback) Local() int {
+	return r.Session.Local
+}
+
+func (r *Rollback) Stalled() int {
+	return r.Waiting
+}
+
+// El versus terminó cuando el final ya no depende de nada adivinado
+func (r *Rollback) Over() bool {
+	return r.Match.Over && r.Confirmed == r.Tick
+}
+
+// Índice del rival en el versus
+func (r *Rollback) remoteIndex() int {
+	return 1 - r.Session.Local
+}
+
+// .... Un update del juego con lo que se aprieta ahora ....
+// Juega un tick aunque no haya llegado la entrada del rival (salvo que ya se
+// haya adivinado demasiado), y corrige lo adivinado que resultó distinto.
+func (r *Rollback) Update(in engine.Input) ([][]engine.Event, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	if err := r.receive(); err != nil {
+		return nil, r.fail(err)
+	}
+
+	//Lo de este update se juega Delay ticks más adelante
+	in |= r.carry
+	r.carry = 0
+	if r.sent <= r.Tick+r.Delay {
+		r.local[r.sent] = in
+		r.sent++
+	} else {
+		r.carry = in &^ heldInputs
+	}
+	r.send(r.inputMessage(KindInput))
+
+	//Llegó algo distinto a lo adivinado: se vuelve atrás y se juega de nuevo
+	if r.replayAt >= 0 {
+		r.replay()
+	}
+
+	var events [][]engine.Event
+	_, hasLocal := r.local[r.Tick]
+	switch {
+	case r.Match.Over:
+	case hasLocal && r.Tick-r.Confirmed < MaxRollback:
+		events = r.step(r.Tick)
+		r.Tick++
+		r.Waiting = 0
+	default:
+		r.Waiting++
+		if r.Waiting > StallLimit {
+			return events, r.fail(ErrStalled)
+		}
+	}
+
+	if err := r.confirm(); err != nil {
+		return events, r.fail(err)
+	}
+
+	//Sin rival ya no va a llegar lo que falta para confirmar
+	if r.gone != nil && r.received < r.Tick+1 && (r.Match.Over || r.Tick-r.Confirmed >= MaxRollback) {
+		return events, r.fail(r.gone)
+	}
+	return events, nil
+}
+
+// Entradas propias que el rival todavía no tiene, y hasta dónde llegaron las suyas
+func (r *Rollback) inputMessage(kind Kind) Message {
+	m := Message{Kind: kind, Tick: r.acked, Ack: r.received}
+	for t := r.acked; t < r.sent; t++ {
+		m.Inputs = append(m.Inputs, r.local[t])
+	}
+	return m
+}
+
+// Manda al rival. Si no se puede es porque se cortó: eso se nota al leer, y lo
+// que el rival alcanzó a mandar antes todavía se juega
+func (r *Rollback) send(m Message) {
+	if r.gone == nil {
+		r.Session.Send(m)
+	}
+}
+
+// Lee todo lo que llegó
+func (r *Rollback) receive() error {
+	for r.gone == nil {
+		m, ok, err := r.Session.Poll()
+		if err != nil {
+			r.gone = err
+		}
+		if !ok {
+			return nil
+		}
+		switch m.Kind {
+		case KindInput:
+			r.addRemote(m)
+		case KindCheck:
+			if err := r.checks.addTheirs(m); err != nil {
+				return err
+			}
+		case KindBye:
+			//El bye trae las últimas entradas, que pueden no haber llegado antes
+			r.addRemote(m)
+			r.gone = byeError(m)
+		}
+	}
+	return nil
+}
+
+// Entradas del rival desde m.Tick; las que contradicen lo adivinado marcan desde dónde volver a jugar
+func (r *Rollback) addRemote(m Message) {
+	if m.Ack > r.acked {
+		r.acked = m.Ack
+	}
+	//Vienen desde lo último que el rival sabe que llegó, así que no dejan huecos
+	if m.Tick > r.received {
+		return
+	}
+	for i, in := range m.Inputs {
+		t := m.Tick + i
+		if t < r.received {
+			continue
+		}
+		r.remote[t] = in
+		r.last = in
+		r.received = t + 1
+		if guess, ok := r.predicted[t]; ok && guess != in && (r.replayAt < 0 || t < r.replayAt) {
+			r.replayAt = t
+		}
+	}
+}
+
+// Lo que se adivina del rival: sigue manteniendo lo mismo, pero los toques no se repiten
+func (r *Rollback) predict() engine.Input {
+	return r.last & heldInputs
+}
+
+// .... Juega el tick t guardando antes el estado ....
+func (r *Rollback) step(t int) [][]engine.Event {
+	r.states[t] = r.Match.Save()
+
+	theirs, ok := r.remote[t]
+	if ok {
+		delete(r.predicted, t)
+	} else {
+		theirs = r.predict()
+		r.predicted[t] = theirs
+	}
+
+	inputs := make([]engine.Input, 2)
+	inputs[r.Session.Local] = r.local[t]
+	inputs[r.remoteIndex()] = theirs
+	return r.Match.Step(inputs)
+}
+
+// .... Vuelve al primer tick mal adivinado y juega de nuevo hasta el presente ....
+// Los eventos de los ticks que se repiten no se devuelven: ya se mostraron, o el
+// tablero simplemente queda como tenía que quedar. Si ahora el versus termina
+// antes, los ticks adivinados que siguen se olvidan.
+func (r *Rollback) replay() {
+	from := r.replayAt
+	r.replayAt = -1
+	r.Match.Load(r.states[from])
+	end := r.Tick
+	for t := from; t < r.Tick; t++ {
+		r.step(t)
+		if r.Match.Over {
+			r.Tick = t + 1
+		}
+	}
+	for t := r.Tick; t < end; t++ {
+		delete(r.states, t)
+		delete(r.predicted, t)
+	}
+	r.Rollbacks++
+}
+
+// .... Ticks que ya tienen la entrada de verdad de los dos: se comparan huellas y se olvidan ....
+func (r *Rollback) confirm() error {
+	for r.Confirmed < r.Tick && r.Confirmed < r.received {
+		t := r.Confirmed
+
+		//Estado justo después del tick: el guardado antes del siguiente, o el actual
+		hash := r.Match.Hash
+		outgoing := func(player int) int { return r.Match.Players[player].Outgoing }
+		if next, ok := r.states[t+1]; ok {
+			hash = next.Hash
+			outgoing = next.Outgoing
+		}
+
+		if garbage := outgoing(r.Session.Local); mustCheck(t, garbage) {
+			r.send(Message{Kind: KindCheck, Tick: t, Hash: hash(), Garbage: garbage})
+		}
+		rival := outgoing(r.remoteIndex())
+		own := Message{Kind: KindCheck, Tick: t, Hash: hash(), Garbage: rival}
+		if err := r.checks.addOwn(t, own, mustCheck(t, rival)); err != nil {
+			return err
+		}
+
+		delete(r.states, t)
+		delete(r.remote, t)
+		delete(r.predicted, t)
+		r.Confirmed++
+	}
+
+	//Las entradas propias se guardan mientras puedan hacer falta para reenviar
+	for t := range r.local {
+		if t < r.acked && t < r.Confirmed {
+			delete(r.local, t)
+		}
+	}
+	return nil
+}
+
+// Guarda el error y avisa al rival por qué se corta
+func (r *Rollback) fail(err error) error {
+	if r.err == nil {
+		if r.gone != nil && !errors.Is(err, ErrDesync) {
+			err = r.gone
+		}
+		r.err = err
+		r.close(closeReason(err))
+	}
+	return r.err
+}
+
+// Cierra mandando las últimas entradas con el bye, para que el rival pueda terminar su partida
+func (r *Rollback) close(reason string) {
+	bye := r.inputMessage(KindBye)
+	bye.Reason = reason
+	r.Session.CloseWith(bye)
+}
+
+// .... Error que terminó la partida en red, nil si sigue ....
+func (r *Rollback) Err() error {
+	return r.err
+}
+
+// .... Termina la partida en red y cierra la conexión ....
+func (r *Rollback) Close() {
+	if r.err == nil {
+		r.err = ErrClosed
+		r.close("")
+	}
+}
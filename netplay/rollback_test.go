@@ -0,0 +1,73 @@
+package netplay
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+)
+
+// .... Dos lados de un versus con rollback, sobre una red simulada ....
+func rollbackPair(t *testing.T, seeds [2]int64, c Conditions) [2]*Rollback {
+	t.Helper()
+	connA, connB := net.Pipe()
+	peers := []*Peer{NewPeer(connA), NewPeer(connB)}
+	var pair [2]*Rollback
+	for i, peer := range peers {
+		peer.Simulate(c, int64(i+1))
+		s := &Session{Peer: peer, Local: i}
+		pair[i] = NewRollback(s, newVersus(seeds[i]), DefaultInputDelay)
+	}
+	t.Cleanup(func() {
+		pair[0].Close()
+		pair[1].Close()
+	})
+	return pair
+}
+
+// Juega los dos lados hasta que el versus termine en los dos, o hasta el primer error
+func playRollback(pair [2]*Rollback, rnd *rand.Rand) error {
+	deadline := time.Now().Add(20 * time.Second)
+	for !pair[0].Over() || !pair[1].Over() {
+		if time.Now().After(deadline) {
+			return errors.New("el versus no terminó")
+		}
+		for _, r := range pair {
+			if _, err := r.Update(randomInput(rnd)); err != nil {
+				return err
+			}
+		}
+		//Lo del rival llega atrasado por la red simulada
+		time.Sleep(time.Millisecond)
+	}
+	return nil
+}
+
+// .... Con latencia, jitter y pérdidas, los dos lados terminan la misma partida ....
+func TestRollbackSync(t *testing.T) {
+	c := Conditions{Latency: 30 * time.Millisecond, Jitter: 20 * time.Millisecond, Loss: 0.2}
+	pair := rollbackPair(t, [2]int64{31, 31}, c)
+	if err := playRollback(pair, rand.New(rand.NewSource(3))); err != nil {
+		t.Fatal(err)
+	}
+	a, b := pair[0], pair[1]
+	if a.Tick != b.Tick {
+		t.Fatalf("el versus terminó en ticks distintos: %d y %d", a.Tick, b.Tick)
+	}
+	if a.Match.Hash() != b.Match.Hash() || a.Match.Winner != b.Match.Winner {
+		t.Fatalf("los lados terminaron distinto: ganador %d y %d", a.Match.Winner, b.Match.Winner)
+	}
+	if a.Rollbacks+b.Rollbacks == 0 {
+		t.Fatal("nunca se volvió atrás, la prueba no probó nada")
+	}
+}
+
+// .... Si las partidas no son la misma, la huella lo nota aunque no se espere al rival ....
+func TestRollbackDesync(t *testing.T) {
+	pair := rollbackPair(t, [2]int64{32, 33}, Conditions{Latency: 10 * time.Millisecond})
+	err := playRollback(pair, rand.New(rand.NewSource(4)))
+	if !errors.Is(err, ErrDesync) {
+		t.Fatalf("con semillas distintas el error fue %v", err)
+	}
+}
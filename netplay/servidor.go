@@ -0,0 +1,521 @@
+package netplay
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Efocor/FETRIS/engine"
+)
+
+// Puerto del servidor dedicado si no se dice otro
+const DefaultServerPort = DefaultPort + 2
+
+// Jugadores por sala
+const (
+	MinRoomPlayers = 2
+	MaxRoomPlayers = 8
+)
+
+// Largo máximo de los nombres de jugadores y salas
+const maxNameLength = 16
+
+// Mensajes que se le pueden juntar a un cliente lento antes de cortarlo
+const outboxSize = 1024
+
+// .... Una sala, como se ve desde afuera ....
+type RoomInfo struct {
+	ID      int
+	Name    string
+	Players []string //En orden de llegada: el primero es el dueño y es quien la empieza
+	Playing bool
+}
+
+// .... Servidor dedicado: salas de 2 a 8 jugadores ....
+// El servidor es quien juega de verdad: junta lo que aprieta cada cliente, juega
+// el tick y les manda a todos las entradas con que lo jugó. Los clientes juegan
+// la misma partida con esas entradas y solo sirven para mostrarla; el ganador sale
+// de la copia del servidor.
+type Server struct {
+	Setup     Setup             //Reglas de todas las partidas; la semilla la pone cada una
+	Targeting engine.TargetKind //Objetivo con que empieza cada jugador
+	TickRate  time.Duration     //Cada cuánto se juega un tick, 0 = engine.TPS por segundo
+	Clock     <-chan time.Time  //Si no es nil marca los ticks de las salas en vez de TickRate (las pruebas)
+	MaxRooms  int               //0 = sin límite
+	Log       *log.Logger       //nil = no se anota nada
+
+	mu       sync.Mutex
+	rooms    map[int]*room
+	nextRoom int
+	seeds    *rand.Rand
+}
+
+// .... Servidor con las reglas de setup ....
+func NewServer(setup Setup) *Server {
+	setup.Config.Mode = engine.ModeVersus
+	return &Server{
+		Setup:     setup,
+		Targeting: engine.TargetRandom,
+		rooms:     make(map[int]*room),
+		nextRoom:  1,
+		seeds:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Anota en el log, si hay
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.Log != nil {
+		s.Log.Printf(format, args...)
+	}
+}
+
+// .... Atiende a los clientes que llegan a ln, hasta que se cierra ....
+func (s *Server) Serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+// .... Un cliente conectado al servidor ....
+type serverClient struct {
+	server *Server
+	peer   *Peer
+	name   string
+	out    chan Message //Lo que se le manda, lo escribe otra goroutine
+
+	room *room //Sala donde está, nil en la lista (solo lo toca la goroutine del cliente)
+}
+
+// Saluda y atiende los pedidos del cliente hasta que se va
+func (s *Server) handle(conn net.Conn) {
+	p := NewPeer(conn)
+	hello, err := p.Receive(handshakeTimeout)
+	if err == nil {
+		err = checkHello(hello, KindHello)
+	}
+	name := cleanName(hello.Name)
+	if err == nil && name == "" {
+		err = errors.New("falta el nombre del jugador")
+	}
+	if err != nil {
+		p.Close(err.Error())
+		return
+	}
+
+	c := &serverClient{server: s, peer: p, name: name, out: make(chan Message, outboxSize)}
+	go c.writeLoop()
+	s.logf("%s se conectó desde %s", name, p.RemoteAddr())
+	c.send(Message{Kind: KindRooms, Version: Version, Engine: engine.ReplayVersion, Rooms: s.roomList()})
+
+	for {
+		m, err := p.Next()
+		if err != nil || m.Kind == KindBye {
+			break
+		}
+		if err := c.request(m); err != nil {
+			c.send(Message{Kind: KindError, Reason: err.Error()})
+		}
+	}
+
+	if c.room != nil {
+		c.room.leave(c)
+	}
+	p.Close("")
+	s.logf("%s se fue", name)
+}
+
+// Nombre sin espacios de más ni caracteres raros, y no muy largo
+func cleanName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < ' ' {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if runes := []rune(name); len(runes) > maxNameLength {
+		name = string(runes[:maxNameLength])
+	}
+	return name
+}
+
+// .... Un pedido del cliente; el error se le contesta ....
+func (c *serverClient) request(m Message) error {
+	switch m.Kind {
+	case KindRooms:
+		c.send(Message{Kind: KindRooms, Rooms: c.server.roomList()})
+		return nil
+	case KindCreate, KindJoin:
+		if c.room != nil {
+			return errors.New("ya estás en una sala")
+		}
+		var r *room
+		var err error
+		if m.Kind == KindCreate {
+			r, err = c.server.createRoom(m.Name, c.name)
+		} else {
+			r, err = c.server.findRoom(m.RoomID)
+		}
+		if err != nil {
+			return err
+		}
+		return r.join(c)
+	}
+
+	//El resto es dentro de una sala
+	if c.room == nil {
+		return fmt.Errorf("pedido de tipo %d fuera de una sala", m.Kind)
+	}
+	switch m.Kind {
+	case KindStart:
+		return c.room.start(c)
+	case KindInput:
+		c.room.input(c, m.Input)
+	case KindTarget:
+		return c.room.target(c, m.Target)
+	default:
+		return fmt.Errorf("pedido desconocido de tipo %d", m.Kind)
+	}
+	return nil
+}
+
+// Deja el mensaje para que lo escriba writeLoop; si el cliente no alcanza a leer, se corta
+func (c *serverClient) send(m Message) {
+	select {
+	case c.out <- m:
+	default:
+		//Sin bye: escribirle a quien no lee dejaría esperando a toda la sala
+		c.peer.fail(errors.New("el cliente no alcanza a recibir la partida"))
+		c.peer.conn.Close()
+	}
+}
+
+// Escribe lo que se le manda al cliente, hasta que se corta
+func (c *serverClient) writeLoop() {
+	for {
+		select {
+		case m := <-c.out:
+			if c.peer.Send(m) != nil {
+				return
+			}
+		case <-c.peer.done:
+			return
+		}
+	}
+}
+
+// .... Salas del servidor ....
+
+// Lista de salas, en orden de creación
+func (s *Server) roomList() []RoomInfo {
+	s.mu.Lock()
+	rooms := make([]*room, 0, len(s.rooms))
+	for id := 1; id < s.nextRoom; id++ {
+		if r, ok := s.rooms[id]; ok {
+			rooms = append(rooms, r)
+		}
+	}
+	s.mu.Unlock()
+
+	list := make([]RoomInfo, 0, len(rooms))
+	for _, r := range rooms {
+		r.mu.Lock()
+		list = append(list, r.info())
+		r.mu.Unlock()
+	}
+	return list
+}
+
+func (s *Server) createRoom(name, owner string) (*room, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.MaxRooms > 0 && len(s.rooms) >= s.MaxRooms {
+		return nil, errors.New("el servidor no tiene lugar para otra sala")
+	}
+	name = cleanName(name)
+	if name == "" {
+		name = "SALA DE " + owner
+	}
+	r := &room{server: s, id: s.nextRoom, name: name}
+	s.rooms[r.id] = r
+	s.nextRoom++
+	s.logf("%s creó la sala %d (%s)", owner, r.id, name)
+	return r, nil
+}
+
+func (s *Server) findRoom(id int) (*room, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.rooms[id]
+	if !ok {
+		return nil, errors.New("esa sala ya no existe")
+	}
+	return r, nil
+}
+
+// La sala quedó vacía
+func (s *Server) removeRoom(r *room) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.rooms, r.id)
+	s.logf("se cerró la sala %d", r.id)
+}
+
+// Semilla para una partida nueva
+func (s *Server) newSeed() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.seeds.Int63()
+}
+
+// .... Una sala: espera jugadores y juega sus partidas ....
+type room struct {
+	server *Server
+	id     int
+	name   string
+
+	mu      sync.Mutex
+	clients []*serverClient //En orden de llegada, el primero es el dueño
+	closed  bool            //Se fue el último: ya no se puede entrar
+
+	//.... Mientras se juega ....
+	match    *engine.Match
+	players  []*roomPlayer //Uno por jugador de la partida, en su orden
+	tick     int
+	left     []int //Los que se fueron desde el último tick
+	retarget bool  //Alguien cambió de objetivo desde el último tick
+}
+
+// .... Un jugador de la partida de la sala ....
+type roomPlayer struct {
+	name    string
+	client  *serverClient //nil si se fue
+	held    engine.Input  //Acciones de mantener, como las mandó la última vez
+	pressed engine.Input  //Todo lo que apretó desde el último tick, así no se pierde un toque corto
+	target  engine.TargetKind
+}
+
+// Cómo se ve la sala desde afuera (con mu tomado)
+func (r *room) info() RoomInfo {
+	info := RoomInfo{ID: r.id, Name: r.name, Playing: r.match != nil}
+	for _, c := range r.clients {
+		info.Players = append(info.Players, c.name)
+	}
+	return info
+}
+
+// Les cuenta a todos cómo quedó la sala (con mu tomado)
+func (r *room) broadcastInfo() {
+	info := r.info()
+	for i, c := range r.clients {
+		c.send(Message{Kind: KindRoom, Room: &info, Player: i})
+	}
+}
+
+func (r *room) join(c *serverClient) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case r.closed:
+		return errors.New("esa sala ya no existe")
+	case r.match != nil:
+		return errors.New("esa sala está jugando, espera a que termine")
+	case len(r.clients) >= MaxRoomPlayers:
+		return fmt.Errorf("esa sala ya tiene %d jugadores", MaxRoomPlayers)
+	}
+	r.clients = append(r.clients, c)
+	c.room = r
+	r.broadcastInfo()
+	return nil
+}
+
+// El cliente se fue: si estaba jugando, pierde en el tick que sigue
+func (r *room) leave(c *serverClient) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, other := range r.clients {
+		if other == c {
+			r.clients = append(r.clients[:i], r.clients[i+1:]...)
+			break
+		}
+	}
+	for i, p := range r.players {
+		if p.client == c {
+			p.client = nil
+			r.left = append(r.left, i)
+		}
+	}
+	c.room = nil
+
+	if len(r.clients) == 0 && r.match == nil {
+		r.closed = true
+		r.server.removeRoom(r)
+		return
+	}
+	r.broadcastInfo()
+}
+
+// .... El dueño empieza la partida con los que están ....
+func (r *room) start(c *serverClient) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case r.clients[0] != c:
+		return errors.New("solo el dueño de la sala puede empezar")
+	case r.match != nil:
+		return errors.New("la partida ya empezó")
+	case len(r.clients) < MinRoomPlayers:
+		return fmt.Errorf("hacen falta al menos %d jugadores", MinRoomPlayers)
+	}
+
+	setup := r.server.Setup
+	setup.Seed = r.server.newSeed()
+	engines := make([]*engine.Engine, len(r.clients))
+	r.players = make([]*roomPlayer, len(r.clients))
+	targets := make([]engine.TargetKind, len(r.clients))
+	for i, client := range r.clients {
+		engines[i] = engine.New()
+		setup.Apply(engines[i])
+		r.players[i] = &roomPlayer{name: client.name, client: client, target: r.server.Targeting}
+		targets[i] = r.server.Targeting
+	}
+	r.match = engine.NewMatch(engines)
+	for i, t := range targets {
+		r.match.SetTarget(i, t)
+	}
+	r.match.Start(setup.Seed)
+	r.tick = 0
+	r.left = nil
+	r.retarget = false
+
+	info := r.info()
+	for i, client := range r.clients {
+		client.send(Message{Kind: KindStart, Setup: &setup, Room: &info, Player: i, Targets: targets})
+	}
+	r.server.logf("empieza la partida de la sala %d con %d jugadores", r.id, len(r.clients))
+	go r.run()
+	return nil
+}
+
+// Lo que apretó el cliente, para el próximo tick
+func (r *room) input(c *serverClient, in engine.Input) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p := r.player(c); p != nil {
+		p.held = in & heldInputs
+		p.pressed |= in
+	}
+}
+
+// El cliente cambia de objetivo desde el próximo tick
+func (r *room) target(c *serverClient, kind engine.TargetKind) error {
+	if kind < 0 || kind >= engine.NumTargets {
+		return fmt.Errorf("objetivo desconocido %d", kind)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p := r.player(c); p != nil {
+		p.target = kind
+		r.retarget = true
+	}
+	return nil
+}
+
+// Jugador de la partida que es el cliente, nil si no está jugando (con mu tomado)
+func (r *room) player(c *serverClient) *roomPlayer {
+	for _, p := range r.players {
+		if p.client == c {
+			return p
+		}
+	}
+	return nil
+}
+
+// .... Juega la partida de la sala a su ritmo, hasta que termina ....
+func (r *room) run() {
+	ticks := r.server.Clock
+	if ticks == nil {
+		rate := r.server.TickRate
+		if rate <= 0 {
+			rate = time.Second / engine.TPS
+		}
+		ticker := time.NewTicker(rate)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+	for range ticks {
+		if r.step() {
+			return
+		}
+	}
+}
+
+// Un tick de la partida; true si con él terminó
+func (r *room) step() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	//Los que se fueron pierden antes de jugar el tick, igual que en los clientes
+	frame := Message{Kind: KindFrame, Tick: r.tick, Left: r.left}
+	for _, i := range r.left {
+		r.match.Forfeit(i)
+	}
+	r.left = nil
+	if r.retarget {
+		for i, p := range r.players {
+			r.match.SetTarget(i, p.target)
+		}
+		frame.Targets = append([]engine.TargetKind(nil), r.match.Targeting...)
+		r.retarget = false
+	}
+
+	inputs := make([]engine.Input, len(r.players))
+	for i, p := range r.players {
+		inputs[i] = p.held | p.pressed
+		p.pressed = 0
+	}
+	r.match.Step(inputs)
+	frame.Inputs = inputs
+	if r.tick%HashInterval == 0 {
+		frame.Hash = r.match.Hash()
+	}
+	r.tick++
+	r.broadcast(frame)
+
+	if !r.match.Over {
+		return false
+	}
+	r.broadcast(Message{Kind: KindEnd, Tick: r.tick, Winner: r.match.Winner, Hash: r.match.Hash()})
+	winner := "nadie, fue empate"
+	if r.match.Winner >= 0 {
+		winner = r.players[r.match.Winner].name
+	}
+	r.server.logf("terminó la partida de la sala %d en %d ticks, ganó %s", r.id, r.tick, winner)
+
+	r.match = nil
+	r.players = nil
+	if len(r.clients) == 0 {
+		r.closed = true
+		r.server.removeRoom(r)
+	} else {
+		r.broadcastInfo()
+	}
+	return true
+}
+
+// A todos los que siguen en la partida (con mu tomado)
+func (r *room) broadcast(m Message) {
+	for _, p := range r.players {
+		if p.client != nil {
+			p.client.send(m)
+		}
+	}
+}
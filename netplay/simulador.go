@@ -0,0 +1,139 @@
+package netplay
+
+import (
+	"container/heap"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// .... Condiciones de red simuladas ....
+// Para probar y ajustar la red sin salir del computador: cada mensaje que se manda
+// se atrasa Latency más o menos Jitter (así también llegan desordenados), y las
+// entradas y huellas se pierden con probabilidad Loss. Solo el rollback aguanta
+// pérdidas, porque reenvía sus entradas hasta que el rival las confirma.
+type Conditions struct {
+	Latency time.Duration //Atraso de ida de cada mensaje
+	Jitter  time.Duration //Variación al azar del atraso, para arriba o para abajo
+	Loss    float64       //Probabilidad de perder un mensaje de entradas o de huella
+}
+
+// ¿Hay algo que simular?
+func (c Conditions) Active() bool {
+	return c.Latency > 0 || c.Jitter > 0 || c.Loss > 0
+}
+
+// .... Desde ahora los mensajes que se mandan pasan por las condiciones simuladas ....
+func (p *Peer) Simulate(c Conditions, seed int64) {
+	if !c.Active() {
+		return
+	}
+	l := &link{
+		peer: p,
+		cond: c,
+		rng:  rand.New(rand.NewSource(seed)),
+		wake: make(chan struct{}, 1),
+	}
+	p.link = l
+	go l.run()
+}
+
+// Mensaje esperando su hora de salir
+type delayed struct {
+	at  time.Time
+	seq int //Para que dos con la misma hora salgan en orden
+	msg Message
+}
+
+// Cola de mensajes por hora de salida
+type delayQueue []delayed
+
+func (q delayQueue) Len() int { return len(q) }
+func (q delayQueue) Less(i, j int) bool {
+	if q[i].at.Equal(q[j].at) {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].at.Before(q[j].at)
+}
+func (q delayQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *delayQueue) Push(x interface{}) { *q = append(*q, x.(delayed)) }
+func (q *delayQueue) Pop() interface{} {
+	old := *q
+	d := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return d
+}
+
+// .... La red simulada de un Peer ....
+type link struct {
+	peer *Peer
+	cond Conditions
+	rng  *rand.Rand
+	wake chan struct{} //Avisa que llegó un mensaje a la cola
+
+	mu    sync.Mutex
+	queue delayQueue
+	seq   int
+}
+
+// Pone el mensaje en la cola con su atraso, o lo pierde
+func (l *link) send(m Message) {
+	l.mu.Lock()
+	lossy := m.Kind == KindInput || m.Kind == KindCheck
+	if lossy && l.rng.Float64() < l.cond.Loss {
+		l.mu.Unlock()
+		return
+	}
+	delay := l.cond.Latency
+	if l.cond.Jitter > 0 {
+		delay += time.Duration((l.rng.Float64()*2 - 1) * float64(l.cond.Jitter))
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	l.seq++
+	heap.Push(&l.queue, delayed{at: time.Now().Add(delay), seq: l.seq, msg: m})
+	l.mu.Unlock()
+
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Manda de una vez lo que queda en la cola, en orden (al cerrar)
+func (l *link) flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for len(l.queue) > 0 {
+		d := heap.Pop(&l.queue).(delayed)
+		l.peer.write(d.msg)
+	}
+}
+
+// Manda cada mensaje a su hora, hasta que se cierra la conexión
+func (l *link) run() {
+	for {
+		l.mu.Lock()
+		wait := time.Hour
+		for len(l.queue) > 0 {
+			next := l.queue[0]
+			if d := time.Until(next.at); d > 0 {
+				wait = d
+				break
+			}
+			heap.Pop(&l.queue)
+			l.mu.Unlock()
+			l.peer.write(next.msg)
+			l.mu.Lock()
+		}
+		l.mu.Unlock()
+
+		select {
+		case <-time.After(wait):
+		case <-l.wake:
+		case <-l.peer.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io/ioutil"
+
+	"github.com/Efocor/FETRIS/engine"
+	"github.com/Efocor/FETRIS/netplay"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+)
+
+// .... Opciones del jugador, se guardan en opciones.json ....
+type Settings struct {
+	Ghost      bool                  //Mostrar la sombra donde caerá la pieza
+	LockDelay  int                   //Ticks de lock delay, 0 = clásico
+	LockReset  engine.LockReset      //Variante de reinicio del lock delay
+	Randomizer engine.RandomizerKind //Cómo salen las piezas
+	Seed       string                //Semilla fija de las partidas, vacía = al azar
+	Scoring    engine.ScoringKind    //Tabla de puntaje
+	LineClear  int                   //Ticks de la limpieza de líneas, 0 = al instante
+	Gravity    engine.GravityKind    //Cómo baja el tablero después de limpiar
+	Mode       engine.ModeKind       //Último modo elegido
+	UltraTime  int                   //Segundos de una partida de ultra
+	Holes      engine.HoleKind       //Dónde va el hueco de la basura
+	Width      int                   //Columnas del tablero
+	Height     int                   //Filas del tablero
+	CellSize   int                   //Lado de las celdas en pixeles, 0 = las más grandes que quepan
+	Curve      engine.CurveKind      //Curva de velocidad de caída
+	SoftDrop   int                   //Multiplicador de la caída rápida, 0 = instantánea
+	Netcode    netplay.NetcodeKind   //Cómo se sincroniza el versus en red (lo elige el host)
+	NetDelay   int                   //Ticks de retraso de la entrada propia en red
+}
+
+// .... Valores por defecto, si no hay archivo o le faltan campos ....
+func defaultSettings() Settings {
+	config := engine.DefaultConfig()
+	return Settings{
+		Ghost:      true,
+		LockDelay:  config.LockDelay,
+		LockReset:  config.LockReset,
+		Randomizer: config.Randomizer,
+		Scoring:    config.Scoring,
+		LineClear:  config.LineClearDelay,
+		Gravity:    config.Gravity,
+		Mode:       config.Mode,
+		UltraTime:  config.UltraTime,
+		Holes:      config.GarbageHoles,
+		Width:      engine.GridWidth,
+		Height:     engine.GridHeight,
+		Curve:      config.Curve,
+		SoftDrop:   config.SoftDrop,
+		Netcode:    netplay.NetcodeRollback,
+		NetDelay:   netplay.DefaultInputDelay,
+	}
+}
+
+// .... Pasa las opciones que son reglas a la configuración del motor ....
+func (s Settings) applyTo(config *engine.Config) {
+	config.LockDelay = s.LockDelay
+	config.LockReset = s.LockReset
+	config.Randomizer = s.Randomizer
+	config.Scoring = s.Scoring
+	config.LineClearDelay = s.LineClear
+	config.Gravity = s.Gravity
+	config.Mode = s.Mode
+	config.UltraTime = s.UltraTime
+	config.GarbageHoles = s.Holes
+	config.Width = s.Width
+	config.Height = s.Height
+	config.Curve = s.Curve
+	config.SoftDrop = s.SoftDrop
+}
+
+// Valores que se pueden elegir en el menú
+var (
+	lockDelayOptions = []int{0, 15, 30, 60}
+	lineClearOptions = []int{0, 10, 20, 40}
+	ultraTimeOptions = []int{120, 180}
+	softDropOptions  = []int{5, 10, 20, 40, 0}
+	netDelayOptions  = []int{0, 1, 2, 3, 4, 6}
+	lockResetNames   = []string{"MOVER (15)", "POR FILA", "INFINITO"}
+	randomizerNames  = []string{"AZAR PURO", "BOLSA", "HISTORIAL"}
+	scoringNames     = []string{"CLASICO", "GUIA"}
+	gravityNames     = []string{"NORMAL", "CASCADA", "PEGAJOSA"}
+	holeNames        = []string{"LIMPIA", "DESORDENADA", "AL AZAR"}
+	curveNames       = []string{"CLASICA", "GUIA", "20G"}
+	netcodeNames     = []string{"ROLLBACK", "LOCKSTEP"}
+)
+
+func (g *Game) loadSettings() {
+	g.settings = defaultSettings()
+	data, err := ioutil.ReadFile("opciones.json")
+	if err == nil {
+		json.Unmarshal(data, &g.settings)
+	}
+
+	//Un archivo editado a mano no debe romper el menú
+	if g.settings.LockReset < 0 || int(g.settings.LockReset) >= len(lockResetNames) {
+		g.settings.LockReset = engine.LockResetMove
+	}
+	if g.settings.Randomizer < 0 || int(g.settings.Randomizer) >= len(randomizerNames) {
+		g.settings.Randomizer = engine.RandomizerPure
+	}
+	if g.settings.Scoring < 0 || int(g.settings.Scoring) >= len(scoringNames) {
+		g.settings.Scoring = engine.ScoringClassic
+	}
+	if g.settings.Gravity < 0 || int(g.settings.Gravity) >= len(gravityNames) {
+		g.settings.Gravity = engine.GravityNaive
+	}
+	if g.settings.Mode < 0 || g.settings.Mode >= engine.NumModes {
+		g.settings.Mode = engine.ModeFetris
+	}
+	if g.settings.Holes < 0 || int(g.settings.Holes) >= len(holeNames) {
+		g.settings.Holes = engine.HoleClean
+	}
+	if g.settings.UltraTime <= 0 {
+		g.settings.UltraTime = engine.DefaultConfig().UltraTime
+	}
+	g.settings.Width, g.settings.Height = engine.Config{Width: g.settings.Width, Height: g.settings.Height}.BoardSize()
+	if g.settings.CellSize < 0 {
+		g.settings.CellSize = 0
+	}
+	if g.settings.Curve < 0 || int(g.settings.Curve) >= len(curveNames) {
+		g.settings.Curve = engine.CurveClassic
+	}
+	if g.settings.SoftDrop < 0 {
+		g.settings.SoftDrop = engine.DefaultConfig().SoftDrop
+	}
+	if g.settings.Netcode < 0 || g.settings.Netcode >= netplay.NumNetcodes {
+		g.settings.Netcode = netplay.NetcodeRollback
+	}
+	if g.settings.NetDelay < 0 {
+		g.settings.NetDelay = netplay.DefaultInputDelay
+	}
+}
+
+func (g *Game) saveSettings() {
+	data, _ := json.Marshal(g.settings)
+	ioutil.WriteFile("opciones.json", data, 0644)
+}
+
+// .... Una línea del menú de opciones ....
+type settingItem struct {
+	name   string
+	value  func() string
+	change func(dir int)                      //dir es -1 o 1 según la flecha
+	typed  func(chars []rune, backspace bool) //Opcional: la opción se escribe con el teclado
+}
+
+func (g *Game) settingItems() []settingItem {
+	return []settingItem{
+		{
+			name:   "PIEZA FANTASMA",
+			value:  func() string { return onOff(g.settings.Ghost) },
+			change: func(int) { g.settings.Ghost = !g.settings.Ghost },
+		},
+		{
+			name: "LOCK DELAY",
+			value: func() string {
+				if g.settings.LockDelay == 0 {
+					return "CLASICO"
+				}
+				return fmt.Sprintf("%d ms", g.settings.LockDelay*1000/60)
+			},
+			change: func(dir int) { g.settings.LockDelay = cycleInt(lockDelayOptions, g.settings.LockDelay, dir) },
+		},
+		{
+			name:  "REINICIO LOCK",
+			value: func() string { return lockResetNames[g.settings.LockReset] },
+			change: func(dir int) {
+				g.settings.LockReset = engine.LockReset((int(g.settings.LockReset) + dir + len(lockResetNames)) % len(lockResetNames))
+			},
+		},
+		{
+			name: "LIMPIEZA",
+			value: func() string {
+				if g.settings.LineClear == 0 {
+					return "INSTANTE"
+				}
+				return fmt.Sprintf("%d ms", g.settings.LineClear*1000/60)
+			},
+			change: func(dir int) { g.settings.LineClear = cycleInt(lineClearOptions, g.settings.LineClear, dir) },
+		},
+		{
+			name: "SEMILLA",
+			value: func() string {
+				if g.settings.Seed == "" {
+					return "AL AZAR"
+				}
+				return g.settings.Seed
+			},
+			//Las flechas la dejan al azar, los números la escriben
+			change: func(int) { g.settings.Seed = "" },
+			typed: func(chars []rune, backspace bool) {
+				for _, c := range chars {
+					if c >= '0' && c <= '9' && len(g.settings.Seed) < 18 {
+						g.settings.Seed += string(c)
+					}
+				}
+				if backspace && len(g.settings.Seed) > 0 {
+					g.settings.Seed = g.settings.Seed[:len(g.settings.Seed)-1]
+				}
+			},
+		},
+		{
+			name:  "VELOCIDAD",
+			value: func() string { return curveNames[g.settings.Curve] },
+			change: func(dir int) {
+				g.settings.Curve = engine.CurveKind((int(g.settings.Curve) + dir + len(curveNames)) % len(curveNames))
+			},
+		},
+		{
+			name: "CAIDA RAPIDA",
+			value: func() string {
+				if g.settings.SoftDrop == 0 {
+					return "INSTANTE"
+				}
+				return fmt.Sprintf("x%d", g.settings.SoftDrop)
+			},
+			change: func(dir int) { g.settings.SoftDrop = cycleInt(softDropOptions, g.settings.SoftDrop, dir) },
+		},
+		{
+			name:  "PIEZAS",
+			value: func() string { return randomizerNames[g.settings.Randomizer] },
+			change: func(dir int) {
+				g.settings.Randomizer = engine.RandomizerKind((int(g.settings.Randomizer) + dir + len(randomizerNames)) % len(randomizerNames))
+			},
+		},
+		{
+			name:  "PUNTAJE",
+			value: func() string { return scoringNames[g.settings.Scoring] },
+			change: func(dir int) {
+				g.settings.Scoring = engine.ScoringKind((int(g.settings.Scoring) + dir + len(scoringNames)) % len(scoringNames))
+			},
+		},
+		{
+			name:  "GRAVEDAD",
+			value: func() string { return gravityNames[g.settings.Gravity] },
+			change: func(dir int) {
+				g.settings.Gravity = engine.GravityKind((int(g.settings.Gravity) + dir + len(gravityNames)) % len(gravityNames))
+			},
+		},
+		{
+			name:   "TIEMPO ULTRA",
+			value:  func() string { return fmt.Sprintf("%d MIN", g.settings.UltraTime/60) },
+			change: func(dir int) { g.settings.UltraTime = cycleInt(ultraTimeOptions, g.settings.UltraTime, dir) },
+		},
+		{
+			name:  "BASURA",
+			value: func() string { return holeNames[g.settings.Holes] },
+			change: func(dir int) {
+				g.settings.Holes = engine.HoleKind((int(g.settings.Holes) + dir + len(holeNames)) % len(holeNames))
+			},
+		},
+		{
+			name:   "ANCHO TABLERO",
+			value:  func() string { return fmt.Sprintf("%d", g.settings.Width) },
+			change: func(dir int) { g.settings.Width = cycleInt(boardWidthOptions, g.settings.Width, dir) },
+		},
+		{
+			name:   "ALTO TABLERO",
+			value:  func() string { return fmt.Sprintf("%d", g.settings.Height) },
+			change: func(dir int) { g.settings.Height = cycleInt(boardHeightOptions, g.settings.Height, dir) },
+		},
+		{
+			name: "CELDA",
+			value: func() string {
+				if g.settings.CellSize == 0 {
+					return "AUTO"
+				}
+				return fmt.Sprintf("%d px", g.settings.CellSize)
+			},
+			change: func(dir int) { g.settings.CellSize = cycleInt(cellSizeOptions, g.settings.CellSize, dir) },
+		},
+		{
+			name:  "RED",
+			value: func() string { return netcodeNames[g.settings.Netcode] },
+			change: func(dir int) {
+				g.settings.Netcode = netplay.NetcodeKind((int(g.settings.Netcode) + dir + len(netcodeNames)) % len(netcodeNames))
+			},
+		},
+		{
+			name:   "RETRASO RED",
+			value:  func() string { return fmt.Sprintf("%d TICKS", g.settings.NetDelay) },
+			change: func(dir int) { g.settings.NetDelay = cycleInt(netDelayOptions, g.settings.NetDelay, dir) },
+		},
+	}
+}
+
+// .... Siguiente (o anterior) valor de una lista, dando la vuelta ....
+func cycleInt(options []int, current, dir int) int {
+	for i, v := range options {
+		if v == current {
+			return options[(i+dir+len(options))%len(options)]
+		}
+	}
+	return options[0]
+}
+
+func onOff(b bool) string {
+	if b {
+		return "SI"
+	}
+	return "NO"
+}
+
+// Alto de cada línea del menú de opciones, y cuántas caben; con más, la lista se corre con la selección
+const (
+	settingsRowHeight   = 32
+	settingsVisibleRows = 11
+)
+
+// Primera opción que se ve, para que la elegida quede siempre en pantalla
+func settingsFirstRow(selected, total int) int {
+	first := selected - settingsVisibleRows/2
+	if first > total-settingsVisibleRows {
+		first = total - settingsVisibleRows
+	}
+	if first < 0 {
+		first = 0
+	}
+	return first
+}
+
+// .... Pantalla de opciones ....
+func (g *Game) drawSettings(screen *ebiten.Image) {
+	screen.Fill(color.RGBA{29, 29, 41, 255})
+
+	text.Draw(screen, "OPCIONES", g.retroFont, 200, 100, color.White)
+
+	items := g.settingItems()
+	first := settingsFirstRow(g.settingsOption, len(items))
+	for i := first; i < len(items) && i < first+settingsVisibleRows; i++ {
+		y := 160 + (i-first)*settingsRowHeight
+		text.Draw(screen, items[i].name, g.retroFont, 200, y, color.White)
+		text.Draw(screen, "< "+items[i].value()+" >", g.retroFont, 500, y, color.RGBA{255, 220, 100, 255})
+	}
+
+	//Flechas si hay opciones fuera de la pantalla
+	if first > 0 {
+		text.Draw(screen, "↑", g.retroFont, 200, 160-settingsRowHeight, color.RGBA{150, 150, 150, 255})
+	}
+	if first+settingsVisibleRows < len(items) {
+		text.Draw(screen, "↓", g.retroFont, 200, 160+settingsVisibleRows*settingsRowHeight, color.RGBA{150, 150, 150, 255})
+	}
+
+	//Flecha de selección
+	text.Draw(screen, ">", g.retroFont, 150, 160+(g.settingsOption-first)*settingsRowHeight, color.White)
+
+	text.Draw(screen, "Cambia con ← →, escribe la semilla, ESC vuelve", g.retroFont, 100, 540, (color.RGBA{150, 150, 150, 255}))
+
+	g.drawParticles(screen)
+}
+
+// .... Update de la pantalla de opciones ....
+func (g *Game) updateSettings() error {
+	items := g.settingItems()
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyDown) {
+		g.settingsOption = (g.settingsOption + 1) % len(items)
+		g.playSound("select")
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyUp) {
+		g.settingsOption = (g.settingsOption + len(items) - 1) % len(items)
+		g.playSound("select")
+	}
+
+	dir := 0
+	if inpututil.IsKeyJustPressed(ebiten.KeyLeft) {
+		dir = -1
+	} else if inpututil.IsKeyJustPressed(ebiten.KeyRight) || inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
+		dir = 1
+	}
+	if dir != 0 {
+		items[g.settingsOption].change(dir)
+		g.saveSettings()
+		g.playSound("select")
+	}
+
+	//Opciones que se escriben (la semilla)
+	if typed := items[g.settingsOption].typed; typed != nil {
+		chars := ebiten.InputChars()
+		backspace := inpututil.IsKeyJustPressed(ebiten.KeyBackspace)
+		if len(chars) > 0 || backspace {
+			typed(chars, backspace)
+			g.saveSettings()
+		}
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		g.Estado = EstadoPlayMenu
+		g.playSound("select")
+	}
+	return nil
+}
+
+// .... Actualiza y dibuja las partículas del fondo de los menús ....
+func (g *Game) drawParticles(screen *ebiten.Image) {
+	g.updateParticles()
+
+	//Crea imagen temporal para las partículas
+	particleImg := ebiten.NewImage(3, 3)
+	particleImg.Fill(color.RGBA{255, 255, 255, 255})
+
+	//Dibuja cada partícula
+	for _, p := range g.particles {
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Translate(-1.5, -1.5) //Centra la partícula
+		op.GeoM.Scale(p.size, p.size)
+		op.GeoM.Translate(p.x, p.y)
+
+		//Configura su color y transparencia
+		op.ColorM.Scale(1, 1, 1, p.alpha*0.3) //Ajusta el 0.3 para cambiar la opacidad general
+		screen.DrawImage(particleImg, op)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+
+	"github.com/Efocor/FETRIS/engine"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text"
+)
+
+// .... Cartelito de un premio de puntaje (T-SPIN DOBLE +800, COMBO x3, ...) ....
+type popup struct {
+	text   string
+	points int
+	ticks  int //Ticks que le quedan en pantalla
+}
+
+const (
+	popupTicks = engine.TPS * 3 / 2 //Un segundo y medio
+	maxPopups  = 4
+)
+
+func (g *Game) addPopup(a engine.Award) {
+	g.popups = append(g.popups, popup{text: a.Name(), points: a.Points, ticks: popupTicks})
+
+	//Si se juntan muchos, se van los más viejos
+	if len(g.popups) > maxPopups {
+		g.popups = g.popups[len(g.popups)-maxPopups:]
+	}
+}
+
+// .... Avanzan con los ticks del juego, así en pausa se quedan quietos ....
+func (g *Game) tickPopups() {
+	alive := g.popups[:0]
+	for _, p := range g.popups {
+		p.ticks--
+		if p.ticks > 0 {
+			alive = append(alive, p)
+		}
+	}
+	g.popups = alive
+}
+
+// .... Se dibujan a la derecha, bajo la pieza guardada, y se apagan al final ....
+func (g *Game) drawPopups(screen *ebiten.Image) {
+	x := PantallaWidth - 190
+	for i, p := range g.popups {
+		y := 400 + i*50 - (popupTicks-p.ticks)/6 //Suben un poco mientras duran
+
+		alpha := 255
+		if p.ticks < engine.TPS/2 {
+			alpha = p.ticks * 255 / (engine.TPS / 2)
+		}
+
+		text.Draw(screen, p.text, g.retroFont, x, y, color.NRGBA{255, 220, 100, uint8(alpha)})
+		if p.points > 0 {
+			text.Draw(screen, fmt.Sprintf("+%d", p.points), g.retroFont, x, y+22, color.NRGBA{225, 225, 225, uint8(alpha)})
+		}
+	}
+}
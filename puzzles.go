@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io/ioutil"
+	"log"
+
+	"github.com/Efocor/FETRIS/engine"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+)
+
+// Carpeta con los puzzles, uno por archivo
+const puzzleDir = "puzzles"
+
+// .... Carga los puzzles que se pueden jugar con el set de piezas activo ....
+func (g *Game) loadPuzzles(dir string) {
+	puzzles, err := engine.LoadPuzzles(dir)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	g.puzzles = g.puzzles[:0]
+	for _, p := range puzzles {
+		//Un puzzle que nombra piezas de otro set no se puede jugar con este
+		if err := p.Validate(g.engine.Pieces); err != nil {
+			log.Println(err)
+			continue
+		}
+		g.puzzles = append(g.puzzles, p)
+	}
+}
+
+// .... Puzzles resueltos por cada jugador, se guardan en resueltos.json ....
+func (g *Game) loadSolved() {
+	g.solved = make(map[string][]string)
+	data, err := ioutil.ReadFile("resueltos.json")
+	if err == nil {
+		json.Unmarshal(data, &g.solved)
+	}
+}
+
+func (g *Game) markSolved(p *engine.Puzzle) {
+	if p == nil || g.isSolved(p) {
+		return
+	}
+	g.solved[g.playerName] = append(g.solved[g.playerName], p.Name)
+
+	data, _ := json.Marshal(g.solved)
+	ioutil.WriteFile("resueltos.json", data, 0644)
+}
+
+func (g *Game) isSolved(p *engine.Puzzle) bool {
+	for _, name := range g.solved[g.playerName] {
+		if name == p.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// .... Texto de la meta de un puzzle ....
+func puzzleGoalText(goal engine.PuzzleGoal) string {
+	switch goal.Kind {
+	case engine.PuzzleLines:
+		return fmt.Sprintf("Haz %d líneas", goal.Target)
+	case engine.PuzzleTSpin:
+		return fmt.Sprintf("T-spin de %d líneas", goal.Target)
+	default:
+		return "Deja el tablero vacío"
+	}
+}
+
+// .... Pantalla para elegir el puzzle ....
+func (g *Game) drawPuzzleSelect(screen *ebiten.Image) {
+	screen.Fill(color.RGBA{29, 29, 41, 255})
+
+	text.Draw(screen, "PUZZLES - PIENSA Y SOBREVIVIRÁS", g.retroFont, 150, 100, color.White)
+
+	if len(g.puzzles) == 0 {
+		text.Draw(screen, "No hay puzzles en la carpeta "+puzzleDir, g.retroFont, 150, 200, color.RGBA{200, 200, 200, 255})
+	}
+
+	for i, p := range g.puzzles {
+		y := 170 + i*60
+		nameColor := color.RGBA{200, 200, 200, 255}
+		if i == g.puzzleOption {
+			nameColor = color.RGBA{255, 220, 100, 255}
+			text.Draw(screen, ">", g.retroFont, 110, y, color.White)
+		}
+		text.Draw(screen, fmt.Sprintf("%d. %s", i+1, p.Name), g.retroFont, 150, y, nameColor)
+		if g.isSolved(p) {
+			text.Draw(screen, "RESUELTO", g.retroFont, 560, y, color.RGBA{120, 255, 120, 255})
+		}
+
+		detail := fmt.Sprintf("%s con %d piezas", puzzleGoalText(p.Goal), len(p.Queue))
+		if p.Hint != "" {
+			detail = p.Hint
+		}
+		text.Draw(screen, detail, g.storyFont, 150, y+24, color.RGBA{150, 150, 150, 255})
+	}
+
+	text.Draw(screen, "Elige con ↑ ↓, ENTER para jugar, ESC vuelve", g.retroFont, 100, 560, color.RGBA{150, 150, 150, 255})
+
+	g.drawParticles(screen)
+}
+
+// .... Update de la pantalla de puzzles ....
+func (g *Game) updatePuzzleSelect() error {
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) || inpututil.IsKeyJustPressed(ebiten.KeyLeft) {
+		g.Estado = EstadoModos
+		g.playSound("select")
+		return nil
+	}
+	if len(g.puzzles) == 0 {
+		return nil
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyDown) {
+		g.puzzleOption = (g.puzzleOption + 1) % len(g.puzzles)
+		g.playSound("select")
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyUp) {
+		g.puzzleOption = (g.puzzleOption + len(g.puzzles) - 1) % len(g.puzzles)
+		g.playSound("select")
+	}
+	if g.puzzleOption >= len(g.puzzles) {
+		g.puzzleOption = 0
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) || inpututil.IsKeyJustPressed(ebiten.KeyRight) {
+		g.Estado = EstadoGame
+		g.startGame()
+		g.playSound("select")
+		g.playBGM()
+	}
+	return nil
+}
+
+// .... Puzzle elegido, nil si no hay ninguno ....
+func (g *Game) selectedPuzzle() *engine.Puzzle {
+	if g.puzzleOption < len(g.puzzles) {
+		return g.puzzles[g.puzzleOption]
+	}
+	return nil
+}
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"log"
+	"net"
+	"time"
+
+	"github.com/Efocor/FETRIS/engine"
+	"github.com/Efocor/FETRIS/netplay"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+)
+
+// .... Versus en red: hostear, unirse a una partida de la red local o a una
+// dirección, o entrar a un servidor de salas, y la espera hasta que conecta ....
+
+// Opciones de la pantalla de red
+const (
+	netOptionHost = iota
+	netOptionJoin
+	netOptionServer
+	numNetOptions
+)
+
+// Largo máximo de la dirección que se escribe
+const maxAddressLength = 40
+
+// Partidas de la red local que caben en la pantalla
+const maxLANRows = 4
+
+// Dirección donde se hostea desde el menú
+var defaultHostAddr = fmt.Sprintf(":%d", netplay.DefaultPort)
+
+// .... Estado de la pantalla de red ....
+type netLobby struct {
+	option   int
+	address  string //Dónde unirse, se escribe en la pantalla
+	server   string //Dónde está el servidor de salas, también se escribe
+	status   string //Último error, para mostrarlo
+	waitText string //Qué se está esperando
+	waiting  chan netResult
+	ticks    int          //Ticks esperando, para la animación
+	listener net.Listener //Mientras se hostea
+
+	browser   *netplay.Browser   //Busca partidas mientras se está en la pantalla de red
+	games     []netplay.LANGame  //Las que encontró, van después de las opciones
+	announcer *netplay.Announcer //Anuncia la partida propia mientras se espera rival
+
+	roomOption int //Opción elegida en la lista de salas del servidor
+
+	conditions netplay.Conditions //Red simulada para probar (-latencia, -jitter, -perdida)
+}
+
+// Cómo terminó el intento de conectarse
+type netResult struct {
+	session *netplay.Session
+	server  *netplay.ServerConn //Si se conectó a un servidor de salas
+	err     error
+}
+
+// .... Entra a la pantalla de red y empieza a buscar partidas ....
+func (g *Game) openNetMenu() {
+	if g.lobby.address == "" {
+		g.lobby.address = "127.0.0.1"
+	}
+	if g.lobby.server == "" {
+		g.lobby.server = "127.0.0.1"
+	}
+	if g.lobby.browser == nil {
+		b, err := netplay.Browse()
+		if err != nil {
+			g.lobby.status = err.Error()
+		}
+		g.lobby.browser = b
+	}
+	g.Estado = EstadoRed
+}
+
+// Deja de buscar partidas
+func (g *Game) stopBrowsing() {
+	if g.lobby.browser != nil {
+		g.lobby.browser.Close()
+		g.lobby.browser = nil
+	}
+	g.lobby.games = nil
+}
+
+// .... Update de la pantalla de red: elegir, escribir la dirección y conectar ....
+func (g *Game) updateNetMenu() error {
+	g.lobby.ticks++
+
+	//Las partidas encontradas van y vienen; la selección no puede quedar fuera de la lista
+	if g.lobby.browser != nil {
+		g.lobby.games = g.lobby.browser.Games()
+		if len(g.lobby.games) > maxLANRows {
+			g.lobby.games = g.lobby.games[:maxLANRows]
+		}
+	}
+	total := numNetOptions + len(g.lobby.games)
+	if g.lobby.option >= total {
+		g.lobby.option = total - 1
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyDown) {
+		g.lobby.option = (g.lobby.option + 1) % total
+		g.playSound("select")
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyUp) {
+		g.lobby.option = (g.lobby.option + total - 1) % total
+		g.playSound("select")
+	}
+
+	//Cada dirección se escribe con su opción marcada
+	if address := g.lobby.typedAddress(); address != nil {
+		for _, char := range ebiten.InputChars() {
+			if len(*address) < maxAddressLength {
+				*address += string(char)
+			}
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyBackspace) && len(*address) > 0 {
+			*address = (*address)[:len(*address)-1]
+		}
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
+		g.playSound("select")
+		switch g.lobby.option {
+		case netOptionHost:
+			g.hostNet(defaultHostAddr)
+		case netOptionJoin:
+			if g.lobby.address != "" {
+				g.joinNet(g.lobby.address)
+			}
+		case netOptionServer:
+			if g.lobby.server != "" {
+				g.connectServer(g.lobby.server)
+			}
+		default:
+			game := g.lobby.games[g.lobby.option-numNetOptions]
+			if game.Compatible {
+				g.joinNet(game.Addr)
+			} else {
+				g.lobby.status = game.Name + " juega con otra versión de FETRIS"
+			}
+		}
+	} else if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		g.lobby.status = ""
+		g.stopBrowsing()
+		g.Estado = EstadoPlayMenu
+		g.playSound("select")
+	}
+	return nil
+}
+
+// Dirección que se está escribiendo, nil si la opción marcada no tiene
+func (l *netLobby) typedAddress() *string {
+	switch l.option {
+	case netOptionJoin:
+		return &l.address
+	case netOptionServer:
+		return &l.server
+	}
+	return nil
+}
+
+// Nombre con el que se juega en red, aunque no se haya pasado por la pantalla de nombre
+func (g *Game) netName() string {
+	if g.playerName == "" {
+		return "ANONIMO"
+	}
+	return g.playerName
+}
+
+// .... Reglas y sets con los que se juega, los del host ....
+func (g *Game) netSetup() netplay.Setup {
+	e := g.players[0].engine
+	setup := netplay.SetupFrom(e, g.gameSeed(), g.settings.Netcode)
+	g.settings.applyTo(&setup.Config)
+	setup.Config.Mode = engine.ModeVersus
+	return setup
+}
+
+// .... Hostea en addr y espera al rival ....
+func (g *Game) hostNet(addr string) {
+	ln, err := net.Listen("tcp", netplay.Address(addr))
+	if err != nil && addr == defaultHostAddr {
+		//Otro FETRIS ya hostea en este computador: sirve cualquier puerto, la red local lo anuncia igual
+		ln, err = net.Listen("tcp", ":0")
+	}
+	if err != nil {
+		g.lobby.status = err.Error()
+		g.Estado = EstadoRed
+		return
+	}
+	g.lobby.listener = ln
+	name, setup := g.netName(), g.netSetup()
+	g.waitNet("Esperando rival en "+ln.Addr().String(), func() netResult {
+		s, err := netplay.Host(ln, name, setup)
+		return netResult{session: s, err: err}
+	})
+
+	//Sin anuncio igual se puede unir quien escriba la dirección
+	g.lobby.announcer, err = netplay.Announce(name, setup, ln.Addr().(*net.TCPAddr).Port)
+	if err != nil {
+		g.lobby.status = "No se pudo anunciar en la red local: " + err.Error()
+	}
+}
+
+// .... Se une a la partida hosteada en addr ....
+func (g *Game) joinNet(addr string) {
+	name := g.netName()
+	g.waitNet("Conectando a "+netplay.Address(addr), func() netResult {
+		s, err := netplay.Join(addr, name)
+		return netResult{session: s, err: err}
+	})
+}
+
+// Conecta en otra goroutine, la pantalla de espera revisa si terminó
+func (g *Game) waitNet(waitText string, connect func() netResult) {
+	done := make(chan netResult, 1)
+	go func() {
+		done <- connect()
+	}()
+	g.lobby.waiting = done
+	g.lobby.waitText = waitText
+	g.lobby.ticks = 0
+	g.lobby.status = ""
+	g.stopBrowsing()
+	g.Estado = EstadoRedEspera
+}
+
+// .... Update de la espera: empieza la partida al conectar, ESC cancela ....
+func (g *Game) updateNetWait() error {
+	g.lobby.ticks++
+	select {
+	case r := <-g.lobby.waiting:
+		g.lobby.waiting = nil
+		g.stopListening()
+		if r.err != nil {
+			g.openNetMenu()
+			g.lobby.status = r.err.Error()
+			g.playSound("gameover")
+			return nil
+		}
+		if r.server != nil {
+			g.openServer(r.server)
+		} else {
+			g.startNetGame(r.session)
+		}
+		return nil
+	default:
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		g.cancelNet()
+		g.lobby.status = ""
+		g.openNetMenu()
+		g.playSound("select")
+	}
+	return nil
+}
+
+// Deja de esperar rivales y de anunciar la partida
+func (g *Game) stopListening() {
+	if g.lobby.listener != nil {
+		g.lobby.listener.Close()
+		g.lobby.listener = nil
+	}
+	if g.lobby.announcer != nil {
+		g.lobby.announcer.Close()
+		g.lobby.announcer = nil
+	}
+}
+
+// Cancela la espera; si la conexión igual llega, se cierra sin jugar
+func (g *Game) cancelNet() {
+	g.stopListening()
+	if done := g.lobby.waiting; done != nil {
+		go func() {
+			r := <-done
+			if r.session != nil {
+				r.session.Close("se canceló la partida")
+			}
+			if r.server != nil {
+				r.server.Close("")
+			}
+		}()
+	}
+	g.lobby.waiting = nil
+}
+
+// .... Empieza el versus en red con lo que mandó el host ....
+func (g *Game) startNetGame(s *netplay.Session) {
+	g.endVersus()
+
+	//El motor de jugar solo queda guardado: el host puede mandar otras piezas y niveles
+	g.soloEngine = g.players[0].engine
+	g.addPlayers(2)
+	engines := make([]*engine.Engine, len(g.players))
+	for i, p := range g.players {
+		p.engine = engine.New()
+		s.Setup.Apply(p.engine)
+		p.controls = noControls
+		p.name = s.Remote
+		p.resetEffects()
+		engines[i] = p.engine
+	}
+	local := g.players[s.Local]
+	local.controls = soloControls
+	local.name = g.netName()
+
+	g.match = engine.NewMatch(engines)
+	events := g.match.Start(s.Setup.Seed)
+	conditions := g.lobby.conditions
+	if s.Setup.Netcode == netplay.NetcodeLockstep && conditions.Loss > 0 {
+		//El lockstep no reenvía nada: con pérdidas se quedaría esperando lo que no llega
+		log.Println("-perdida no sirve con lockstep, se simula la red sin pérdidas")
+		conditions.Loss = 0
+	}
+	if conditions.Active() {
+		s.Simulate(conditions, time.Now().UnixNano())
+	}
+	g.net = netplay.NewNetcode(s, g.match, g.settings.NetDelay)
+	g.recording = nil
+
+	g.Estado = EstadoGame
+	g.currentBgm = 0
+	g.bgms[g.currentBgm].Play()
+	g.handleMatchEvents(events)
+}
+
+// .... La partida en red se cortó antes de terminar ....
+func (g *Game) netLost() {
+	g.Estado = EstadoGameOver
+	g.playSound("gameover")
+	if g.bgms[g.currentBgm] != nil && g.bgms[g.currentBgm].IsPlaying() {
+		g.bgms[g.currentBgm].Pause()
+		g.bgms[g.currentBgm].Rewind()
+	}
+}
+
+// .... Pantalla de red ....
+func (g *Game) drawNetMenu(screen *ebiten.Image) {
+	screen.Fill(color.RGBA{29, 29, 41, 255})
+
+	text.Draw(screen, "VERSUS EN RED", g.retroFont, 200, 100, color.White)
+
+	options := []string{
+		"HOSTEAR UNA PARTIDA",
+		"UNIRSE A: " + g.lobby.address,
+		"SERVIDOR: " + g.lobby.server,
+	}
+	if g.lobby.typedAddress() != nil {
+		options[g.lobby.option] += "_"
+	}
+	for i, option := range options {
+		y := 160 + i*45
+		optionColor := color.RGBA{200, 200, 200, 255}
+		if i == g.lobby.option {
+			optionColor = color.RGBA{255, 220, 100, 255}
+			text.Draw(screen, ">", g.retroFont, 150, y, color.White)
+		}
+		text.Draw(screen, option, g.retroFont, 200, y, optionColor)
+	}
+	text.Draw(screen, fmt.Sprintf("Juegas como %s, con las reglas del que hostea o del servidor", g.netName()), g.storyFont, 200, 300, color.RGBA{150, 150, 150, 255})
+	text.Draw(screen, "Sin puerto se usa el de siempre", g.storyFont, 200, 322, color.RGBA{150, 150, 150, 255})
+
+	g.drawLANGames(screen)
+
+	if g.lobby.status != "" {
+		text.Draw(screen, g.lobby.status, g.storyFont, 100, 525, color.RGBA{255, 120, 120, 255})
+	}
+
+	text.Draw(screen, "Elige con ↑ ↓, ENTER para conectar, ESC vuelve", g.retroFont, 100, 560, color.RGBA{150, 150, 150, 255})
+
+	g.drawParticles(screen)
+}
+
+// .... Partidas de la red local, elegibles después de las opciones ....
+func (g *Game) drawLANGames(screen *ebiten.Image) {
+	text.Draw(screen, "EN LA RED LOCAL", g.retroFont, 200, 365, color.White)
+
+	if len(g.lobby.games) == 0 {
+		searching := "Buscando partidas" + "...."[:(g.lobby.ticks/20)%4]
+		if g.lobby.browser == nil {
+			searching = "No se pueden buscar partidas"
+		} else if err := g.lobby.browser.Err(); err != nil {
+			searching = "No se pueden buscar partidas: " + err.Error()
+		}
+		text.Draw(screen, searching, g.storyFont, 200, 400, color.RGBA{150, 150, 150, 255})
+		return
+	}
+
+	for j, game := range g.lobby.games {
+		y := 400 + j*30
+		rowColor := color.RGBA{200, 200, 200, 255}
+		if !game.Compatible {
+			rowColor = color.RGBA{120, 120, 120, 255}
+		}
+		if numNetOptions+j == g.lobby.option {
+			rowColor = color.RGBA{255, 220, 100, 255}
+			text.Draw(screen, ">", g.retroFont, 150, y, color.White)
+		}
+		text.Draw(screen, game.Name, g.retroFont, 200, y, rowColor)
+		text.Draw(screen, lanModeText(game), g.storyFont, 430, y, rowColor)
+		text.Draw(screen, fmt.Sprintf("%d ms", game.Ping.Milliseconds()), g.storyFont, 660, y, rowColor)
+	}
+}
+
+// Modo y sincronización de una partida de la red local
+func lanModeText(game netplay.LANGame) string {
+	if !game.Compatible {
+		return "OTRA VERSION"
+	}
+	mode := engine.Rules(game.Mode).Name
+	if game.Netcode >= 0 && int(game.Netcode) < len(netcodeNames) {
+		mode += " " + netcodeNames[game.Netcode]
+	}
+	return mode
+}
+
+// .... Espera del rival ....
+func (g *Game) drawNetWait(screen *ebiten.Image) {
+	screen.Fill(color.RGBA{29, 29, 41, 255})
+
+	//Puntos que van y vienen para que se note que sigue esperando
+	dots := (g.lobby.ticks / 20) % 4
+	waitText := g.lobby.waitText + "...."[:dots]
+	text.Draw(screen, waitText, g.retroFont, PantallaWidth/2-len(g.lobby.waitText)*6, PantallaHeight/2, color.White)
+	text.Draw(screen, "ESC cancela", g.retroFont, PantallaWidth/2-66, PantallaHeight/2+60, color.RGBA{150, 150, 150, 255})
+	if g.lobby.status != "" {
+		text.Draw(screen, g.lobby.status, g.storyFont, 100, PantallaHeight/2+120, color.RGBA{255, 120, 120, 255})
+	}
+
+	g.drawParticles(screen)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Efocor/FETRIS/engine"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+)
+
+// Carpeta de los replays; ultima.json siempre tiene la última partida (para reportes de bugs)
+const replayDir = "replays"
+
+// Velocidades del visor, en ticks del replay por tick de pantalla
+var replaySpeeds = []float64{0.25, 0.5, 1, 2, 4, 8}
+
+const replayNormalSpeed = 2 //Índice de x1 en replaySpeeds
+
+// .... Guarda el replay de la partida que terminó y devuelve dónde quedó ....
+func (g *Game) saveReplay(now time.Time) string {
+	if g.recording == nil {
+		return ""
+	}
+	os.MkdirAll(replayDir, 0755)
+
+	//La última partida siempre queda a mano, para adjuntarla a un reporte
+	g.recording.Save(filepath.Join(replayDir, "ultima.json"))
+
+	path := filepath.Join(replayDir, fmt.Sprintf("%s-%d.json", now.Format("20060102-150405"), g.recording.Seed))
+	if err := g.recording.Save(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// .... Abre el visor de replays ....
+func (g *Game) openReplay(r *engine.Replay) {
+	//El visor usa su propio motor; el de la partida se guarda para volver a él,
+	//así todo el dibujado (que lee g.engine) sirve igual para el replay
+	g.endVersus()
+	if g.liveEngine == nil {
+		g.liveEngine = g.engine
+	}
+	player, events := engine.NewReplayPlayer(r)
+	g.replay = r
+	g.replayPlayer = player
+	g.engine = player.Engine
+	g.replayPaused = false
+	g.replaySpeed = replayNormalSpeed
+	g.replayTicks = 0
+	g.message = ""
+	g.messageTicks = 0
+	g.popups = g.popups[:0]
+	g.boardParticles = g.boardParticles[:0]
+	g.Estado = EstadoReplay
+
+	if g.bgms[g.currentBgm] != nil {
+		g.bgms[g.currentBgm].Pause()
+		g.bgms[g.currentBgm].Rewind()
+	}
+	g.currentBgm = 0
+	g.playBGM()
+
+	g.handleEvents(events)
+}
+
+// .... Cierra el visor y vuelve a los puntajes ....
+func (g *Game) closeReplay() {
+	if g.liveEngine != nil {
+		g.engine = g.liveEngine
+		g.liveEngine = nil
+	}
+	g.replayPlayer = nil
+	g.message = ""
+	g.Estado = EstadoHighScores
+
+	//Detener la música, o sea un STOP
+	if g.bgms[g.currentBgm] != nil && g.bgms[g.currentBgm].IsPlaying() {
+		g.bgms[g.currentBgm].Pause()
+		g.bgms[g.currentBgm].Rewind()
+	}
+}
+
+// .... Update del visor: pausa, avance de a un tick y velocidad ....
+func (g *Game) updateReplay() error {
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		g.closeReplay()
+		g.playSound("select")
+		return nil
+	}
+
+	//Desde el principio
+	if inpututil.IsKeyJustPressed(ebiten.KeyR) {
+		g.openReplay(g.replay)
+		return nil
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeySpace) || inpututil.IsKeyJustPressed(ebiten.KeyP) {
+		g.replayPaused = !g.replayPaused
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyUp) {
+		g.replaySpeed = min(g.replaySpeed+1, len(replaySpeeds)-1)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyDown) {
+		g.replaySpeed = max(g.replaySpeed-1, 0)
+	}
+
+	//Cuántos ticks del replay tocan en este tick de pantalla
+	steps := 0
+	if g.replayPaused {
+		if inpututil.IsKeyJustPressed(ebiten.KeyRight) {
+			steps = 1
+		}
+	} else {
+		g.replayTicks += replaySpeeds[g.replaySpeed]
+		steps = int(g.replayTicks)
+		g.replayTicks -= float64(steps)
+	}
+
+	for i := 0; i < steps && !g.replayPlayer.Done(); i++ {
+		g.handleEvents(g.replayPlayer.Step())
+		g.tickEffects()
+	}
+	return nil
+}
+
+// .... Dibuja el replay con la barra de controles ....
+func (g *Game) drawReplay(screen *ebiten.Image) {
+	g.drawGame(screen)
+
+	status := fmt.Sprintf("REPLAY x%g", replaySpeeds[g.replaySpeed])
+	if g.replayPlayer.Done() {
+		status = "REPLAY - FIN"
+	} else if g.replayPaused {
+		status = "REPLAY - PAUSA"
+	}
+	text.Draw(screen, status, g.gameFont, 10, PantallaHeight-60, color.RGBA{255, 220, 100, 255})
+
+	timeText := fmt.Sprintf("%.1fs / %.1fs",
+		float64(g.replayPlayer.Tick)/engine.TPS, float64(g.replayPlayer.Length())/engine.TPS)
+	text.Draw(screen, timeText, g.gameFont, 10, PantallaHeight-35, color.RGBA{225, 225, 225, 255})
+
+	helpText := "ESPACIO pausa  → un tick  ↑↓ velocidad  R reinicia  ESC vuelve"
+	text.Draw(screen, helpText, g.retroFont, PantallaWidth/2-len(helpText)*4, PantallaHeight-8, color.RGBA{150, 150, 150, 255})
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+
+	"github.com/Efocor/FETRIS/engine"
+	"github.com/Efocor/FETRIS/netplay"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+)
+
+// .... Servidor de salas: la lista de salas, la espera en una y su partida ....
+// La partida la juega el servidor; acá se le manda lo que se aprieta y se juega
+// cada tick que devuelve. Salir de la sala es salir del servidor.
+
+// Cada cuántos ticks se pide de nuevo la lista de salas
+const roomsRefreshTicks = 2 * engine.TPS
+
+// Salas que caben en la pantalla, después de crear una
+const maxRoomRows = 7
+
+// Nombre de cada objetivo de la basura, en el orden de engine.TargetKind
+var targetNames = [engine.NumTargets]string{"AL SIGUIENTE", "AL AZAR", "DE REVANCHA", "AL LIDER"}
+
+// .... Se conecta al servidor de salas en addr ....
+func (g *Game) connectServer(addr string) {
+	name := g.netName()
+	g.waitNet("Conectando al servidor "+addr, func() netResult {
+		c, err := netplay.DialServer(addr, name)
+		return netResult{server: c, err: err}
+	})
+}
+
+// .... Lista de salas del servidor (o la sala, si ya se está en una) ....
+func (g *Game) openServer(c *netplay.ServerConn) {
+	g.server = c
+	g.lobby.roomOption = 0
+	g.lobby.ticks = 0
+	g.Estado = EstadoServidor
+	if c.Room != nil {
+		g.Estado = EstadoSala
+	}
+}
+
+// Se va del servidor, y con eso de la sala
+func (g *Game) leaveServer() {
+	if g.server != nil {
+		g.server.Close("")
+		g.server = nil
+	}
+}
+
+// Se cortó la conexión con el servidor: de vuelta a la pantalla de red con el error
+func (g *Game) serverLost(err error) {
+	g.leaveServer()
+	g.openNetMenu()
+	g.lobby.status = err.Error()
+	g.playSound("gameover")
+}
+
+// Salas que se muestran
+func (g *Game) visibleRooms() []netplay.RoomInfo {
+	rooms := g.server.Rooms
+	if len(rooms) > maxRoomRows {
+		rooms = rooms[:maxRoomRows]
+	}
+	return rooms
+}
+
+// .... Update de la lista de salas: crear una o entrar a una ....
+func (g *Game) updateServerRooms() error {
+	g.lobby.ticks++
+	if _, err := g.server.Update(); err != nil {
+		g.serverLost(err)
+		return nil
+	}
+	if g.server.Room != nil {
+		g.Estado = EstadoSala
+		return nil
+	}
+
+	//La lista se actualiza sola cada tanto, o con R
+	if g.lobby.ticks%roomsRefreshTicks == 0 || inpututil.IsKeyJustPressed(ebiten.KeyR) {
+		g.server.Refresh()
+	}
+
+	rooms := g.visibleRooms()
+	total := 1 + len(rooms)
+	if g.lobby.roomOption >= total {
+		g.lobby.roomOption = total - 1
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyDown) {
+		g.lobby.roomOption = (g.lobby.roomOption + 1) % total
+		g.playSound("select")
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyUp) {
+		g.lobby.roomOption = (g.lobby.roomOption + total - 1) % total
+		g.playSound("select")
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
+		g.playSound("select")
+		//Lo que el servidor no haga llega como aviso y reemplaza al anterior
+		g.server.Notice = ""
+		if g.lobby.roomOption == 0 {
+			g.server.Create("")
+		} else {
+			g.server.JoinRoom(rooms[g.lobby.roomOption-1].ID)
+		}
+	} else if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		g.leaveServer()
+		g.openNetMenu()
+		g.playSound("select")
+	}
+	return nil
+}
+
+// .... Update de la sala: el dueño la empieza, ESC se va ....
+func (g *Game) updateRoom() error {
+	g.lobby.ticks++
+	start, err := g.server.Update()
+	if err != nil {
+		g.serverLost(err)
+		return nil
+	}
+	if start != nil {
+		g.startServerGame(start)
+		return nil
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) && g.server.Owner() {
+		g.server.Notice = ""
+		g.server.Start()
+		g.playSound("select")
+	} else if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		g.leaveServer()
+		g.openNetMenu()
+		g.playSound("select")
+	}
+	return nil
+}
+
+// .... Empieza la partida de la sala, con un tablero por jugador ....
+func (g *Game) startServerGame(start *netplay.ServerStart) {
+	g.endVersus()
+
+	//Igual que en el versus en red: las reglas y los sets son los del servidor
+	g.soloEngine = g.players[0].engine
+	g.addPlayers(len(start.Names))
+	engines := make([]*engine.Engine, len(g.players))
+	for i, p := range g.players {
+		p.engine = engine.New()
+		start.Setup.Apply(p.engine)
+		p.controls = noControls
+		p.name = start.Names[i]
+		p.resetEffects()
+		engines[i] = p.engine
+	}
+	g.players[start.Player].controls = soloControls
+
+	g.match = engine.NewMatch(engines)
+	events := g.match.Start(start.Setup.Seed)
+	g.net = netplay.NewServerMatch(g.server, start, g.match)
+	g.recording = nil
+
+	g.Estado = EstadoGame
+	g.currentBgm = 0
+	g.bgms[g.currentBgm].Play()
+	g.handleMatchEvents(events)
+}
+
+// .... La basura propia pasa al objetivo que sigue; el cambio vuelve con un tick del servidor ....
+func (g *Game) cycleTarget() {
+	current := g.match.Targeting[g.net.Local()]
+	g.server.SetTarget((current + 1) % engine.NumTargets)
+	g.playSound("select")
+}
+
+// .... Lista de salas ....
+func (g *Game) drawServerRooms(screen *ebiten.Image) {
+	screen.Fill(color.RGBA{29, 29, 41, 255})
+
+	text.Draw(screen, "SALAS DE "+g.server.RemoteAddr(), g.retroFont, 200, 100, color.White)
+
+	rooms := g.visibleRooms()
+	options := []string{"CREAR SALA"}
+	for _, room := range rooms {
+		options = append(options, room.Name)
+	}
+	for i, option := range options {
+		y := 160 + i*45
+		optionColor := color.RGBA{200, 200, 200, 255}
+		if i == g.lobby.roomOption {
+			optionColor = color.RGBA{255, 220, 100, 255}
+			text.Draw(screen, ">", g.retroFont, 150, y, color.White)
+		}
+		text.Draw(screen, option, g.retroFont, 200, y, optionColor)
+		if i > 0 {
+			text.Draw(screen, roomStatusText(rooms[i-1]), g.storyFont, 500, y, optionColor)
+		}
+	}
+	if len(rooms) == 0 {
+		text.Draw(screen, "Todavía no hay salas, crea una y espera a los demás", g.storyFont, 200, 240, color.RGBA{150, 150, 150, 255})
+	}
+
+	if g.server.Notice != "" {
+		text.Draw(screen, g.server.Notice, g.storyFont, 100, 525, color.RGBA{255, 120, 120, 255})
+	}
+
+	text.Draw(screen, "↑ ↓ elige, ENTER entra, R actualiza, ESC sale", g.retroFont, 100, 560, color.RGBA{150, 150, 150, 255})
+
+	g.drawParticles(screen)
+}
+
+// Jugadores de una sala y si se puede entrar
+func roomStatusText(room netplay.RoomInfo) string {
+	status := fmt.Sprintf("%d/%d", len(room.Players), netplay.MaxRoomPlayers)
+	if room.Playing {
+		status += "  JUGANDO"
+	}
+	return status
+}
+
+// .... Sala: quiénes están y quién la empieza ....
+func (g *Game) drawRoom(screen *ebiten.Image) {
+	screen.Fill(color.RGBA{29, 29, 41, 255})
+
+	room := g.server.Room
+	text.Draw(screen, room.Name, g.retroFont, 200, 100, color.White)
+
+	for i, name := range room.Players {
+		y := 150 + i*35
+		nameColor := color.RGBA{200, 200, 200, 255}
+		if i == g.server.Player {
+			nameColor = color.RGBA{255, 220, 100, 255}
+			text.Draw(screen, ">", g.retroFont, 150, y, color.White)
+		}
+		if i == 0 {
+			name += " (DUEÑO)"
+		}
+		text.Draw(screen, name, g.retroFont, 200, y, nameColor)
+	}
+
+	//Lo que se espera, con puntos que van y vienen
+	var waitText string
+	switch {
+	case room.Playing:
+		waitText = "Están terminando una partida"
+	case len(room.Players) < netplay.MinRoomPlayers:
+		waitText = "Esperando más jugadores"
+	case !g.server.Owner():
+		waitText = "Esperando que " + room.Players[0] + " empiece"
+	}
+	if waitText == "" {
+		waitText = "ENTER empieza la partida"
+	} else {
+		waitText += "...."[:(g.lobby.ticks/20)%4]
+	}
+	text.Draw(screen, waitText, g.retroFont, 200, 460, color.RGBA{120, 255, 120, 255})
+	text.Draw(screen, "En la partida, T cambia a quién le mandas la basura", g.storyFont, 200, 490, color.RGBA{150, 150, 150, 255})
+
+	if g.server.Notice != "" {
+		text.Draw(screen, g.server.Notice, g.storyFont, 100, 525, color.RGBA{255, 120, 120, 255})
+	}
+
+	text.Draw(screen, "ESC sale de la sala y del servidor", g.retroFont, 100, 560, color.RGBA{150, 150, 150, 255})
+
+	g.drawParticles(screen)
+}
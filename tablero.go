@@ -0,0 +1,60 @@
+package main
+
+import (
+	"image"
+
+	"github.com/Efocor/FETRIS/engine"
+)
+
+// .... Dónde y de qué tamaño se dibuja el tablero ....
+// El tablero (con su marco) se centra en el espacio entre los textos de la
+// izquierda y los de la derecha, con las celdas más grandes que quepan.
+type boardLayout struct {
+	x, y int //Esquina de la celda (0, 0) en pantalla
+	cell int //Lado de una celda en pixeles
+}
+
+// Espacio de la pantalla para el tablero con su marco, jugando solo
+var soloBoardArea = image.Rect(220, 20, 580, 590)
+
+// Los tableros chicos no crecen más que esto
+const maxCellSize = 40
+
+// Lado en pixeles de block6.png, las celdas de otro tamaño lo escalan
+const blockImageSize = 30
+
+// .... Layout del tablero de width x height centrado en area, con celdas de a lo más maxCell (0 = las que quepan) ....
+func fitBoard(area image.Rectangle, width, height, maxCell int) boardLayout {
+	//El marco ocupa una celda por lado
+	cell := min(min(area.Dx()/(width+2), area.Dy()/(height+2)), maxCellSize)
+	if maxCell > 0 && maxCell < cell {
+		cell = maxCell
+	}
+	return boardLayout{
+		x:    area.Min.X + (area.Dx()-width*cell)/2,
+		y:    area.Min.Y + (area.Dy()-(height+2)*cell)/2 + cell,
+		cell: cell,
+	}
+}
+
+// .... Layout del tablero de la partida con la celda elegida en opciones ....
+func (g *Game) fitLayout() boardLayout {
+	return fitBoard(soloBoardArea, g.engine.Width(), g.engine.Height(), g.settings.CellSize)
+}
+
+// .... Esquina en pantalla de la celda (x, y) del tablero ....
+func (g *Game) cellPosition(x, y int) (float64, float64) {
+	return float64(g.layout.x + x*g.layout.cell), float64(g.layout.y + y*g.layout.cell)
+}
+
+// Escala de block6.png para el tamaño de celda dado
+func blockScale(size int) float64 {
+	return float64(size) / blockImageSize
+}
+
+// Medidas del tablero que se pueden elegir en opciones
+var (
+	boardWidthOptions  = []int{6, 8, engine.GridWidth, 12, 14}
+	boardHeightOptions = []int{14, engine.GridHeight, 20, 24}
+	cellSizeOptions    = []int{0, 20, 24, 30, 36}
+)
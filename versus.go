@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/Efocor/FETRIS/engine"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+)
+
+// .... Versus en la misma pantalla: dos tableros lado a lado, o más en las salas del servidor ....
+
+// Teclas de cada jugador, para el menú
+var versusHelp = []string{
+	"JUGADOR 1: A D mover, S baja, W cae, Q E rotar, R media vuelta, Shift izq. guarda",
+	"JUGADOR 2: ← → mover, ↓ baja, ENTER cae, ↑ rotar, . y / al revés, Shift der. guarda",
+	"Cada uno puede usar además un gamepad",
+	"Las líneas le mandan basura al rival",
+}
+
+// .... Empieza el versus: un motor por jugador, con las mismas reglas y semilla ....
+func (g *Game) startVersus(seed int64) [][]engine.Event {
+	g.endVersus()
+	first := g.players[0].engine
+	g.addPlayers(len(versusControls))
+
+	engines := make([]*engine.Engine, len(g.players))
+	for i, p := range g.players {
+		p.controls = versusControls[i]
+		p.name = fmt.Sprintf("JUGADOR %d", i+1)
+		p.engine.Pieces = first.Pieces
+		p.engine.Levels = first.Levels
+		p.engine.Puzzle = nil
+		g.settings.applyTo(&p.engine.Config)
+		engines[i] = p.engine
+	}
+
+	g.match = engine.NewMatch(engines)
+	return g.match.Start(seed)
+}
+
+// Agrega jugadores hasta tener n
+func (g *Game) addPlayers(n int) {
+	for len(g.players) < n {
+		g.players = append(g.players, newPlayerState(noControls))
+	}
+}
+
+// .... Vuelve a un solo jugador, con los controles de siempre ....
+func (g *Game) endVersus() {
+	if g.net != nil {
+		g.net.Close()
+		//Si la partida se cortó, la conexión con el servidor de salas tampoco sigue
+		if g.net.Err() != nil {
+			g.leaveServer()
+		}
+		g.net = nil
+	}
+	if g.soloEngine != nil {
+		g.players[0].engine = g.soloEngine
+		g.soloEngine = nil
+	}
+	g.match = nil
+	g.players = g.players[:1]
+	g.players[0].controls = soloControls
+	g.playerState = g.players[0]
+}
+
+// .... Un tick del versus: cada uno con su entrada, y los efectos de cada tablero ....
+func (g *Game) updateVersus() {
+	var events [][]engine.Event
+	if g.net != nil {
+		//En red se juega solo el tablero propio, el del rival llega por la conexión
+		var err error
+		events, err = g.net.Update(g.players[g.net.Local()].controls.read())
+		if err != nil {
+			g.netLost()
+			return
+		}
+		if g.server != nil && inpututil.IsKeyJustPressed(ebiten.KeyT) {
+			g.cycleTarget()
+		}
+	} else {
+		inputs := make([]engine.Input, len(g.players))
+		for i, p := range g.players {
+			inputs[i] = p.controls.read()
+		}
+		events = g.match.Step(inputs)
+	}
+
+	//Mientras se espera al rival no hay eventos, pero los efectos siguen
+	if events != nil {
+		g.handleMatchEvents(events)
+	}
+	for _, p := range g.players {
+		g.playerState = p
+		g.tickEffects()
+	}
+	g.playerState = g.players[0]
+
+	//En red el final tiene que estar confirmado: lo adivinado todavía puede cambiar
+	if g.match.Over && (g.net == nil || g.net.Over()) {
+		g.versusOver()
+	}
+}
+
+// Eventos de cada jugador, con su tablero
+func (g *Game) handleMatchEvents(events [][]engine.Event) {
+	for i, p := range g.players {
+		g.playerState = p
+		g.handleEvents(events[i])
+	}
+	g.playerState = g.players[0]
+}
+
+// .... Terminó el versus: sin puntajes ni replay, solo quién ganó ....
+func (g *Game) versusOver() {
+	g.Estado = EstadoGameOver
+	g.playSound("gameover")
+	if g.net != nil {
+		g.net.Close()
+	}
+	if g.bgms[g.currentBgm] != nil && g.bgms[g.currentBgm].IsPlaying() {
+		g.bgms[g.currentBgm].Pause()
+		g.bgms[g.currentBgm].Rewind()
+	}
+}
+
+// Espacio de la pantalla para el tablero de cada jugador, con su marco; big dice si
+// caben además las piezas y los mensajes. Con dos jugadores cada uno tiene su mitad;
+// con más, el propio va grande a la izquierda y los rivales en una grilla a la derecha.
+func (g *Game) versusBoardArea(i int) (area image.Rectangle, big bool) {
+	half := PantallaWidth / 2
+	if len(g.players) <= 2 {
+		return image.Rect(i*half+70, 60, (i+1)*half-70, PantallaHeight-20), true
+	}
+	local := 0
+	if g.net != nil {
+		local = g.net.Local()
+	}
+	if i == local {
+		return image.Rect(70, 60, half-70, PantallaHeight-20), true
+	}
+
+	//Los rivales en su orden, saltándose el propio
+	slot := i
+	if i > local {
+		slot--
+	}
+	rivals := len(g.players) - 1
+	cols := 2
+	if rivals > 4 {
+		cols = 3
+	}
+	rows := (rivals + cols - 1) / cols
+	w, h := (half-10)/cols, (PantallaHeight-10)/rows
+	x, y := half+(slot%cols)*w, 10+(slot/cols)*h
+	return image.Rect(x+4, y+40, x+w-4, y+h-4), false
+}
+
+// .... Los tableros, cada uno achicado para que quepa en su lugar ....
+func (g *Game) drawVersus(screen *ebiten.Image) {
+	for i, p := range g.players {
+		g.playerState = p
+		area, big := g.versusBoardArea(i)
+		g.layout = fitBoard(area, g.engine.Width(), g.engine.Height(), g.settings.CellSize)
+		g.drawBoard(screen)
+
+		nameColor := color.RGBA{255, 120, 120, 255}
+		if g.engine.Over && !g.match.Over {
+			nameColor = color.RGBA{120, 120, 120, 255}
+		}
+		if !big {
+			//Los rivales chicos van con lo justo
+			text.Draw(screen, p.name, g.storyFont, area.Min.X, area.Min.Y-24, nameColor)
+			text.Draw(screen, fmt.Sprintf("Enviadas %d", g.engine.Sent), g.storyFont, area.Min.X, area.Min.Y-6, color.RGBA{225, 225, 225, 255})
+			continue
+		}
+
+		//Nombre y puntaje arriba, la pieza siguiente a la derecha y la guardada a la izquierda
+		text.Draw(screen, p.name, g.retroFont, area.Min.X, area.Min.Y-30, nameColor)
+		status := fmt.Sprintf("Líneas %d  Enviadas %d", g.engine.Lines, g.engine.Sent)
+		text.Draw(screen, status, g.storyFont, area.Min.X, area.Min.Y-10, color.RGBA{225, 225, 225, 255})
+
+		if g.Estado == EstadoGame {
+			right := g.layout.x + g.engine.Width()*g.layout.cell + g.layout.cell + 6
+			g.drawPreviewPiece(screen, right, g.layout.y, versusPreviewSize, g.engine.NextPieces[0], g.engine.NextSpecial[0])
+			g.drawPreviewPiece(screen, area.Min.X-64, g.layout.y, versusPreviewSize, g.engine.HeldPiece, g.engine.HeldSpecial)
+		}
+
+		if g.message != "" {
+			text.Draw(screen, g.message, g.retroFont, area.Min.X, area.Max.Y+12, color.RGBA{255, 220, 100, 255})
+		} else if g.server != nil && g.Estado == EstadoGame && i == g.net.Local() {
+			//En las salas cada uno elige a quién le manda la basura
+			target := "Basura " + targetNames[g.match.Targeting[i]] + " (T cambia)"
+			text.Draw(screen, target, g.storyFont, area.Min.X, area.Max.Y+12, color.RGBA{150, 150, 150, 255})
+		}
+	}
+	g.playerState = g.players[0]
+
+	//Si el rival tarda en mandar su entrada, la partida se queda esperando
+	if g.net != nil && g.net.Stalled() > netWaitNotice && g.Estado == EstadoGame {
+		waitText := "Esperando al rival..."
+		if g.server != nil {
+			waitText = "Esperando al servidor..."
+		}
+		text.Draw(screen, waitText, g.retroFont, PantallaWidth/2-len(waitText)*6, PantallaHeight/2, color.White)
+	}
+}
+
+// Updates esperando al rival antes de avisarlo en pantalla
+const netWaitNotice = 10
+
+// Lado de las celdas de las piezas siguiente y guardada en versus
+const versusPreviewSize = 12
+
+// .... Quién ganó, sobre los tableros ....
+func (g *Game) drawVersusOver(screen *ebiten.Image) {
+	result := "EMPATE"
+	detail := ""
+	switch {
+	case g.net != nil && !g.net.Over() && g.net.Err() != nil:
+		//La partida en red se cortó antes de que alguien ganara
+		result = "SE CORTÓ LA PARTIDA"
+		detail = g.net.Err().Error()
+	case g.match.Winner >= 0:
+		result = "GANA " + g.players[g.match.Winner].name
+	}
+	text.Draw(screen, result, g.retroFont,
+		PantallaWidth/2-len(result)*6,
+		PantallaHeight/2-40,
+		color.RGBA{120, 255, 120, 255})
+	if detail != "" {
+		text.Draw(screen, detail, g.storyFont,
+			PantallaWidth/2-len(detail)*4,
+			PantallaHeight/2,
+			color.RGBA{255, 120, 120, 255})
+	}
+
+	restartText := "Presiona ESPACIO o ESC para volver"
+	text.Draw(screen, restartText, g.retroFont,
+		PantallaWidth/2-len(restartText)*6,
+		PantallaHeight/2+40,
+		color.RGBA{200, 200, 200, 255})
+}